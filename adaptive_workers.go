@@ -0,0 +1,125 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"time"
+)
+
+// workerPool sizes the worker pool of a WorkerManager with adaptive workers using additive increase, multiplicative decrease:
+// once per WorkerAdjustInterval the pool grows by one worker if tasks are waiting for a worker, and is halved if task latency or error rate get too high.
+// Workers beyond the pool size are parked and not handed any tasks. Only accessed by the WorkerManager's processing goroutine.
+type workerPool struct {
+	config *ConsumerConfig
+
+	// Desired size of the pool.
+	target int
+
+	// Number of workers that are not parked.
+	size int
+
+	parked []*Worker
+
+	// Lowest average task latency observed in an adjustment window.
+	minLatency time.Duration
+
+	windowStart time.Time
+	completed   int
+	latency     time.Duration
+	attempts    int
+	failures    int
+}
+
+func newWorkerPool(config *ConsumerConfig, parked []*Worker, now time.Time) *workerPool {
+	return &workerPool{
+		config:      config,
+		target:      config.NumWorkers,
+		size:        config.NumWorkers,
+		parked:      parked,
+		windowStart: now,
+	}
+}
+
+// attempted records the result of a single task attempt.
+func (this *workerPool) attempted(success bool) {
+	this.attempts++
+	if !success {
+		this.failures++
+	}
+}
+
+// release records a given latency of a done task and returns true if its worker should be parked to shrink the pool.
+func (this *workerPool) release(worker *Worker, latency time.Duration) bool {
+	this.completed++
+	this.latency += latency
+	if this.size > this.target {
+		this.size--
+		this.parked = append(this.parked, worker)
+		return true
+	}
+	return false
+}
+
+// adjust updates the target pool size once per WorkerAdjustInterval given the number of tasks waiting for a worker.
+// Returns the workers to unpark to grow the pool.
+func (this *workerPool) adjust(now time.Time, queued int) []*Worker {
+	if now.Sub(this.windowStart) < this.config.WorkerAdjustInterval {
+		return nil
+	}
+
+	var latency time.Duration
+	if this.completed > 0 {
+		latency = this.latency / time.Duration(this.completed)
+		if this.minLatency == 0 || latency < this.minLatency {
+			this.minLatency = latency
+		}
+	}
+	latencyTarget := this.config.WorkerLatencyTarget
+	if latencyTarget == 0 {
+		latencyTarget = 2 * this.minLatency
+	}
+
+	switch {
+	case this.attempts > 0 && float64(this.failures)/float64(this.attempts) > this.config.WorkerErrorRateThreshold:
+		this.target = maxInt(this.config.MinWorkers, this.target/2)
+	case this.completed > 0 && latency > latencyTarget:
+		if this.target == this.config.MinWorkers {
+			// tasks got slower regardless of concurrency, so latency observed so far is no baseline anymore
+			this.minLatency = latency
+		}
+		this.target = maxInt(this.config.MinWorkers, this.target/2)
+	case queued > 0 && this.target < this.config.MaxWorkers:
+		this.target++
+	}
+
+	this.windowStart = now
+	this.completed, this.latency, this.attempts, this.failures = 0, 0, 0, 0
+
+	unparked := make([]*Worker, 0)
+	for this.size < this.target && len(this.parked) > 0 {
+		unparked = append(unparked, this.parked[len(this.parked)-1])
+		this.parked = this.parked[:len(this.parked)-1]
+		this.size++
+	}
+	return unparked
+}
+
+func maxInt(first int, second int) int {
+	if first > second {
+		return first
+	}
+	return second
+}
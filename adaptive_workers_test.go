@@ -0,0 +1,112 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestWorkerPoolAdjustment(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.AdaptiveWorkers = true
+	config.NumWorkers = 2
+	config.MinWorkers = 1
+	config.MaxWorkers = 4
+	config.WorkerAdjustInterval = time.Second
+
+	parked := []*Worker{&Worker{}, &Worker{}}
+	now := time.Now()
+	pool := newWorkerPool(config, append([]*Worker{}, parked...), now)
+
+	window := func(latency time.Duration, failures int, queued int) []*Worker {
+		for i := 0; i < 10; i++ {
+			pool.attempted(i >= failures)
+		}
+		pool.completed += 10
+		pool.latency += 10 * latency
+		now = now.Add(config.WorkerAdjustInterval)
+		return pool.adjust(now, queued)
+	}
+
+	// nothing happens before the adjustment interval passes
+	assert(t, len(pool.adjust(now.Add(time.Millisecond), 5)), 0)
+
+	// tasks waiting for a worker with stable latency grow the pool by one worker per interval up to MaxWorkers
+	assert(t, window(10*time.Millisecond, 0, 5), []*Worker{parked[1]})
+	assert(t, window(10*time.Millisecond, 0, 5), []*Worker{parked[0]})
+	assert(t, pool.size, 4)
+	assert(t, len(window(10*time.Millisecond, 0, 5)), 0)
+	assert(t, pool.target, 4)
+
+	// latency over twice the lowest observed latency halves the pool, parking workers as they are released
+	window(30*time.Millisecond, 0, 5)
+	assert(t, pool.target, 2)
+	assert(t, pool.release(parked[0], 0), true)
+	assert(t, pool.release(parked[1], 0), true)
+	assert(t, pool.release(&Worker{}, 0), false)
+	assert(t, pool.size, 2)
+
+	// a high error rate halves the pool down to MinWorkers
+	window(10*time.Millisecond, 5, 5)
+	assert(t, pool.target, 1)
+	window(10*time.Millisecond, 5, 5)
+	assert(t, pool.target, 1)
+
+	// no queued tasks keep the pool as it is
+	window(10*time.Millisecond, 0, 0)
+	assert(t, pool.target, 1)
+
+	// an explicit latency target overrides the observed baseline
+	config.WorkerLatencyTarget = 5 * time.Millisecond
+	pool.target = 3
+	window(10*time.Millisecond, 0, 5)
+	assert(t, pool.target, 1)
+}
+
+func TestAdaptiveWorkerManager(t *testing.T) {
+	wmid := "test-adaptive-WM"
+	config := DefaultConsumerConfig()
+	config.AdaptiveWorkers = true
+	config.NumWorkers = 1
+	config.MaxWorkers = 4
+	config.WorkerAdjustInterval = 50 * time.Millisecond
+	config.Strategy = sleepStrategy(100 * time.Millisecond)
+	storage := newInMemoryBatchOffsetStorage()
+	config.OffsetStorage = storage
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, make(chan bool))
+	assert(t, len(manager.workers), 4)
+	assert(t, len(manager.availableWorkers), 1)
+	go manager.Start()
+
+	batch := make([]*Message, 0)
+	for offset := int64(0); offset < 20; offset++ {
+		batch = append(batch, &Message{Offset: offset})
+	}
+	manager.inputChannel <- batch
+	time.Sleep(2 * time.Second)
+	if workers := manager.partitionMetrics.workers().Value(); workers <= 1 {
+		t.Errorf("Worker pool should grow while tasks are waiting for workers, actual size: %d", workers)
+	}
+	<-manager.Stop()
+
+	assert(t, storage.offsets[topicPartition].Offset, int64(19))
+}
@@ -0,0 +1,389 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often a Backfill checks whether all partitions reached the end of their ranges.
+const backfillCheckInterval = 100 * time.Millisecond
+
+// OffsetRange is a range of offsets of a single partition, from Start inclusive to End exclusive.
+type OffsetRange struct {
+	// First offset to consume.
+	Start int64
+
+	// Offset to stop at, which is not consumed. A negative End stands for the latest offset when the backfill starts.
+	End int64
+}
+
+func (this OffsetRange) String() string {
+	return fmt.Sprintf("[%d, %d)", this.Start, this.End)
+}
+
+// Backfill consumes a bounded range of offsets of given partitions and closes its consumer once every partition reaches the end of its range.
+// It starts the consumer with StartStaticPartitionsFrom, so no group coordination takes place. Partitions are claimed and offsets committed
+// for a group of its own derived from ConsumerConfig.Groupid, so that the consumers of that group are left alone.
+// Messages at or past the end of a range are never handed to workers, so offsets are never committed past the end.
+type Backfill struct {
+	config   *ConsumerConfig
+	client   *backfillClient
+	consumer *Consumer
+
+	ranges     map[TopicAndPartition]OffsetRange
+	partitions map[string][]int32
+	startTime  time.Time
+	endTime    time.Time
+
+	completed int32
+	done      chan struct{}
+	doneOnce  sync.Once
+}
+
+// Creates a new Backfill consuming given offset ranges, keyed by topic and partition, with a given ConsumerConfig.
+func NewBackfill(config *ConsumerConfig, ranges map[string]map[int32]OffsetRange) *Backfill {
+	backfill := newBackfill(config)
+	for topic, partitions := range ranges {
+		for partition, offsetRange := range partitions {
+			backfill.ranges[TopicAndPartition{topic, partition}] = offsetRange
+		}
+	}
+	return backfill
+}
+
+// Creates a new Backfill consuming the messages of given partitions, keyed by topic, with timestamps from a start time inclusive to an end time exclusive.
+// A zero end time stands for the latest offset when the backfill starts. Offsets are looked up when the backfill starts,
+// so the LowLevelClient of the given ConsumerConfig must be a TimestampOffsetClient.
+func NewTimeBackfill(config *ConsumerConfig, partitions map[string][]int32, start time.Time, end time.Time) *Backfill {
+	if _, ok := config.LowLevelClient.(TimestampOffsetClient); !ok {
+		panic(fmt.Sprintf("%s cannot look up offsets by timestamp", config.LowLevelClient))
+	}
+	backfill := newBackfill(config)
+	backfill.partitions = partitions
+	backfill.startTime = start
+	backfill.endTime = end
+	return backfill
+}
+
+func newBackfill(config *ConsumerConfig) *Backfill {
+	backfillConfig := *config
+	backfillConfig.Groupid = fmt.Sprintf("%s-backfill-%d", config.Groupid, time.Now().UnixNano())
+	// a start offset of 0 is passed to the fetcher as an invalid offset, which has to reset to the beginning of the partition
+	backfillConfig.AutoOffsetReset = SmallestOffset
+	client := newBackfillClient(config.LowLevelClient, time.Duration(config.FetchWaitMaxMs)*time.Millisecond)
+	backfillConfig.LowLevelClient = client
+
+	return &Backfill{
+		config:   &backfillConfig,
+		client:   client,
+		consumer: NewConsumer(&backfillConfig),
+		ranges:   make(map[TopicAndPartition]OffsetRange),
+		done:     make(chan struct{}),
+	}
+}
+
+func (this *Backfill) String() string {
+	return fmt.Sprintf("backfill-%s", this.config.Consumerid)
+}
+
+// Resolves the offset ranges of this Backfill and starts consuming them. Panics if the offset ranges cannot be resolved.
+// Call to this method blocks until the backfill completes or is closed.
+func (this *Backfill) Start() {
+	if err := this.resolveRanges(); err != nil {
+		panic(fmt.Sprintf("Failed to resolve backfill offset ranges: %s", err))
+	}
+	this.client.setRanges(this.ranges)
+
+	offsets := make(map[string]map[int32]int64)
+	for topicPartition, offsetRange := range this.ranges {
+		if _, exists := offsets[topicPartition.Topic]; !exists {
+			offsets[topicPartition.Topic] = make(map[int32]int64)
+		}
+		offsets[topicPartition.Topic][topicPartition.Partition] = offsetRange.Start
+		Infow(this, "Backfilling partition", Fields{"topic": topicPartition.Topic, "partition": topicPartition.Partition, "range": offsetRange})
+	}
+
+	go this.awaitEnd()
+	this.consumer.StartStaticPartitionsFrom(offsets)
+	if !this.Completed() {
+		this.finish()
+	}
+}
+
+// Stops this Backfill before it completes. Returns a channel which will get a single value once the consumer is closed.
+func (this *Backfill) Close() <-chan bool {
+	return this.consumer.Close()
+}
+
+// Returns a channel which is closed once this Backfill stops, either because it completed or because it was closed.
+// If it completed, the consumer is closed by then.
+func (this *Backfill) Done() <-chan struct{} {
+	return this.done
+}
+
+// Returns true if every partition reached the end of its range.
+func (this *Backfill) Completed() bool {
+	return atomic.LoadInt32(&this.completed) == 1
+}
+
+// Returns the offset ranges of this Backfill, keyed by topic and partition. Ranges given by time are available once the backfill starts.
+func (this *Backfill) Ranges() map[string]map[int32]OffsetRange {
+	ranges := make(map[string]map[int32]OffsetRange)
+	for topicPartition, offsetRange := range this.ranges {
+		if _, exists := ranges[topicPartition.Topic]; !exists {
+			ranges[topicPartition.Topic] = make(map[int32]OffsetRange)
+		}
+		ranges[topicPartition.Topic][topicPartition.Partition] = offsetRange
+	}
+	return ranges
+}
+
+// Returns the consumer group this Backfill claims partitions and commits offsets for, which is <Groupid>-backfill-<start of backfill in ns>.
+func (this *Backfill) Groupid() string {
+	return this.config.Groupid
+}
+
+// Returns the Consumer used by this Backfill.
+func (this *Backfill) Consumer() *Consumer {
+	return this.consumer
+}
+
+func (this *Backfill) finish() {
+	this.doneOnce.Do(func() { close(this.done) })
+}
+
+// resolveRanges looks up the offsets of time ranges and of ranges ending at the latest offset.
+func (this *Backfill) resolveRanges() error {
+	client := this.client.client
+	latest := func(topicPartition TopicAndPartition) (int64, error) {
+		offset, err := client.GetAvailableOffset(topicPartition.Topic, topicPartition.Partition, LargestOffset)
+		if err == nil && offset < 0 {
+			err = fmt.Errorf("no latest offset for %s", &topicPartition)
+		}
+		return offset, err
+	}
+
+	if this.partitions != nil {
+		timestampClient := client.(TimestampOffsetClient)
+		for topic, partitions := range this.partitions {
+			for _, partition := range partitions {
+				topicPartition := TopicAndPartition{topic, partition}
+				start, err := timestampClient.GetOffsetForTime(topic, partition, this.startTime)
+				if err != nil {
+					return err
+				}
+				end := InvalidOffset
+				if !this.endTime.IsZero() {
+					if end, err = timestampClient.GetOffsetForTime(topic, partition, this.endTime); err != nil {
+						return err
+					}
+				}
+				this.ranges[topicPartition] = OffsetRange{Start: start, End: end}
+			}
+		}
+	}
+
+	for topicPartition, offsetRange := range this.ranges {
+		if offsetRange.End < 0 {
+			end, err := latest(topicPartition)
+			if err != nil {
+				return err
+			}
+			offsetRange.End = end
+			this.ranges[topicPartition] = offsetRange
+		}
+	}
+	return nil
+}
+
+// awaitEnd closes the consumer once every partition reached the end of its range.
+func (this *Backfill) awaitEnd() {
+	ticker := time.NewTicker(backfillCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.done:
+			return
+		case <-ticker.C:
+			if this.reachedEnd() {
+				Info(this, "All partitions reached the end of their ranges, closing consumer")
+				atomic.StoreInt32(&this.completed, 1)
+				<-this.consumer.Close()
+				this.finish()
+				return
+			}
+		}
+	}
+}
+
+// reachedEnd returns true if every partition was fetched up to the end of its range and its last message before the end is done.
+func (this *Backfill) reachedEnd() bool {
+	for topicPartition := range this.ranges {
+		last, reachedEnd := this.client.progress(topicPartition)
+		if !reachedEnd {
+			return false
+		}
+		if !isOffsetInvalid(last) && !this.processed(topicPartition, last) {
+			return false
+		}
+	}
+	return true
+}
+
+// processed returns true if the worker manager of a given partition is done with the batch containing a given offset.
+func (this *Backfill) processed(topicPartition TopicAndPartition, offset int64) bool {
+	var state *BatchState
+	inLock(&this.consumer.workerManagersLock, func() {
+		if workerManager, exists := this.consumer.workerManagers[topicPartition]; exists {
+			state = workerManager.BatchState()
+		}
+	})
+	if state == nil || state.Outstanding > 0 {
+		return false
+	}
+	for _, task := range state.Tasks {
+		if task.Offset == offset {
+			return true
+		}
+	}
+	return false
+}
+
+// backfillClient decorates a LowLevelClient to drop messages at or past the end of the offset range of their partition
+// and to track how far every partition has been fetched.
+type backfillClient struct {
+	client    LowLevelClient
+	fetchWait time.Duration
+
+	lock      sync.Mutex
+	ranges    map[TopicAndPartition]OffsetRange
+	last      map[TopicAndPartition]int64
+	endsFound map[TopicAndPartition]bool
+}
+
+func newBackfillClient(client LowLevelClient, fetchWait time.Duration) *backfillClient {
+	return &backfillClient{
+		client:    client,
+		fetchWait: fetchWait,
+		ranges:    make(map[TopicAndPartition]OffsetRange),
+		last:      make(map[TopicAndPartition]int64),
+		endsFound: make(map[TopicAndPartition]bool),
+	}
+}
+
+// Returns a string representation of this backfillClient.
+func (this *backfillClient) String() string {
+	return fmt.Sprintf("Backfilling %s", this.client)
+}
+
+// Initializes the underlying client.
+func (this *backfillClient) Initialize() error {
+	return this.client.Initialize()
+}
+
+// Fetches messages before the end of the range of a given partition using the underlying client.
+func (this *backfillClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	topicPartition := TopicAndPartition{topic, partition}
+	var offsetRange OffsetRange
+	var bounded bool
+	inLock(&this.lock, func() { offsetRange, bounded = this.ranges[topicPartition] })
+	if !bounded {
+		return this.client.Fetch(topic, partition, offset)
+	}
+
+	if offset >= offsetRange.End {
+		inLock(&this.lock, func() { this.endsFound[topicPartition] = true })
+		// nothing is left to fetch, so wait like a fetch request waiting for new messages would
+		time.Sleep(this.fetchWait)
+		return make([]*Message, 0), nil
+	}
+
+	messages, err := this.client.Fetch(topic, partition, offset)
+	if err == nil && len(messages) == 0 && this.logEndReached(topic, partition, offsetRange.End) {
+		// offsets left before the end hold no messages, e.g. because they were compacted or are transaction markers
+		inLock(&this.lock, func() { this.endsFound[topicPartition] = true })
+		return messages, nil
+	}
+	endFound := false
+	for i, message := range messages {
+		if message.Offset >= offsetRange.End {
+			messages = messages[:i]
+			endFound = true
+			break
+		}
+	}
+	inLock(&this.lock, func() {
+		if len(messages) > 0 {
+			this.last[topicPartition] = messages[len(messages)-1].Offset
+			endFound = endFound || this.last[topicPartition] == offsetRange.End-1
+		}
+		if endFound {
+			this.endsFound[topicPartition] = true
+		}
+	})
+	return messages, err
+}
+
+// logEndReached returns true if the log of a given partition ends at or past a given end offset, so that nothing was fetched
+// before the end because there is nothing left to consume, rather than because the messages were not produced yet.
+func (this *backfillClient) logEndReached(topic string, partition int32, end int64) bool {
+	logEnd, err := this.client.GetAvailableOffset(topic, partition, LargestOffset)
+	if err != nil {
+		Warnw(this, "Failed to get log end offset", Fields{"topic": topic, "partition": partition, "error": err})
+		return false
+	}
+	return logEnd >= end
+}
+
+// Checks whether the given error indicates an OffsetOutOfRange error using the underlying client.
+func (this *backfillClient) IsOffsetOutOfRange(err error) bool {
+	return this.client.IsOffsetOutOfRange(err)
+}
+
+// Gets the available offset using the underlying client.
+func (this *backfillClient) GetAvailableOffset(topic string, partition int32, offsetTime string) (int64, error) {
+	return this.client.GetAvailableOffset(topic, partition, offsetTime)
+}
+
+// Closes the underlying client.
+func (this *backfillClient) Close() {
+	this.client.Close()
+}
+
+func (this *backfillClient) setRanges(ranges map[TopicAndPartition]OffsetRange) {
+	inLock(&this.lock, func() {
+		for topicPartition, offsetRange := range ranges {
+			this.ranges[topicPartition] = offsetRange
+		}
+	})
+}
+
+// progress returns the offset of the last message fetched from a given partition, or InvalidOffset if none,
+// and whether the partition has been fetched up to the end of its range.
+func (this *backfillClient) progress(topicPartition TopicAndPartition) (last int64, reachedEnd bool) {
+	inLock(&this.lock, func() {
+		var exists bool
+		if last, exists = this.last[topicPartition]; !exists {
+			last = InvalidOffset
+		}
+		reachedEnd = this.endsFound[topicPartition]
+	})
+	return
+}
@@ -0,0 +1,169 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	kafka "github.com/mistsys/go_kafka_client"
+)
+
+var zkConnect = flag.String("zookeeper", "", "Zookeeper connection string host:port[,host:port...].")
+var zkRoot = flag.String("zookeeper.root", "", "Kafka root path in Zookeeper.")
+var kafkaVersion = flag.String("kafka.version", kafka.DefaultKafkaVersion, "Kafka protocol version, or 'auto' to negotiate it with brokers.")
+var group = flag.String("group", "backfill", "Consumer group to derive the group offsets are committed for from.")
+var offsetsFile = flag.String("offsets.file", "", "Path to a file to store offsets in. Offsets are committed to Kafka if empty.")
+var topic = flag.String("topic", "", "Topic to backfill.")
+var partitions = flag.String("partitions", "", "Comma separated list of partitions to backfill. All partitions are backfilled if empty.")
+var startOffset = flag.Int64("start.offset", 0, "First offset to consume in every partition.")
+var endOffset = flag.Int64("end.offset", -1, "Offset to stop at in every partition, which is not consumed. Negative for the latest offset.")
+var startTime = flag.String("start.time", "", "Consume messages with timestamps from this RFC 3339 time. Takes precedence over offsets.")
+var endTime = flag.String("end.time", "", "Consume messages with timestamps before this RFC 3339 time. The latest offset if empty.")
+var numWorkers = flag.Int("num.workers", 1, "Number of workers per partition. Messages of a partition are printed in order only with a single worker.")
+
+func main() {
+	flag.Parse()
+	if *zkConnect == "" || *topic == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	zkConfig := kafka.NewZookeeperConfig()
+	zkConfig.ZookeeperConnect = strings.Split(*zkConnect, ",")
+	zkConfig.Root = *zkRoot
+
+	partitionList, err := resolvePartitions(zkConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve partitions of %s: %s\n", *topic, err)
+		os.Exit(1)
+	}
+
+	config := kafka.DefaultConsumerConfig()
+	config.Groupid = *group
+	config.Coordinator = kafka.NewZookeeperCoordinator(zkConfig)
+	config.KafkaVersion = *kafkaVersion
+	client := kafka.NewSaramaClient(config)
+	config.LowLevelClient = client
+	config.OffsetStorage = client
+	if *offsetsFile != "" {
+		storage, err := kafka.NewFileOffsetStorage(*offsetsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open offsets file: %s\n", err)
+			os.Exit(1)
+		}
+		config.OffsetStorage = storage
+	}
+	config.NumWorkers = *numWorkers
+	config.DeploymentTimeout = 0
+	config.Strategy = printStrategy()
+	config.WorkerFailureCallback = func(_ *kafka.WorkerManager) kafka.FailedDecision {
+		return kafka.DoNotCommitOffsetAndStop
+	}
+	config.WorkerFailedAttemptCallback = func(_ *kafka.Task, _ kafka.WorkerResult) kafka.FailedDecision {
+		return kafka.DoNotCommitOffsetAndStop
+	}
+
+	var backfill *kafka.Backfill
+	if *startTime != "" {
+		start, err := time.Parse(time.RFC3339, *startTime)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid start time: %s\n", err)
+			os.Exit(1)
+		}
+		var end time.Time
+		if *endTime != "" {
+			if end, err = time.Parse(time.RFC3339, *endTime); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid end time: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		backfill = kafka.NewTimeBackfill(config, map[string][]int32{*topic: partitionList}, start, end)
+	} else {
+		ranges := make(map[int32]kafka.OffsetRange)
+		for _, partition := range partitionList {
+			ranges[partition] = kafka.OffsetRange{Start: *startOffset, End: *endOffset}
+		}
+		backfill = kafka.NewBackfill(config, map[string]map[int32]kafka.OffsetRange{*topic: ranges})
+	}
+
+	ctrlc := make(chan os.Signal, 1)
+	signal.Notify(ctrlc, os.Interrupt)
+	go func() {
+		<-ctrlc
+		fmt.Fprintln(os.Stderr, "Shutdown triggered, closing backfill")
+		<-backfill.Close()
+	}()
+
+	go backfill.Start()
+	<-backfill.Done()
+	output.Flush()
+
+	if !backfill.Completed() {
+		fmt.Fprintln(os.Stderr, "Backfill stopped before reaching the end of all partitions")
+		os.Exit(1)
+	}
+	for partition, offsetRange := range backfill.Ranges()[*topic] {
+		fmt.Fprintf(os.Stderr, "Backfilled %s partition %d %s\n", *topic, partition, offsetRange)
+	}
+	fmt.Fprintf(os.Stderr, "Committed offsets for group %s\n", backfill.Groupid())
+}
+
+func resolvePartitions(zkConfig *kafka.ZookeeperConfig) ([]int32, error) {
+	if *partitions != "" {
+		partitionList := make([]int32, 0)
+		for _, raw := range strings.Split(*partitions, ",") {
+			partition, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			partitionList = append(partitionList, int32(partition))
+		}
+		return partitionList, nil
+	}
+
+	zk := kafka.NewZookeeperCoordinator(zkConfig)
+	if err := zk.Connect(); err != nil {
+		return nil, err
+	}
+	defer zk.Disconnect()
+	topicPartitions, err := zk.GetPartitionsForTopics([]string{*topic})
+	if err != nil {
+		return nil, err
+	}
+	return topicPartitions[*topic], nil
+}
+
+var output = bufio.NewWriter(os.Stdout)
+var outputLock sync.Mutex
+
+// printStrategy writes the value of every message to stdout, one message per line.
+func printStrategy() kafka.WorkerStrategy {
+	return func(_ *kafka.Worker, msg *kafka.Message, id kafka.TaskId) kafka.WorkerResult {
+		outputLock.Lock()
+		defer outputLock.Unlock()
+		output.Write(msg.Value)
+		output.WriteByte('\n')
+		return kafka.NewSuccessfulResult(id)
+	}
+}
@@ -0,0 +1,145 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackfill(t *testing.T) {
+	testBackfill(t, OffsetRange{Start: 5, End: 15}, 5, 15)
+	testBackfill(t, OffsetRange{Start: 25, End: -1}, 25, 30)
+	testBackfill(t, OffsetRange{Start: 0, End: 3}, 0, 3)
+}
+
+func testBackfill(t *testing.T, offsetRange OffsetRange, expectedStart int64, expectedEnd int64) {
+	topic := "test-backfill"
+	topics := map[string][]int32{topic: []int32{0}}
+	var lock sync.Mutex
+	consumed := make([]int64, 0)
+
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 30), topics)
+	config.AutoOffsetReset = LargestOffset
+	config.FetchBatchTimeout = 100 * time.Millisecond
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		inLock(&lock, func() { consumed = append(consumed, msg.Offset) })
+		return NewSuccessfulResult(id)
+	}
+
+	backfill := NewBackfill(config, map[string]map[int32]OffsetRange{topic: map[int32]OffsetRange{0: offsetRange}})
+	go backfill.Start()
+
+	select {
+	case <-backfill.Done():
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Backfill of %s did not complete within %s", offsetRange, consumeTimeout)
+	}
+
+	assert(t, backfill.Completed(), true)
+	assert(t, backfill.Ranges()[topic][0], OffsetRange{Start: offsetRange.Start, End: expectedEnd})
+	expected := make([]int64, 0)
+	for offset := expectedStart; offset < expectedEnd; offset++ {
+		expected = append(expected, offset)
+	}
+	inLock(&lock, func() {
+		sort.Slice(consumed, func(i, j int) bool { return consumed[i] < consumed[j] })
+		assert(t, consumed, expected)
+	})
+	committed, _ := config.OffsetStorage.GetOffset(backfill.Groupid(), topic, 0)
+	assert(t, committed, expectedEnd-1)
+	// the group of the given config keeps its offsets
+	committed, _ = config.OffsetStorage.GetOffset(config.Groupid, topic, 0)
+	assert(t, committed, InvalidOffset)
+}
+
+func TestBackfillWithGapBeforeEnd(t *testing.T) {
+	topic := "test-backfill-gap"
+	topics := map[string][]int32{topic: []int32{0}}
+	var lock sync.Mutex
+	consumed := make([]int64, 0)
+
+	// offsets 12, 28 and 29 were compacted, so no message at or past the end of the range is ever fetched
+	client := newCompactedClient(newStaticClient(topic, 0, 30), 12, 28, 29)
+	config := inMemoryConsumerConfig(client, topics)
+	config.FetchBatchTimeout = 100 * time.Millisecond
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		inLock(&lock, func() { consumed = append(consumed, msg.Offset) })
+		return NewSuccessfulResult(id)
+	}
+
+	backfill := NewBackfill(config, map[string]map[int32]OffsetRange{topic: map[int32]OffsetRange{0: OffsetRange{Start: 10, End: -1}}})
+	go backfill.Start()
+
+	select {
+	case <-backfill.Done():
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Backfill with a gap before the end did not complete within %s", consumeTimeout)
+	}
+
+	assert(t, backfill.Completed(), true)
+	assert(t, backfill.Ranges()[topic][0], OffsetRange{Start: 10, End: 30})
+	expected := []int64{10, 11}
+	for offset := int64(13); offset < 28; offset++ {
+		expected = append(expected, offset)
+	}
+	inLock(&lock, func() {
+		sort.Slice(consumed, func(i, j int) bool { return consumed[i] < consumed[j] })
+		assert(t, consumed, expected)
+	})
+}
+
+// compactedClient is a staticClient missing some offsets, while its log end offset stays the same.
+type compactedClient struct {
+	*staticClient
+	logEnd int64
+}
+
+func newCompactedClient(client *staticClient, removed ...int64) *compactedClient {
+	logEnd := int64(len(client.messages))
+	messages := make([]*Message, 0)
+	for _, message := range client.messages {
+		kept := true
+		for _, offset := range removed {
+			kept = kept && message.Offset != offset
+		}
+		if kept {
+			messages = append(messages, message)
+		}
+	}
+	return &compactedClient{&staticClient{messages}, logEnd}
+}
+
+func (this *compactedClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	if offset > this.logEnd {
+		return nil, errTestOffsetOutOfRange
+	}
+	for i, message := range this.messages {
+		if message.Offset >= offset {
+			return this.messages[i:], nil
+		}
+	}
+	return make([]*Message, 0), nil
+}
+
+func (this *compactedClient) GetAvailableOffset(topic string, partition int32, offsetTime string) (int64, error) {
+	if offsetTime == SmallestOffset {
+		return 0, nil
+	}
+	return this.logEnd, nil
+}
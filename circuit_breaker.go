@@ -0,0 +1,205 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"sync"
+)
+
+// CircuitState is the state of the circuit breaker of a partition.
+type CircuitState int32
+
+const (
+	// Messages are processed as usual.
+	CircuitClosed CircuitState = iota
+
+	// The partition is paused after CircuitBreakerThreshold consecutive tasks failed. Failed tasks are held without committing their offsets.
+	CircuitOpen
+
+	// The first held task is retried as a probe after CircuitBreakerCooldown. The circuit closes if it succeeds and opens again otherwise.
+	CircuitHalfOpen
+)
+
+func (this CircuitState) String() string {
+	switch this {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// A callback that is triggered when the circuit breaker of a WorkerManager changes its state.
+type CircuitBreakerCallback func(*WorkerManager, CircuitState)
+
+// circuitBreaker pauses a WorkerManager after a number of consecutive tasks failed after all retries.
+// Failed tasks are held instead of being passed to WorkerFailedAttemptCallback, and retried once the circuit closes again.
+// Offsets are not committed past a held task until it is done. State transitions happen on the WorkerManager's processing goroutine,
+// the state may be read from any goroutine.
+type circuitBreaker struct {
+	threshold int
+
+	lock       sync.Mutex
+	state      CircuitState
+	failures   int
+	held       []*Task
+	probe      *Task
+	closed     chan struct{}
+	unresolved map[*Task]bool
+	released   bool
+}
+
+func newCircuitBreaker(threshold int) *circuitBreaker {
+	closed := make(chan struct{})
+	close(closed)
+	return &circuitBreaker{
+		threshold:  threshold,
+		closed:     closed,
+		unresolved: make(map[*Task]bool),
+	}
+}
+
+// Returns the current state of this circuit breaker.
+func (this *circuitBreaker) State() CircuitState {
+	var state CircuitState
+	inLock(&this.lock, func() { state = this.state })
+	return state
+}
+
+// waitClosed waits until this circuit breaker is closed or a given stop channel is closed.
+func (this *circuitBreaker) waitClosed(stop <-chan struct{}) {
+	var closed chan struct{}
+	inLock(&this.lock, func() { closed = this.closed })
+	select {
+	case <-closed:
+	case <-stop:
+	}
+}
+
+// succeeded records a successful task. If the task was a probe, the circuit closes and the other held tasks are returned to be retried.
+func (this *circuitBreaker) succeeded(task *Task) (closed bool, retry []*Task) {
+	inLock(&this.lock, func() {
+		this.failures = 0
+		if this.state != CircuitHalfOpen || task != this.probe {
+			return
+		}
+		for _, held := range this.held {
+			if held != task {
+				retry = append(retry, held)
+			}
+		}
+		this.state = CircuitClosed
+		this.held = nil
+		this.probe = nil
+		close(this.closed)
+		closed = true
+	})
+	return
+}
+
+// failed records a task that failed after all retries. Returns whether the task is held by this circuit breaker
+// and whether the circuit has just opened, either by hitting the threshold or by a failed probe. Nothing is held once the held tasks are released.
+func (this *circuitBreaker) failed(task *Task) (held bool, opened bool) {
+	inLock(&this.lock, func() {
+		if this.released {
+			return
+		}
+		this.failures++
+		switch this.state {
+		case CircuitClosed:
+			if this.failures < this.threshold {
+				return
+			}
+			this.closed = make(chan struct{})
+			this.state, opened = CircuitOpen, true
+		case CircuitHalfOpen:
+			if task == this.probe {
+				// the probe stays first in line for the next probe
+				this.state, opened = CircuitOpen, true
+				this.probe = nil
+				held = true
+				return
+			}
+		}
+		this.held = append(this.held, task)
+		this.unresolved[task] = true
+		held = true
+	})
+	return
+}
+
+// halfOpen moves an open circuit to half-open and returns the held task to retry as a probe.
+func (this *circuitBreaker) halfOpen() *Task {
+	var probe *Task
+	inLock(&this.lock, func() {
+		if this.state != CircuitOpen || len(this.held) == 0 {
+			return
+		}
+		this.state = CircuitHalfOpen
+		this.probe = this.held[0]
+		probe = this.probe
+	})
+	return probe
+}
+
+// resolved records that a given task is done, so offsets may be committed past it.
+func (this *circuitBreaker) resolved(task *Task) {
+	inLock(&this.lock, func() {
+		if !this.released {
+			delete(this.unresolved, task)
+		}
+	})
+}
+
+// release closes the circuit for good when the WorkerManager stops and returns the held tasks, which are given up without committing their offsets.
+func (this *circuitBreaker) release() []*Task {
+	var held []*Task
+	inLock(&this.lock, func() {
+		this.released = true
+		if this.state == CircuitClosed {
+			return
+		}
+		held = this.held
+		this.state = CircuitClosed
+		this.held = nil
+		this.probe = nil
+		close(this.closed)
+	})
+	return held
+}
+
+// isReleased returns true if the held tasks have been given up.
+func (this *circuitBreaker) isReleased() bool {
+	var released bool
+	inLock(&this.lock, func() { released = this.released })
+	return released
+}
+
+// commitLimit returns the largest offset that may be committed, right before the lowest offset of a held or retried task that is not done yet,
+// and whether there is such a task at all. The limit is below 0 if the task is at offset 0, in which case nothing may be committed.
+func (this *circuitBreaker) commitLimit() (limit int64, unresolved bool) {
+	inLock(&this.lock, func() {
+		for task := range this.unresolved {
+			if !unresolved || task.Msg.Offset-1 < limit {
+				limit = task.Msg.Offset - 1
+			}
+			unresolved = true
+		}
+	})
+	return
+}
@@ -0,0 +1,220 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker(2)
+	tasks := make([]*Task, 4)
+	for i := range tasks {
+		tasks[i] = &Task{Msg: &Message{Offset: int64(i + 10)}}
+	}
+
+	// failures below the threshold are not held
+	held, opened := breaker.failed(tasks[0])
+	assert(t, held, false)
+	assert(t, opened, false)
+	breaker.succeeded(tasks[0])
+	held, opened = breaker.failed(tasks[1])
+	assert(t, held, false)
+	assert(t, opened, false)
+
+	held, opened = breaker.failed(tasks[2])
+	assert(t, held, true)
+	assert(t, opened, true)
+	assert(t, breaker.State(), CircuitOpen)
+	limit, limited := breaker.commitLimit()
+	assert(t, limited, true)
+	assert(t, limit, int64(11))
+
+	// a failed probe opens the circuit again
+	assert(t, breaker.halfOpen(), tasks[2])
+	assert(t, breaker.State(), CircuitHalfOpen)
+	held, opened = breaker.failed(tasks[2])
+	assert(t, held, true)
+	assert(t, opened, true)
+	assert(t, breaker.State(), CircuitOpen)
+
+	// a successful probe closes the circuit and returns the other held tasks for retry
+	held, opened = breaker.failed(tasks[3])
+	assert(t, held, true)
+	assert(t, opened, false)
+	assert(t, breaker.halfOpen(), tasks[2])
+	closed, retry := breaker.succeeded(tasks[2])
+	assert(t, closed, true)
+	assert(t, retry, []*Task{tasks[3]})
+	assert(t, breaker.State(), CircuitClosed)
+
+	// offsets are not committed past retried tasks until they are done
+	breaker.resolved(tasks[2])
+	limit, _ = breaker.commitLimit()
+	assert(t, limit, int64(12))
+	breaker.resolved(tasks[3])
+	_, limited = breaker.commitLimit()
+	assert(t, limited, false)
+
+	// released tasks stay unresolved and nothing is held afterwards
+	breaker.failed(tasks[0])
+	breaker.failed(tasks[1])
+	assert(t, breaker.release(), []*Task{tasks[1]})
+	breaker.resolved(tasks[1])
+	limit, _ = breaker.commitLimit()
+	assert(t, limit, int64(10))
+	held, _ = breaker.failed(tasks[2])
+	assert(t, held, false)
+
+	// a task held at offset 0 limits commits to nothing
+	breaker = newCircuitBreaker(1)
+	first := &Task{Msg: &Message{Offset: 0}}
+	held, opened = breaker.failed(first)
+	assert(t, held, true)
+	assert(t, opened, true)
+	limit, limited = breaker.commitLimit()
+	assert(t, limited, true)
+	assert(t, limit, int64(-1))
+}
+
+func TestCircuitBreakerDoesNotCommitPastHeldFirstMessage(t *testing.T) {
+	wmid := "test-circuit-breaker-first-WM"
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 1
+	config.MaxWorkerRetries = 0
+	config.CircuitBreakerThreshold = 1
+	config.CircuitBreakerCooldown = time.Minute
+	config.OffsetCommitInterval = 50 * time.Millisecond
+	config.Strategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult {
+		if id.Offset == 0 {
+			return NewProcessingFailedResult(id)
+		}
+		return NewSuccessfulResult(id)
+	}
+	storage := newInMemoryBatchOffsetStorage()
+	config.OffsetStorage = storage
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, make(chan bool))
+	go manager.Start()
+
+	manager.inputChannel <- []*Message{&Message{Offset: 0}, &Message{Offset: 1}, &Message{Offset: 2}}
+	// offsets are committed a few times while the first message is held
+	time.Sleep(200 * time.Millisecond)
+	assert(t, manager.breaker.State(), CircuitOpen)
+
+	offset, _ := storage.GetOffset(config.Groupid, topicPartition.Topic, topicPartition.Partition)
+	assert(t, offset, InvalidOffset)
+
+	select {
+	case <-manager.Stop():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Worker manager with an open circuit failed to stop")
+	}
+	offset, _ = storage.GetOffset(config.Groupid, topicPartition.Topic, topicPartition.Partition)
+	assert(t, offset, InvalidOffset)
+}
+
+func TestCircuitBreakerWorkerManager(t *testing.T) {
+	wmid := "test-circuit-breaker-WM"
+	var failing int32 = 1
+	var attempts int32
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 1
+	config.MaxWorkerRetries = 0
+	config.CircuitBreakerThreshold = 2
+	config.CircuitBreakerCooldown = 200 * time.Millisecond
+	config.Strategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult {
+		atomic.AddInt32(&attempts, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			return NewProcessingFailedResult(id)
+		}
+		return NewSuccessfulResult(id)
+	}
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision {
+		return DoNotCommitOffsetAndContinue
+	}
+	var statesLock sync.Mutex
+	states := make([]CircuitState, 0)
+	config.CircuitBreakerCallback = func(_ *WorkerManager, state CircuitState) {
+		inLock(&statesLock, func() { states = append(states, state) })
+	}
+	storage := newInMemoryBatchOffsetStorage()
+	config.OffsetStorage = storage
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, make(chan bool))
+	go manager.Start()
+
+	manager.inputChannel <- []*Message{&Message{Offset: 0}, &Message{Offset: 1}, &Message{Offset: 2}, &Message{Offset: 3}}
+
+	// the first probe fails, the second one succeeds after recovery
+	time.Sleep(300 * time.Millisecond)
+	assert(t, atomic.LoadInt32(&attempts), int32(3))
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(500 * time.Millisecond)
+
+	assert(t, atomic.LoadInt32(&attempts), int32(6))
+	inLock(&statesLock, func() {
+		assert(t, states, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed})
+	})
+	assert(t, manager.partitionMetrics.circuitOpens().Count(), int64(2))
+	assert(t, manager.partitionMetrics.circuitState().Value(), int64(CircuitClosed))
+	<-manager.Stop()
+
+	assert(t, storage.offsets[topicPartition].Offset, int64(3))
+}
+
+func TestCircuitBreakerGivesUpHeldMessagesOnStop(t *testing.T) {
+	wmid := "test-circuit-breaker-stop-WM"
+	config := DefaultConsumerConfig()
+	config.NumWorkers = 1
+	config.MaxWorkerRetries = 0
+	config.CircuitBreakerThreshold = 1
+	config.CircuitBreakerCooldown = time.Minute
+	config.Strategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult {
+		if id.Offset == 1 {
+			return NewProcessingFailedResult(id)
+		}
+		return NewSuccessfulResult(id)
+	}
+	storage := newInMemoryBatchOffsetStorage()
+	config.OffsetStorage = storage
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, make(chan bool))
+	go manager.Start()
+
+	manager.inputChannel <- []*Message{&Message{Offset: 0}, &Message{Offset: 1}, &Message{Offset: 2}}
+	time.Sleep(200 * time.Millisecond)
+	assert(t, manager.breaker.State(), CircuitOpen)
+
+	select {
+	case <-manager.Stop():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Worker manager with an open circuit failed to stop")
+	}
+
+	assert(t, storage.offsets[topicPartition].Offset, int64(0))
+}
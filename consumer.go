@@ -24,12 +24,18 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 const (
 	// Offset with invalid value
 	InvalidOffset int64 = -1
 
+	// Last processed offset of a partition that has to be consumed from offset 0, e.g. because offset 0 was committed
+	// as the next offset to consume by another Kafka client. Unlike InvalidOffset, AutoOffsetReset does not apply to it.
+	BeforeFirstOffset int64 = -2
+
 	// Reset the offset to the smallest offset if it is out of range
 	SmallestOffset = "smallest"
 	// Reset the offset to the largest offset if it is out of range
@@ -48,6 +54,7 @@ type Consumer struct {
 	isShuttingdown                 bool
 	topicPartitionsAndBuffers      map[TopicAndPartition]*messageBuffer
 	topicRegistry                  map[string]map[int32]*partitionTopicInfo
+	topicRegistryLock              sync.RWMutex
 	connectChannels                chan bool
 	disconnectChannelsForPartition chan TopicAndPartition
 	workerManagers                 map[TopicAndPartition]*WorkerManager
@@ -61,6 +68,12 @@ type Consumer struct {
 	metrics *ConsumerMetrics
 
 	lastSuccessfulRebalanceHash string
+	created                     time.Time
+
+	// Rebalance state reported by Readiness, see rebalanceStarted and rebalanceFinished.
+	rebalanceStateLock sync.RWMutex
+	rebalancingSince   time.Time
+	partitionsAssigned bool
 }
 
 /* NewConsumer creates a new Consumer with a given configuration. Creating a Consumer does not start fetching immediately. */
@@ -69,7 +82,7 @@ func NewConsumer(config *ConsumerConfig) *Consumer {
 		panic(err)
 	}
 
-	Infof(config.Consumerid, "Creating new consumer with configuration: %s", config)
+	Infow(config.Consumerid, "Creating new consumer", Fields{"consumer": config.Consumerid, "group": config.Groupid, "config": config})
 	c := &Consumer{
 		config:                         config,
 		unsubscribe:                    make(chan bool),
@@ -81,6 +94,7 @@ func NewConsumer(config *ConsumerConfig) *Consumer {
 		workerManagers:                 make(map[TopicAndPartition]*WorkerManager),
 		stopStreams:                    make(chan bool),
 		close:                          make(chan bool),
+		created:                        time.Now(),
 	}
 
 	if err := c.config.Coordinator.Connect(); err != nil {
@@ -89,7 +103,11 @@ func NewConsumer(config *ConsumerConfig) *Consumer {
 	if err := c.config.LowLevelClient.Initialize(); err != nil {
 		panic(err)
 	}
-	c.metrics = newConsumerMetrics(c.String(), config.MetricsPrefix)
+	registry := config.MetricsRegistry
+	if registry == nil {
+		registry = metrics.NewRegistry()
+	}
+	c.metrics = newConsumerMetrics(c.String(), config.MetricsPrefix, registry)
 	c.fetcher = newConsumerFetcherManager(c.config, c.disconnectChannelsForPartition, c.metrics)
 
 	go func() {
@@ -106,6 +124,11 @@ func (c *Consumer) String() string {
 	return c.config.Consumerid
 }
 
+// Returns the consumer id and group of this consumer as log fields.
+func (c *Consumer) LogFields() Fields {
+	return Fields{"consumer": c.config.Consumerid, "group": c.config.Groupid}
+}
+
 /* Starts consuming specified topics using a configured amount of goroutines for each topic. */
 func (c *Consumer) StartStatic(topicCountMap map[string]int) {
 	go c.createMessageStreams(topicCountMap)
@@ -121,6 +144,21 @@ func (c *Consumer) StartWildcard(topicFilter TopicFilter, numStreams int) {
 
 /* Starts consuming given topic-partitions using ConsumerConfig.NumConsumerFetchers goroutines for each topic. */
 func (c *Consumer) StartStaticPartitions(topicPartitionMap map[string][]int32) {
+	c.startStaticPartitions(topicPartitionMap, nil)
+}
+
+/* Starts consuming given topic-partitions from given offsets instead of the offsets in OffsetStorage. Offsets are keyed by topic and partition and point to the first message to consume. */
+func (c *Consumer) StartStaticPartitionsFrom(topicPartitionOffsets map[string]map[int32]int64) {
+	topicPartitionMap := make(map[string][]int32)
+	for topic, partitions := range topicPartitionOffsets {
+		for partition := range partitions {
+			topicPartitionMap[topic] = append(topicPartitionMap[topic], partition)
+		}
+	}
+	c.startStaticPartitions(topicPartitionMap, topicPartitionOffsets)
+}
+
+func (c *Consumer) startStaticPartitions(topicPartitionMap map[string][]int32, startOffsets map[string]map[int32]int64) {
 	topicsToNumStreamsMap := make(map[string]int)
 	for topic := range topicPartitionMap {
 		topicsToNumStreamsMap[topic] = c.config.NumConsumerFetchers
@@ -151,25 +189,36 @@ func (c *Consumer) StartStaticPartitions(topicPartitionMap map[string][]int32) {
 		topicPartitions = append(topicPartitions, &TopicAndPartition{topicPartition.Topic, topicPartition.Partition})
 	}
 
-	offsets, err := c.fetchOffsets(topicPartitions)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to fetch offsets during rebalance: %s", err))
+	offsets := make(map[TopicAndPartition]int64)
+	if startOffsets == nil {
+		offsets, err = c.fetchOffsets(topicPartitions)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to fetch offsets during rebalance: %s", err))
+		}
+	} else {
+		for _, topicPartition := range topicPartitions {
+			// stored offsets point to the last consumed message
+			offsets[*topicPartition] = startOffsets[topicPartition.Topic][topicPartition.Partition] - 1
+		}
 	}
 	for _, topicPartition := range topicPartitions {
 		offset := offsets[*topicPartition]
 		threadId := partitionOwnershipDecision[*topicPartition]
-		c.addPartitionTopicInfo(c.topicRegistry, topicPartition, offset, threadId)
+		inWriteLock(&c.topicRegistryLock, func() {
+			c.addPartitionTopicInfo(c.topicRegistry, topicPartition, offset, threadId)
+		})
 	}
 
 	if c.reflectPartitionOwnershipDecision(partitionOwnershipDecision) {
 		c.updateFetcher(c.config.NumConsumerFetchers)
 		c.initializeWorkerManagers()
+		c.rebalanceFinished(true)
 	} else {
 		panic("Could not reflect partition ownership")
 	}
 
 	go func() {
-		Infof(c, "Restarted streams")
+		Info(c, "Restarted streams")
 		c.connectChannels <- true
 	}()
 
@@ -189,18 +238,18 @@ func (c *Consumer) startStreams() {
 			}
 		case tp := <-c.disconnectChannelsForPartition:
 			{
-				Tracef(c, "Disconnecting %s", tp)
+				Tracew(c, "Disconnecting", Fields{"topic": tp.Topic, "partition": tp.Partition})
 				stopRedirects[tp] <- true
 				delete(stopRedirects, tp)
 
-				Debugf(c, "Stopping worker manager for %s", tp)
+				Debugw(c, "Stopping worker manager", Fields{"topic": tp.Topic, "partition": tp.Partition})
 				select {
 				case <-c.workerManagers[tp].Stop():
 				case <-time.After(5 * time.Second):
 				}
 				delete(c.workerManagers, tp)
 
-				Debugf(c, "Stopping buffer: %s", c.topicPartitionsAndBuffers[tp])
+				Debugw(c, "Stopping buffer", Fields{"topic": tp.Topic, "partition": tp.Partition})
 				c.topicPartitionsAndBuffers[tp].stop()
 				delete(c.topicPartitionsAndBuffers, tp)
 			}
@@ -225,7 +274,7 @@ func (c *Consumer) maintainCleanCoordinator() {
 		for {
 			select {
 			case <-tick.C:
-				Infof(c, "Starting coordinator cleanup of API reqeusts for %s", c.config.Groupid)
+				Info(c, "Starting coordinator cleanup of API requests")
 				c.config.Coordinator.RemoveOldApiRequests(c.config.Groupid)
 			case <-c.stopCleanup:
 				return
@@ -236,17 +285,17 @@ func (c *Consumer) maintainCleanCoordinator() {
 
 func (c *Consumer) pipeChannels(stopRedirects map[TopicAndPartition]chan bool) {
 	inLock(&c.workerManagersLock, func() {
-		Debugf(c, "connect channels registry: %v", c.topicRegistry)
+		Debugw(c, "Connecting channels", Fields{"registry": c.topicRegistry})
 		for topic, partitions := range c.topicRegistry {
 			for partition, info := range partitions {
 				topicPartition := TopicAndPartition{topic, partition}
 				if _, exists := stopRedirects[topicPartition]; !exists {
 					to, exists := c.workerManagers[topicPartition]
 					if !exists {
-						Infof(c, "WM > Failed to pipe message buffer to workermanager on partition %s", topicPartition)
+						Infow(c, "WM > Failed to pipe message buffer to workermanager", Fields{"topic": topicPartition.Topic, "partition": topicPartition.Partition})
 						continue
 					}
-					Debugf(c, "Piping %s", topicPartition)
+					Debugw(c, "Piping", Fields{"topic": topicPartition.Topic, "partition": topicPartition.Partition})
 					stopRedirects[topicPartition] = pipe(info.Buffer.OutputChannel, to.inputChannel)
 				}
 			}
@@ -256,7 +305,7 @@ func (c *Consumer) pipeChannels(stopRedirects map[TopicAndPartition]chan bool) {
 
 func (c *Consumer) disconnectChannels(stopRedirects map[TopicAndPartition]chan bool) {
 	for tp, stopRedirect := range stopRedirects {
-		Debugf(c, "Disconnecting channel for %s", tp)
+		Debugw(c, "Disconnecting channel", Fields{"topic": tp.Topic, "partition": tp.Partition})
 		stopRedirect <- true
 		delete(stopRedirects, tp)
 	}
@@ -303,14 +352,14 @@ func (c *Consumer) reinitializeConsumer() {
 func (c *Consumer) initializeWorkerManagers() {
 	inLock(&c.workerManagersLock, func() {
 		if Logger.IsAllowed(DebugLevel) {
-			Debugf(c, "Initializing worker managers from topic registry: %s", c.topicRegistry)
+			Debugw(c, "Initializing worker managers from topic registry", Fields{"registry": c.topicRegistry})
 		}
 		for topic, partitions := range c.topicRegistry {
 			for partition := range partitions {
 				topicPartition := TopicAndPartition{topic, partition}
 				workerManager, exists := c.workerManagers[topicPartition]
 				if !exists {
-					workerManager = NewWorkerManager(fmt.Sprintf("WM-%s-%d", topic, partition), c.config, topicPartition, c.metrics, c.close)
+					workerManager = NewWorkerManager(fmt.Sprintf("WM-%s-%d", topic, partition), c.config.ForTopic(topic), topicPartition, c.metrics, c.close)
 					c.workerManagers[topicPartition] = workerManager
 					go workerManager.Start()
 				}
@@ -374,7 +423,9 @@ func (c *Consumer) handleBlueGreenRequest(requestId string, blueGreenRequest *Bl
 	var context *assignmentContext
 	//Waiting for everybody in group to acknowledge the request, then closing
 	inLock(&c.rebalanceLock, func() {
-		Infof(c, "Starting blue-green procedure for: %s", blueGreenRequest)
+		c.rebalanceStarted()
+		defer func() { c.rebalanceFinished(c.lastSuccessfulRebalanceHash != "") }()
+		Infow(c, "Starting blue-green procedure", Fields{"request": blueGreenRequest})
 		var err error
 		var stateHash string
 		barrierPassed := false
@@ -382,7 +433,7 @@ func (c *Consumer) handleBlueGreenRequest(requestId string, blueGreenRequest *Bl
 			context, err = newAssignmentContext(c.config.Groupid, c.config.Consumerid,
 				c.config.ExcludeInternalTopics, c.config.Coordinator)
 			if err != nil {
-				Errorf(c, "Failed to initialize assignment context: %s", err)
+				Errorw(c, "Failed to initialize assignment context", Fields{"error": err})
 				panic(err)
 			}
 			barrierSize := len(context.Consumers)
@@ -472,7 +523,7 @@ func (c *Consumer) handleBlueGreenRequest(requestId string, blueGreenRequest *Bl
 
 		//Resume consuming
 		c.resumeAfterClose(newContext)
-		Infof(c, "Blue-green procedure has been successfully finished %s", blueGreenRequest)
+		Infow(c, "Blue-green procedure has been successfully finished", Fields{"request": blueGreenRequest})
 	})
 }
 
@@ -481,8 +532,9 @@ func (c *Consumer) resumeAfterClose(context *assignmentContext) {
 	c.workerManagers = make(map[TopicAndPartition]*WorkerManager)
 	c.topicPartitionsAndBuffers = make(map[TopicAndPartition]*messageBuffer)
 	c.config.LowLevelClient.Initialize()
+	// the metrics were closed along with the consumer, so the new fetcher manager reports to new ones
+	c.metrics = newConsumerMetrics(c.String(), c.config.MetricsPrefix, c.metrics.Registry())
 	c.fetcher = newConsumerFetcherManager(c.config, c.disconnectChannelsForPartition, c.metrics)
-	c.metrics = newConsumerMetrics(c.String(), c.config.MetricsPrefix)
 
 	go func() {
 		<-c.close
@@ -512,7 +564,7 @@ func (c *Consumer) resumeAfterClose(context *assignmentContext) {
 
 	c.config.Coordinator.RegisterConsumer(c.config.Consumerid, c.config.Groupid, context.MyTopicToNumStreams)
 	if c.reflectPartitionOwnershipDecision(partitionOwnershipDecision) {
-		c.topicRegistry = currentTopicRegistry
+		c.setTopicRegistry(currentTopicRegistry)
 		c.lastSuccessfulRebalanceHash = context.hash()
 		c.initFetchersAndWorkers(context)
 	} else {
@@ -531,7 +583,7 @@ func (c *Consumer) stopWorkerManagers() bool {
 			for _, wm := range c.workerManagers {
 				wmStopChannels = append(wmStopChannels, wm.Stop())
 			}
-			Debugf(c, "Worker channels length: %d", len(wmStopChannels))
+			Debugw(c, "Stopping worker managers", Fields{"workerManagers": len(wmStopChannels)})
 			notifyWhenThresholdIsReached(wmStopChannels, wmsAreStopped, len(wmStopChannels))
 			select {
 			case <-wmsAreStopped:
@@ -542,7 +594,7 @@ func (c *Consumer) stopWorkerManagers() bool {
 				}
 			case <-time.After(c.config.WorkerManagersStopTimeout):
 				{
-					Errorf(c, "Workers failed to stop whithin timeout of %s", c.config.WorkerManagersStopTimeout)
+					Errorw(c, "Workers failed to stop within timeout", Fields{"timeout": c.config.WorkerManagersStopTimeout})
 					success = false
 				}
 			}
@@ -557,11 +609,11 @@ func (c *Consumer) stopWorkerManagers() bool {
 
 func (c *Consumer) updateFetcher(numStreams int) {
 	if Logger.IsAllowed(InfoLevel) {
-		Infof(c, "Updating fetcher with numStreams = %d", numStreams)
+		Infow(c, "Updating fetcher", Fields{"numStreams": numStreams})
 	}
 	allPartitionInfos := make([]*partitionTopicInfo, 0)
 	if Logger.IsAllowed(DebugLevel) {
-		Debugf(c, "Topic Registry = %s", c.topicRegistry)
+		Debugw(c, "Topic registry", Fields{"registry": c.topicRegistry})
 	}
 	for _, partitionAndInfo := range c.topicRegistry {
 		for _, partitionInfo := range partitionAndInfo {
@@ -571,7 +623,7 @@ func (c *Consumer) updateFetcher(numStreams int) {
 
 	c.fetcher.startConnections(allPartitionInfos, numStreams)
 	if Logger.IsAllowed(InfoLevel) {
-		Infof(c, "Updated fetcher")
+		Info(c, "Updated fetcher")
 	}
 }
 
@@ -632,11 +684,13 @@ func (c *Consumer) unsubscribeFromChanges() {
 func (c *Consumer) rebalance() {
 	if !c.isShuttingdown {
 		inLock(&c.rebalanceLock, func() {
+			c.rebalanceStarted()
+			defer func() { c.rebalanceFinished(c.lastSuccessfulRebalanceHash != "") }()
 			success := false
 			var stateHash string
 			barrierTimeout := c.config.BarrierTimeout
 			if Logger.IsAllowed(InfoLevel) {
-				Infof(c, "rebalance triggered for %s\n", c.config.Consumerid)
+				Info(c, "Rebalance triggered")
 			}
 			for i := 0; i <= int(c.config.RebalanceMaxRetries) && !success; i++ {
 				partitionAssignor := newPartitionAssignor(c.config.PartitionAssignmentStrategy)
@@ -649,7 +703,7 @@ func (c *Consumer) rebalance() {
 						c.config.ExcludeInternalTopics, c.config.Coordinator)
 					if err != nil {
 						if Logger.IsAllowed(ErrorLevel) {
-							Errorf(c, "Failed to initialize assignment context: %s", err)
+							Errorw(c, "Failed to initialize assignment context", Fields{"error": err})
 						}
 						panic(err)
 					}
@@ -666,7 +720,7 @@ func (c *Consumer) rebalance() {
 					err = c.config.Coordinator.RemoveStateBarrier(c.config.Groupid, fmt.Sprintf("%s-ack", stateHash), string(Rebalance))
 					if err != nil {
 						if Logger.IsAllowed(WarnLevel) {
-							Warnf(c, "Failed to remove state barrier %s due to: %s", stateHash, err.Error())
+							Warnw(c, "Failed to remove state barrier", Fields{"barrier": stateHash, "error": err})
 						}
 					}
 					barrierPassed = c.config.Coordinator.AwaitOnStateBarrier(c.config.Consumerid, c.config.Groupid,
@@ -677,7 +731,7 @@ func (c *Consumer) rebalance() {
 						err = c.config.Coordinator.RemoveStateBarrier(c.config.Groupid, stateHash, string(Rebalance))
 						if err != nil {
 							if Logger.IsAllowed(WarnLevel) {
-								Warnf(c, "Failed to remove state barrier %s due to: %s", stateHash, err.Error())
+								Warnw(c, "Failed to remove state barrier", Fields{"barrier": stateHash, "error": err})
 							}
 						}
 					}
@@ -695,7 +749,7 @@ func (c *Consumer) rebalance() {
 				err = c.config.Coordinator.RemoveStateBarrier(c.config.Groupid, stateHash, string(Rebalance))
 				if err != nil {
 					if Logger.IsAllowed(WarnLevel) {
-						Warnf(c, "Failed to remove state barrier %s due to: %s", stateHash, err.Error())
+						Warnw(c, "Failed to remove state barrier", Fields{"barrier": stateHash, "error": err})
 					}
 				}
 				barrierTimeout += c.config.BarrierTimeout
@@ -711,7 +765,7 @@ func (c *Consumer) rebalance() {
 		})
 	} else {
 		if Logger.IsAllowed(InfoLevel) {
-			Infof(c, "Rebalance was triggered during consumer '%s' shutdown sequence. Ignoring...", c.config.Consumerid)
+			Info(c, "Rebalance was triggered during consumer shutdown sequence. Ignoring...")
 		}
 	}
 }
@@ -726,7 +780,7 @@ func tryRebalance(c *Consumer, context *assignmentContext, partitionAssignor ass
 	offsets, err := c.fetchOffsets(topicPartitions)
 	if err != nil {
 		if Logger.IsAllowed(ErrorLevel) {
-			Errorf(c, "Failed to fetch offsets during rebalance: %s", err)
+			Errorw(c, "Failed to fetch offsets during rebalance", Fields{"error": err})
 		}
 		return false
 	}
@@ -735,7 +789,7 @@ func tryRebalance(c *Consumer, context *assignmentContext, partitionAssignor ass
 
 	if c.isShuttingdown {
 		if Logger.IsAllowed(WarnLevel) {
-			Warnf(c, "Aborting consumer '%s' rebalancing, since shutdown sequence started.", c.config.Consumerid)
+			Warn(c, "Aborting consumer rebalancing, since shutdown sequence started.")
 		}
 		return true
 	} else {
@@ -765,17 +819,17 @@ func tryRebalance(c *Consumer, context *assignmentContext, partitionAssignor ass
 			return false
 		}
 
-		c.topicRegistry = currentTopicRegistry
+		c.setTopicRegistry(currentTopicRegistry)
 		if Logger.IsAllowed(InfoLevel) {
-			Infof(c, "Trying to reinitialize fetchers and workers")
+			Info(c, "Trying to reinitialize fetchers and workers")
 		}
 		c.initFetchersAndWorkers(context)
 		if Logger.IsAllowed(InfoLevel) {
-			Infof(c, "Fetchers and workers have been successfully reinitialized")
+			Info(c, "Fetchers and workers have been successfully reinitialized")
 		}
 	} else {
 		if Logger.IsAllowed(ErrorLevel) {
-			Errorf(c, "Failed to reflect partition ownership during rebalance")
+			Error(c, "Failed to reflect partition ownership during rebalance")
 		}
 		return false
 	}
@@ -794,7 +848,7 @@ func (c *Consumer) initFetchersAndWorkers(assignmentContext *assignmentContext)
 				break
 			}
 			if Logger.IsAllowed(InfoLevel) {
-				Infof(c, "Trying to update fetcher")
+				Info(c, "Trying to update fetcher")
 			}
 			c.updateFetcher(numStreams)
 		}
@@ -806,18 +860,40 @@ func (c *Consumer) initFetchersAndWorkers(assignmentContext *assignmentContext)
 	}
 
 	if Logger.IsAllowed(DebugLevel) {
-		Debugf(c, "Fetcher has been updated %s", assignmentContext)
+		Debugw(c, "Fetcher has been updated", Fields{"assignment": assignmentContext})
 	}
 	c.initializeWorkerManagers()
 
 	if Logger.IsAllowed(InfoLevel) {
-		Infof(c, "Restarted streams")
+		Info(c, "Restarted streams")
 	}
 	c.connectChannels <- true
 }
 
 func (c *Consumer) fetchOffsets(topicPartitions []*TopicAndPartition) (map[TopicAndPartition]int64, error) {
 	offsets := make(map[TopicAndPartition]int64)
+	if storage := c.config.TransactionalOffsetStorage; storage != nil {
+		for _, topicPartition := range topicPartitions {
+			offset, err := storage.GetOffset(c.config.Groupid, topicPartition.Topic, topicPartition.Partition)
+			if err != nil {
+				return nil, err
+			}
+			offsets[*topicPartition] = offset
+		}
+		return offsets, nil
+	}
+
+	if storage, ok := c.config.OffsetStorage.(BatchOffsetStorage); ok {
+		offsetsAndMetadata, err := storage.GetOffsets(c.config.Groupid, topicPartitions)
+		if err != nil {
+			return nil, err
+		}
+		for topicPartition, offset := range offsetsAndMetadata {
+			offsets[topicPartition] = offset.Offset
+		}
+		return offsets, nil
+	}
+
 	for _, topicPartition := range topicPartitions {
 		offset, err := c.config.OffsetStorage.GetOffset(c.config.Groupid, topicPartition.Topic, topicPartition.Partition)
 		if err != nil {
@@ -834,7 +910,7 @@ func (c *Consumer) addPartitionTopicInfo(currenttopicRegistry map[string]map[int
 	topicPartition *TopicAndPartition, offset int64,
 	consumerThreadId ConsumerThreadId) {
 	if Logger.IsAllowed(DebugLevel) {
-		Debugf(c, "Adding partitionTopicInfo: %s", topicPartition)
+		Debugw(c, "Adding partitionTopicInfo", Fields{"topic": topicPartition.Topic, "partition": topicPartition.Partition, "offset": offset})
 	}
 	partTopicInfoMap, exists := currenttopicRegistry[topicPartition.Topic]
 	if !exists {
@@ -844,7 +920,7 @@ func (c *Consumer) addPartitionTopicInfo(currenttopicRegistry map[string]map[int
 
 	buffer := c.topicPartitionsAndBuffers[*topicPartition]
 	if buffer == nil {
-		buffer = newMessageBuffer(*topicPartition, make(chan []*Message, c.config.QueuedMaxMessages), c.config)
+		buffer = newMessageBuffer(*topicPartition, make(chan []*Message, c.config.QueuedMaxMessages), c.config.ForTopic(topicPartition.Topic))
 		c.topicPartitionsAndBuffers[*topicPartition] = buffer
 	}
 
@@ -863,7 +939,7 @@ func (c *Consumer) reflectPartitionOwnershipDecision(partitionOwnershipDecision
 		Info(c, "Consumer is trying to reflect partition ownership decision")
 	}
 	if Logger.IsAllowed(DebugLevel) {
-		Debugf(c, "Partition ownership decision: %v", partitionOwnershipDecision)
+		Debugw(c, "Partition ownership decision", Fields{"decision": partitionOwnershipDecision})
 	}
 
 	pool := NewRoutinePool(c.config.RoutinePoolSize)
@@ -889,7 +965,7 @@ func (c *Consumer) reflectPartitionOwnershipDecision(partitionOwnershipDecision
 
 	if len(partitionOwnershipDecision) > len(successfullyOwnedPartitions) {
 		if Logger.IsAllowed(WarnLevel) {
-			Warnf(c, "Consumer failed to reflect all partitions %d of %d", len(successfullyOwnedPartitions), len(partitionOwnershipDecision))
+			Warnw(c, "Consumer failed to reflect all partitions", Fields{"owned": len(successfullyOwnedPartitions), "assigned": len(partitionOwnershipDecision)})
 		}
 		for _, topicPartition := range successfullyOwnedPartitions {
 			c.config.Coordinator.ReleasePartitionOwnership(c.config.Groupid, topicPartition.Topic, topicPartition.Partition)
@@ -908,12 +984,12 @@ func (c *Consumer) claimPartitionOwnershipFunc(topicPartition TopicAndPartition,
 		}
 		if success {
 			if Logger.IsAllowed(DebugLevel) {
-				Debugf(c, "Consumer successfully claimed partition %d for topic %s", topicPartition.Partition, topicPartition.Topic)
+				Debugw(c, "Consumer successfully claimed partition", Fields{"topic": topicPartition.Topic, "partition": topicPartition.Partition})
 			}
 			successChan <- topicPartition
 		} else {
 			if Logger.IsAllowed(WarnLevel) {
-				Warnf(c, "Consumer failed to claim partition %d for topic %s", topicPartition.Partition, topicPartition.Topic)
+				Warnw(c, "Consumer failed to claim partition", Fields{"topic": topicPartition.Topic, "partition": topicPartition.Partition})
 			}
 		}
 	}
@@ -929,13 +1005,23 @@ func (c *Consumer) releasePartitionOwnership(localtopicRegistry map[string]map[i
 				panic(err)
 			}
 		}
-		delete(localtopicRegistry, topic)
+		inWriteLock(&c.topicRegistryLock, func() {
+			delete(localtopicRegistry, topic)
+		})
 	}
 	if Logger.IsAllowed(InfoLevel) {
 		Info(c, "Successfully released partition ownership")
 	}
 }
 
+// setTopicRegistry replaces the topic registry of this consumer after a rebalance.
+// Changes to the topic registry are guarded by topicRegistryLock so that it can be introspected at any time.
+func (c *Consumer) setTopicRegistry(registry map[string]map[int32]*partitionTopicInfo) {
+	inWriteLock(&c.topicRegistryLock, func() {
+		c.topicRegistry = registry
+	})
+}
+
 // Returns a state snapshot for this consumer. State snapshot contains a set of metrics splitted by topics and partitions.
 func (c *Consumer) StateSnapshot() *StateSnapshot {
 	metricsMap := c.metrics.Stats()
@@ -949,9 +1035,19 @@ func (c *Consumer) StateSnapshot() *StateSnapshot {
 		offsetsMap[topicAndPartition.Topic][topicAndPartition.Partition] = workerManager.GetLargestOffset()
 	}
 
+	lagsMap := make(map[string]map[int32]PartitionLag)
+	for topicAndPartition, lag := range c.metrics.Lags() {
+		if _, exists := lagsMap[topicAndPartition.Topic]; !exists {
+			lagsMap[topicAndPartition.Topic] = make(map[int32]PartitionLag)
+		}
+
+		lagsMap[topicAndPartition.Topic][topicAndPartition.Partition] = lag
+	}
+
 	return &StateSnapshot{
 		Metrics: metricsMap,
 		Offsets: offsetsMap,
+		Lags:    lagsMap,
 	}
 }
 
@@ -962,3 +1058,18 @@ func (c *Consumer) Metrics() *ConsumerMetrics {
 func isOffsetInvalid(offset int64) bool {
 	return offset <= InvalidOffset
 }
+
+// isOffsetAfter returns true if a given last processed offset is further into a partition than another one.
+// BeforeFirstOffset is further than an invalid offset, as it means the partition has to be consumed from the start.
+func isOffsetAfter(offset int64, other int64) bool {
+	position := func(offset int64) int64 {
+		switch {
+		case offset == BeforeFirstOffset:
+			return -1
+		case isOffsetInvalid(offset):
+			return -2
+		}
+		return offset
+	}
+	return position(offset) > position(other)
+}
@@ -19,6 +19,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 //ConsumerConfig defines configuration options for Consumer
@@ -79,9 +81,27 @@ type ConsumerConfig struct {
 	/* Select a strategy for assigning partitions to consumer streams. Possible values: RangeStrategy, RoundRobinStrategy */
 	PartitionAssignmentStrategy string
 
-	/* Amount of workers per partition to process consumed messages. */
+	/* Amount of workers per partition to process consumed messages. Initial amount of workers if AdaptiveWorkers is enabled. */
 	NumWorkers int
 
+	/* Lets every worker manager grow and shrink its worker pool between MinWorkers and MaxWorkers based on task latency, queued tasks and task error rate. (optional) */
+	AdaptiveWorkers bool
+
+	/* Minimum amount of workers per partition if AdaptiveWorkers is enabled. */
+	MinWorkers int
+
+	/* Maximum amount of workers per partition if AdaptiveWorkers is enabled. */
+	MaxWorkers int
+
+	/* How often worker managers adjust their worker pools if AdaptiveWorkers is enabled. */
+	WorkerAdjustInterval time.Duration
+
+	/* Worker pools are halved if their average task latency exceeds this. If 0, they are halved if it exceeds twice the lowest average latency observed. */
+	WorkerLatencyTarget time.Duration
+
+	/* Worker pools are halved if the share of failed task attempts exceeds this. */
+	WorkerErrorRateThreshold float64
+
 	/* Times to retry processing a failed message by a worker. */
 	MaxWorkerRetries int
 
@@ -98,6 +118,16 @@ type ConsumerConfig struct {
 	/* Callback executed when Worker failed to process the message after MaxWorkerRetries and WorkerRetryThreshold is not hit */
 	WorkerFailedAttemptCallback FailedAttemptCallback
 
+	/* Pauses a partition after this many consecutive messages failed after MaxWorkerRetries, holding failed messages without committing their offsets.
+	Held messages are neither passed to WorkerFailedAttemptCallback nor counted towards WorkerRetryThreshold. 0 disables the circuit breaker. (optional) */
+	CircuitBreakerThreshold int
+
+	/* Time a paused partition waits before retrying its first held message as a probe. Consumption resumes if the probe succeeds. */
+	CircuitBreakerCooldown time.Duration
+
+	/* Callback executed when the circuit breaker of a partition changes its state. (optional) */
+	CircuitBreakerCallback CircuitBreakerCallback
+
 	/* Worker timeout to process a single message. */
 	WorkerTaskTimeout time.Duration
 
@@ -118,6 +148,22 @@ type ConsumerConfig struct {
 	Resets after each flush meaning this won't be triggered if FetchBatchSize is reached before timeout. */
 	FetchBatchTimeout time.Duration
 
+	/* Holds each batch until all of its messages are at least this old before handing them to workers. Fetching from the partition pauses meanwhile.
+	0 disables delayed consumption. (optional) */
+	MinMessageAge time.Duration
+
+	/* What the age of a message is measured from when MinMessageAge is set.
+	TimestampAge : the message timestamp, or the fetch time for messages without a timestamp.
+	FetchTimeAge : the time the message was fetched.
+	Defaults to TimestampAge. */
+	MessageAgeSource string
+
+	/* Overrides of Strategy, decoders, NumWorkers, FetchBatchSize and retry settings for given topics, keyed by topic. (optional) */
+	TopicConfigs map[string]*TopicConfig
+
+	/* Overrides for topics matching regexes, used if TopicConfigs has no entry for a topic. The first matching entry applies. (optional) */
+	TopicPatternConfigs []*TopicPatternConfig
+
 	/* Backoff between fetch requests if no messages were fetched from a previous fetch. */
 	RequeueAskNextBackoff time.Duration
 
@@ -142,6 +188,10 @@ type ConsumerConfig struct {
 	/* OffsetStorage is used to store and retrieve consumer offsets. */
 	OffsetStorage OffsetStorage
 
+	/* Storage that commits offsets in the same transaction as the results of processed batches. If set, it is used instead of
+	   OffsetStorage both to commit offsets and to get starting offsets on assignment, and OffsetStorage may be left empty. (optional) */
+	TransactionalOffsetStorage TransactionalOffsetStorage
+
 	/* Indicates whether the client supports blue-green deployment.
 	This config entry is needed because blue-green deployment won't work with RoundRobin partition assignment strategy.
 	Defaults to true. */
@@ -156,6 +206,10 @@ type ConsumerConfig struct {
 	/* Low Level Kafka Client implementation. */
 	LowLevelClient LowLevelClient
 
+	/* Kafka protocol version used by the low level client, e.g. "0.10.2.0". Set to KafkaVersionAuto to negotiate
+	the version with brokers using the ApiVersions request. Defaults to DefaultKafkaVersion. */
+	KafkaVersion string
+
 	/* Message keys decoder */
 	KeyDecoder Decoder
 
@@ -168,12 +222,42 @@ type ConsumerConfig struct {
 	/* Metrics Prefix if the client wants to organize the way metric names are emitted. (optional) */
 	MetricsPrefix string
 
+	/* Registry to register consumer metrics in. Consumers sharing a registry are told apart by their consumer id in metric names.
+	   Every consumer gets its own registry if not set. (optional) */
+	MetricsRegistry metrics.Registry
+
 	/* Config to skip corrupted messages. If set to true the consumer will increment the topic-partition offset by 1
 	   on each corrupted response until the corrupted part of data is over. Turned off by default. */
 	SkipCorruptedMessages bool
 
+	/* Sink to write the corrupted data skipped due to SkipCorruptedMessages to, so it is not lost.
+	   Setting it turns on SkipCorruptedMessages. (optional) */
+	QuarantineSink QuarantineSink
+
+	/* Callback invoked each time a region of corrupted data is skipped, e.g. to raise an alert. (optional) */
+	CorruptedDataCallback func(*QuarantinedData)
+
 	/* RoutinePoolSize defines the size of routine pools created within this consumer. */
 	RoutinePoolSize int
+
+	/* The consumer is reported unhealthy if it owns partitions but none of its fetchers has picked up a fetch request for this long.
+	   0 disables the check. */
+	HealthFetchTimeout time.Duration
+
+	/* The consumer is reported unhealthy if a partition has processed but uncommitted messages and its last offset commit is older than this.
+	   0 disables the check. */
+	HealthCommitTimeout time.Duration
+
+	/* Tracer creating spans for fetches, batch accumulation, tasks, retries and offset commits.
+	   NoopTracer if not set. (optional) */
+	Tracer Tracer
+
+	/* Limits the rate of messages and bytes dispatched to workers of this consumer. Share a RateLimiter between consumers to limit them together.
+	   Limits may be changed while consuming with RateLimiter.SetLimits. (optional) */
+	RateLimiter *RateLimiter
+
+	/* Rate limiters for messages of given topics, keyed by topic. Applied in addition to RateLimiter. (optional) */
+	TopicRateLimiters map[string]*RateLimiter
 }
 
 //DefaultConsumerConfig creates a ConsumerConfig with sane defaults. Note that several required config entries (like Strategy and callbacks) are still not set.
@@ -198,15 +282,21 @@ func DefaultConsumerConfig() *ConsumerConfig {
 	config.PartitionAssignmentStrategy = RangeStrategy /* select between "RangeStrategy", and "RoundRobinStrategy" */
 
 	config.NumWorkers = 10
+	config.MinWorkers = 1
+	config.MaxWorkers = 100
+	config.WorkerAdjustInterval = 5 * time.Second
+	config.WorkerErrorRateThreshold = 0.1
 	config.MaxWorkerRetries = 3
 	config.WorkerRetryThreshold = 100
 	config.WorkerThresholdTimeWindow = 1 * time.Minute
+	config.CircuitBreakerCooldown = 30 * time.Second
 	config.WorkerBackoff = 500 * time.Millisecond
 	config.WorkerTaskTimeout = 1 * time.Minute
 	config.WorkerManagersStopTimeout = 1 * time.Minute
 
 	config.FetchBatchSize = 100
 	config.FetchBatchTimeout = 5 * time.Second
+	config.MessageAgeSource = TimestampAge
 
 	config.FetchMaxRetries = 5
 	config.RequeueAskNextBackoff = 5 * time.Second
@@ -220,12 +310,17 @@ func DefaultConsumerConfig() *ConsumerConfig {
 	config.DeploymentTimeout = 0 * time.Second
 	config.BarrierTimeout = 30 * time.Second
 	config.LowLevelClient = NewSaramaClient(config)
+	config.KafkaVersion = DefaultKafkaVersion
 
 	config.KeyDecoder = &ByteDecoder{}
 	config.ValueDecoder = config.KeyDecoder
 
 	config.RoutinePoolSize = 50
 
+	config.HealthFetchTimeout = 2 * time.Minute
+	config.HealthCommitTimeout = 5 * time.Minute
+	config.Tracer = NoopTracer
+
 	return config
 }
 
@@ -248,16 +343,39 @@ ConsumerId: %s
 ExcludeInternalTopics: %v
 PartitionAssignmentStrategy: %s
 NumWorkers: %d
+AdaptiveWorkers: %v
+MinWorkers: %d
+MaxWorkers: %d
+WorkerAdjustInterval: %v
+WorkerLatencyTarget: %v
+WorkerErrorRateThreshold: %v
 MaxWorkerRetries: %d
 WorkerRetryThreshold %d
 WorkerThresholdTimeWindow %v
 WorkerFailureCallback %v
 WorkerFailedAttemptCallback %v
+CircuitBreakerThreshold %d
+CircuitBreakerCooldown %v
+CircuitBreakerCallback %v
 WorkerTaskTimeout %v
 WorkerBackoff %v
 Strategy %v
 FetchBatchSize %d
 FetchBatchTimeout %v
+MinMessageAge %v
+MessageAgeSource %s
+TopicConfigs %v
+TopicPatternConfigs %v
+KafkaVersion %s
+SkipCorruptedMessages %v
+QuarantineSink %v
+TransactionalOffsetStorage %v
+MetricsRegistry %v
+HealthFetchTimeout %v
+HealthCommitTimeout %v
+Tracer %v
+RateLimiter %v
+TopicRateLimiters %v
 `, c.Groupid, c.SocketTimeout,
 		c.FetchMessageMaxBytes, c.NumConsumerFetchers, c.QueuedMaxMessages, c.RebalanceMaxRetries,
 		c.FetchMinBytes, c.FetchWaitMaxMs,
@@ -265,10 +383,20 @@ FetchBatchTimeout %v
 		c.OffsetsCommitMaxRetries,
 		c.AutoOffsetReset, c.Clientid, c.Consumerid,
 		c.ExcludeInternalTopics, c.PartitionAssignmentStrategy, c.NumWorkers,
+		c.AdaptiveWorkers, c.MinWorkers, c.MaxWorkers, c.WorkerAdjustInterval, c.WorkerLatencyTarget, c.WorkerErrorRateThreshold,
 		c.MaxWorkerRetries, c.WorkerRetryThreshold,
 		c.WorkerThresholdTimeWindow, c.WorkerFailureCallback, c.WorkerFailedAttemptCallback,
+		c.CircuitBreakerThreshold, c.CircuitBreakerCooldown, c.CircuitBreakerCallback,
 		c.WorkerTaskTimeout, c.WorkerBackoff,
-		c.Strategy, c.FetchBatchSize, c.FetchBatchTimeout)
+		c.Strategy, c.FetchBatchSize, c.FetchBatchTimeout, c.MinMessageAge, c.MessageAgeSource, c.TopicConfigs, c.TopicPatternConfigs, c.KafkaVersion,
+		c.SkipCorruptedMessages, c.QuarantineSink, c.TransactionalOffsetStorage, c.MetricsRegistry,
+		c.HealthFetchTimeout, c.HealthCommitTimeout, c.Tracer, c.RateLimiter, c.TopicRateLimiters)
+}
+
+// skipsCorruptedMessages returns true if corrupted data should be skipped, either because SkipCorruptedMessages is on
+// or because a QuarantineSink is set.
+func (c *ConsumerConfig) skipsCorruptedMessages() bool {
+	return c.SkipCorruptedMessages || c.QuarantineSink != nil
 }
 
 // Validate this ConsumerConfig. Returns a corresponding error if the ConsumerConfig is invalid and nil otherwise.
@@ -313,6 +441,21 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("NumWorkers should be at least 1")
 	}
 
+	if c.AdaptiveWorkers {
+		if c.MinWorkers <= 0 {
+			return errors.New("MinWorkers should be at least 1")
+		}
+		if c.MaxWorkers < c.MinWorkers {
+			return errors.New("MaxWorkers cannot be less than MinWorkers")
+		}
+		if c.NumWorkers < c.MinWorkers || c.NumWorkers > c.MaxWorkers {
+			return errors.New("NumWorkers should be between MinWorkers and MaxWorkers")
+		}
+		if c.WorkerAdjustInterval <= 0 {
+			return errors.New("WorkerAdjustInterval should be positive")
+		}
+	}
+
 	if c.MaxWorkerRetries < 0 {
 		return errors.New("MaxWorkerRetries cannot be less than 0")
 	}
@@ -321,6 +464,14 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("Please provide a WorkerFailureCallback")
 	}
 
+	if c.CircuitBreakerThreshold < 0 {
+		return errors.New("CircuitBreakerThreshold cannot be less than 0")
+	}
+
+	if c.CircuitBreakerThreshold > 0 && c.CircuitBreakerCooldown <= 0 {
+		return errors.New("CircuitBreakerCooldown should be positive")
+	}
+
 	if c.WorkerFailedAttemptCallback == nil {
 		return errors.New("Please provide a WorkerFailedAttemptCallback")
 	}
@@ -337,6 +488,14 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("FetchBatchSize should be at least 1")
 	}
 
+	if c.MinMessageAge < 0 {
+		return errors.New("MinMessageAge cannot be less than 0")
+	}
+
+	if c.MinMessageAge > 0 && c.MessageAgeSource != TimestampAge && c.MessageAgeSource != FetchTimeAge {
+		return fmt.Errorf("MessageAgeSource must be either \"%s\" or \"%s\"", TimestampAge, FetchTimeAge)
+	}
+
 	if c.FetchMaxRetries < 0 {
 		return errors.New("FetchMaxRetries cannot be less than 0")
 	}
@@ -349,7 +508,7 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("Please provide a Coordinator")
 	}
 
-	if c.OffsetStorage == nil {
+	if c.OffsetStorage == nil && c.TransactionalOffsetStorage == nil {
 		// This is for folks who already use this client
 		if zookeeper, ok := c.Coordinator.(*ZookeeperCoordinator); ok {
 			c.OffsetStorage = zookeeper
@@ -366,6 +525,16 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("Low level client is not set")
 	}
 
+	if c.KafkaVersion != "" {
+		if err := ValidateKafkaVersion(c.KafkaVersion); err != nil {
+			return fmt.Errorf("Invalid KafkaVersion %q: %s", c.KafkaVersion, err)
+		}
+	}
+
+	if c.Tracer == nil {
+		c.Tracer = NoopTracer
+	}
+
 	if c.KeyDecoder == nil {
 		return errors.New("Key decoder is not set")
 	}
@@ -374,6 +543,24 @@ func (c *ConsumerConfig) Validate() error {
 		return errors.New("Value decoder is not set")
 	}
 
+	for topic, config := range c.TopicConfigs {
+		if err := validateTopicConfig(c, topic, config); err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range c.TopicPatternConfigs {
+		if pattern == nil {
+			return errors.New("TopicPatternConfigs cannot contain nil entries")
+		}
+		if pattern.compiledRegex == nil {
+			return errors.New("TopicPatternConfigs entries should be created with NewTopicPatternConfig")
+		}
+		if err := validateTopicConfig(c, pattern.Regex(), pattern.Config); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -396,20 +583,38 @@ func (c *ConsumerConfig) Validate() error {
 //  exclude.internal.topics
 //  partition.assignment.strategy
 //  num.workers
+//  adaptive.workers
+//  min.workers
+//  max.workers
+//  worker.adjust.interval
+//  worker.latency.target
+//  worker.error.rate.threshold
 //  max.worker.retries
 //  worker.retry.threshold
 //  worker.threshold.time.window
 //  worker.task.timeout
 //  worker.backoff
+//  circuit.breaker.threshold
+//  circuit.breaker.cooldown
 //  worker.managers.stop.timeout
 //  fetch.batch.size
 //  fetch.batch.timeout
+//  min.message.age
+//  message.age.source
 //  requeue.ask.next.backoff
 //  fetch.max.retries
 //  fetch.topic.metadata.retries
 //  fetch.topic.metadata.backoff
 //  fetch.request.backoff
 //  blue.green.deployment.enabled
+//  kafka.version
+//  skip.corrupted.messages
+//  quarantine.dir
+//  offsets.file
+//  health.fetch.timeout
+//  health.commit.timeout
+//  rate.limit.messages
+//  rate.limit.bytes
 // The configuration file entries should be constructed in key=value syntax. A # symbol at the beginning
 // of a line indicates a comment. Blank lines are ignored. The file should end with a newline character.
 func ConsumerConfigFromFile(filename string) (*ConsumerConfig, error) {
@@ -475,6 +680,28 @@ func ConsumerConfigFromFile(filename string) (*ConsumerConfig, error) {
 	if err := setDurationConfig(&config.WorkerBackoff, c["worker.backoff"]); err != nil {
 		return nil, err
 	}
+	if err := setIntConfig(&config.CircuitBreakerThreshold, c["circuit.breaker.threshold"]); err != nil {
+		return nil, err
+	}
+	if err := setDurationConfig(&config.CircuitBreakerCooldown, c["circuit.breaker.cooldown"]); err != nil {
+		return nil, err
+	}
+	setBoolConfig(&config.AdaptiveWorkers, c["adaptive.workers"])
+	if err := setIntConfig(&config.MinWorkers, c["min.workers"]); err != nil {
+		return nil, err
+	}
+	if err := setIntConfig(&config.MaxWorkers, c["max.workers"]); err != nil {
+		return nil, err
+	}
+	if err := setDurationConfig(&config.WorkerAdjustInterval, c["worker.adjust.interval"]); err != nil {
+		return nil, err
+	}
+	if err := setDurationConfig(&config.WorkerLatencyTarget, c["worker.latency.target"]); err != nil {
+		return nil, err
+	}
+	if err := setFloat64Config(&config.WorkerErrorRateThreshold, c["worker.error.rate.threshold"]); err != nil {
+		return nil, err
+	}
 	if err := setDurationConfig(&config.WorkerManagersStopTimeout, c["worker.managers.stop.timeout"]); err != nil {
 		return nil, err
 	}
@@ -484,6 +711,10 @@ func ConsumerConfigFromFile(filename string) (*ConsumerConfig, error) {
 	if err := setDurationConfig(&config.FetchBatchTimeout, c["fetch.batch.timeout"]); err != nil {
 		return nil, err
 	}
+	if err := setDurationConfig(&config.MinMessageAge, c["min.message.age"]); err != nil {
+		return nil, err
+	}
+	setStringConfig(&config.MessageAgeSource, c["message.age.source"])
 	if err := setDurationConfig(&config.RequeueAskNextBackoff, c["requeue.ask.next.backoff"]); err != nil {
 		return nil, err
 	}
@@ -508,7 +739,39 @@ func ConsumerConfigFromFile(filename string) (*ConsumerConfig, error) {
 	if err := setIntConfig(&config.RoutinePoolSize, c["routine.pool.size"]); err != nil {
 		return nil, err
 	}
+	if err := setDurationConfig(&config.HealthFetchTimeout, c["health.fetch.timeout"]); err != nil {
+		return nil, err
+	}
+	if err := setDurationConfig(&config.HealthCommitTimeout, c["health.commit.timeout"]); err != nil {
+		return nil, err
+	}
+	var messagesPerSecond, bytesPerSecond float64
+	if err := setFloat64Config(&messagesPerSecond, c["rate.limit.messages"]); err != nil {
+		return nil, err
+	}
+	if err := setFloat64Config(&bytesPerSecond, c["rate.limit.bytes"]); err != nil {
+		return nil, err
+	}
+	if messagesPerSecond > 0 || bytesPerSecond > 0 {
+		config.RateLimiter = NewRateLimiter(messagesPerSecond, bytesPerSecond)
+	}
 	setBoolConfig(&config.BlueGreenDeploymentEnabled, c["blue.green.deployment.enabled"])
+	setStringConfig(&config.KafkaVersion, c["kafka.version"])
+	setBoolConfig(&config.SkipCorruptedMessages, c["skip.corrupted.messages"])
+	if path := c["offsets.file"]; path != "" {
+		storage, err := NewFileOffsetStorage(path)
+		if err != nil {
+			return nil, err
+		}
+		config.OffsetStorage = storage
+	}
+	if dir := c["quarantine.dir"]; dir != "" {
+		sink, err := NewFileQuarantineSink(dir)
+		if err != nil {
+			return nil, err
+		}
+		config.QuarantineSink = sink
+	}
 
 	return config, nil
 }
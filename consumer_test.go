@@ -22,12 +22,15 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 var numMessages = 1000
 var consumeTimeout = 1 * time.Minute
 var localZk = "localhost:2181"
 var localBroker = "localhost:9092"
+var faultInjectionSeed int64 = 20151027
 
 func TestConsumerWithInconsistentProducing(t *testing.T) {
 	consumeStatus := make(chan int)
@@ -256,7 +259,19 @@ func TestSnappyCompression(t *testing.T) {
 	testCompression(t, sarama.CompressionSnappy)
 }
 
+func TestLz4Compression(t *testing.T) {
+	testVersionedCompression(t, sarama.CompressionLZ4, sarama.V0_10_0_0)
+}
+
+func TestZstdCompression(t *testing.T) {
+	testVersionedCompression(t, sarama.CompressionZSTD, sarama.V2_1_0_0)
+}
+
 func testCompression(t *testing.T, codec sarama.CompressionCodec) {
+	testVersionedCompression(t, codec, sarama.V0_8_2_0)
+}
+
+func testVersionedCompression(t *testing.T, codec sarama.CompressionCodec, version sarama.KafkaVersion) {
 	topic := fmt.Sprintf("test-compression-%d", time.Now().Unix())
 	messages := make([]string, 0)
 	for i := 0; i < numMessages; i++ {
@@ -265,9 +280,10 @@ func testCompression(t *testing.T, codec sarama.CompressionCodec) {
 
 	CreateMultiplePartitionsTopic(localZk, topic, 1)
 	EnsureHasLeader(localZk, topic)
-	produce(t, messages, topic, localBroker, codec)
+	produceWithVersion(t, messages, topic, localBroker, codec, version)
 
 	config := testConsumerConfig()
+	config.KafkaVersion = version.String()
 	config.NumWorkers = 1
 	successChan := make(chan bool)
 	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
@@ -292,6 +308,54 @@ func testCompression(t *testing.T, codec sarama.CompressionCodec) {
 	closeWithin(t, 10*time.Second, consumer)
 }
 
+func TestConsumerSurvivesInjectedFaults(t *testing.T) {
+	topic := fmt.Sprintf("test-fault-injection-%d", time.Now().Unix())
+	CreateMultiplePartitionsTopic(localZk, topic, 2)
+	EnsureHasLeader(localZk, topic)
+	go produceN(t, numMessages, topic, localBroker)
+
+	faults := testFaultInjectionConfig()
+	faults.OffsetOutOfRangeProbability = 0.01
+	faults.DuplicateProbability = 0.05
+	faults.CorruptionProbability = 0.01
+
+	config := testConsumerConfig()
+	client := NewFaultInjectingClient(NewSaramaClient(config), faults)
+	config.LowLevelClient = client
+
+	// Faults may cause redelivery, so only count distinct offsets.
+	consumed := make(map[TopicAndPartition]map[int64]bool)
+	var consumedLock sync.Mutex
+	done := make(chan bool, 1)
+	total := 0
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		inLock(&consumedLock, func() {
+			topicPartition := TopicAndPartition{msg.Topic, msg.Partition}
+			if consumed[topicPartition] == nil {
+				consumed[topicPartition] = make(map[int64]bool)
+			}
+			if !consumed[topicPartition][msg.Offset] {
+				consumed[topicPartition][msg.Offset] = true
+				total++
+				if total == numMessages {
+					done <- true
+				}
+			}
+		})
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStatic(map[string]int{topic: 1})
+	select {
+	case <-done:
+	case <-time.After(consumeTimeout):
+		t.Errorf("Failed to consume %d distinct messages within %s with faults %s", numMessages, consumeTimeout, faults)
+	}
+	Infof("test", "Injected faults: %+v", client.Stats())
+	closeWithin(t, 10*time.Second, consumer)
+}
+
 func TestBlueGreenDeployment(t *testing.T) {
 	partitions := 2
 	activeTopic := fmt.Sprintf("active-%d", time.Now().Unix())
@@ -373,6 +437,11 @@ func TestBlueGreenDeployment(t *testing.T) {
 		assert(t, found, true)
 	}
 
+	// the resumed fetchers report high watermarks to the metrics the lag is computed from
+	for _, consumer := range append(blueGroupConsumers, greenGroupConsumers...) {
+		assert(t, consumer.fetcher.metrics == consumer.metrics, true)
+	}
+
 	//At this stage Blue group became Green group
 	//and Green group became Blue group
 
@@ -635,7 +704,19 @@ func testConsumerConfig() *ConsumerConfig {
 	zkConfig.ZookeeperTimeout = 30 * time.Second
 	zkConfig.RequestBackoff = 3 * time.Second
 	config.Coordinator = NewZookeeperCoordinator(zkConfig)
+	config.LowLevelClient = NewFaultInjectingClient(config.LowLevelClient, testFaultInjectionConfig())
+
+	return config
+}
 
+// testFaultInjectionConfig injects faults every consumer is expected to survive without losing or duplicating messages.
+func testFaultInjectionConfig() *FaultInjectionConfig {
+	config := NewFaultInjectionConfig(faultInjectionSeed)
+	config.LatencyProbability = 0.05
+	config.MinLatency = 1 * time.Millisecond
+	config.MaxLatency = 50 * time.Millisecond
+	config.LeaderNotAvailableProbability = 0.02
+	config.TimeoutProbability = 0.02
 	return config
 }
 
@@ -724,3 +805,269 @@ func atomicIncrement(counter *int, lock *sync.Mutex) {
 		*counter++
 	})
 }
+
+func TestConsumerFetchesOffsetsFromBatchOffsetStorage(t *testing.T) {
+	topic := "test-batch-offsets"
+	topics := map[string][]int32{topic: []int32{0}}
+	storage := newInMemoryBatchOffsetStorage()
+	storage.CommitOffset("", topic, 0, 5)
+
+	consumed := make(chan *Message, 10)
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 10), topics)
+	config.OffsetStorage = storage
+	config.Strategy = func(_ *Worker, message *Message, id TaskId) WorkerResult {
+		consumed <- message
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+
+	select {
+	case message := <-consumed:
+		assert(t, message.Offset, int64(6))
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Failed to consume a message within %s", consumeTimeout)
+	}
+	closeWithin(t, 10*time.Second, consumer)
+
+	assert(t, storage.getRequests, 1)
+}
+
+func TestConsumerStartsFromTransactionalOffsetStorage(t *testing.T) {
+	topic := "test-transactional-offsets"
+	topics := map[string][]int32{topic: []int32{0}}
+	storage := newInMemoryTransactionalOffsetStorage()
+	storage.offsets[TopicAndPartition{topic, 0}] = 5
+
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 10), topics)
+	offsetStorage := config.OffsetStorage.(*inMemoryCoordinator)
+	config.TransactionalOffsetStorage = storage
+	config.Strategy = goodStrategy
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+
+	timeout := time.After(consumeTimeout)
+	for offset, _ := storage.GetOffset("", topic, 0); offset != 9; offset, _ = storage.GetOffset("", topic, 0) {
+		select {
+		case <-timeout:
+			t.Fatalf("Failed to commit all messages within %s, last committed offset %d", consumeTimeout, offset)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	closeWithin(t, 10*time.Second, consumer)
+
+	assert(t, storage.results[0].Id().Offset, int64(6))
+	assert(t, len(storage.results), 4)
+	offset, _ := offsetStorage.GetOffset(config.Groupid, topic, 0)
+	assert(t, offset, InvalidOffset)
+}
+
+func TestConsumerTracksLag(t *testing.T) {
+	topic := "test-lag"
+	topics := map[string][]int32{topic: []int32{0}}
+	storage := newInMemoryBatchOffsetStorage()
+	storage.CommitOffset("", topic, 0, 3)
+
+	processed := make(chan bool)
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 10), topics)
+	config.OffsetStorage = storage
+	config.OffsetCommitInterval = 100 * time.Millisecond
+	config.Strategy = func(_ *Worker, message *Message, id TaskId) WorkerResult {
+		if message.Offset == 9 {
+			processed <- true
+		}
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+
+	select {
+	case <-processed:
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Failed to consume all messages within %s", consumeTimeout)
+	}
+
+	timeout := time.After(consumeTimeout)
+	lag := consumer.StateSnapshot().Lags[topic][0]
+	for lag.CommittedOffset != 9 {
+		select {
+		case <-timeout:
+			t.Fatalf("Failed to commit all messages within %s, lag %+v", consumeTimeout, lag)
+		case <-time.After(100 * time.Millisecond):
+		}
+		lag = consumer.StateSnapshot().Lags[topic][0]
+	}
+
+	assert(t, lag.HighwaterMarkOffset, int64(10))
+	assert(t, lag.ProcessedOffset, int64(9))
+	assert(t, lag.CommittedLag, int64(0))
+	assert(t, lag.ProcessedLag, int64(0))
+	assert(t, consumer.StateSnapshot().Metrics["ConsumerLag-"+consumer.String()]["value"], float64(0))
+	closeWithin(t, 10*time.Second, consumer)
+}
+
+func TestLagBehind(t *testing.T) {
+	assert(t, lagBehind(10, 3), int64(6))
+	assert(t, lagBehind(10, 9), int64(0))
+	assert(t, lagBehind(10, 15), int64(0))
+	assert(t, lagBehind(InvalidOffset, 3), int64(0))
+	assert(t, lagBehind(10, InvalidOffset), int64(0))
+}
+
+func TestConsumerMetricsRegistry(t *testing.T) {
+	topics := map[string][]int32{"topic": []int32{0}}
+	// consumers are closed once started, so wait for the first message to make sure they are
+	startConsumer := func(config *ConsumerConfig) *Consumer {
+		consumed := make(chan bool, 10)
+		config.Strategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult {
+			consumed <- true
+			return NewSuccessfulResult(id)
+		}
+		consumer := NewConsumer(config)
+		go consumer.StartStaticPartitions(topics)
+		select {
+		case <-consumed:
+		case <-time.After(consumeTimeout):
+			t.Errorf("Failed to consume a message within %s", consumeTimeout)
+		}
+		return consumer
+	}
+
+	first := startConsumer(inMemoryConsumerConfig(newStaticClient("topic", 0, 10), topics))
+	defer closeWithin(t, 10*time.Second, first)
+	second := startConsumer(inMemoryConsumerConfig(newStaticClient("topic", 0, 10), topics))
+	defer closeWithin(t, 10*time.Second, second)
+	if first.Metrics().Registry() == second.Metrics().Registry() {
+		t.Error("Consumers should have separate metrics registries by default")
+	}
+
+	registry := metrics.NewRegistry()
+	sharedConfig := func(consumerId string) *ConsumerConfig {
+		config := inMemoryConsumerConfig(newStaticClient("topic", 0, 10), topics)
+		config.Consumerid = consumerId
+		config.MetricsRegistry = registry
+		return config
+	}
+	sharingFirst := startConsumer(sharedConfig("first"))
+	sharingSecond := startConsumer(sharedConfig("second"))
+	defer closeWithin(t, 10*time.Second, sharingSecond)
+	sharingSecond.Metrics().taskTimeouts().Inc(3)
+
+	if _, exists := sharingFirst.Metrics().Stats()["TaskTimeouts-"+sharingSecond.String()]; exists {
+		t.Error("Stats should only contain metrics of its own consumer")
+	}
+	assert(t, sharingSecond.Metrics().Stats()["TaskTimeouts-"+sharingSecond.String()]["count"], float64(3))
+
+	// closing a consumer unregisters its own metrics only
+	closeWithin(t, 10*time.Second, sharingFirst)
+	assert(t, registry.Get("TaskTimeouts-"+sharingFirst.String()), nil)
+	assert(t, registry.Get(sharingFirst.Metrics().partitionMetricName("Messages", TopicAndPartition{"topic", 0})), nil)
+	assert(t, registry.Get("TaskTimeouts-"+sharingSecond.String()), sharingSecond.Metrics().taskTimeouts())
+}
+
+func TestSaramaClientCommitsNextOffsetToKafka(t *testing.T) {
+	group, topic := "test-group", "test-next-offset"
+	mockBroker := sarama.NewMockBroker(t, 1)
+	defer mockBroker.Close()
+	mockBroker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(mockBroker.Addr(), mockBroker.BrokerID()).
+			SetLeader(topic, 0, mockBroker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, group, mockBroker),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t).
+			SetError(group, topic, 0, sarama.ErrNoError),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(group, topic, 0, 10, "", sarama.ErrNoError).
+			SetOffset(group, topic, 1, -1, "", sarama.ErrNoError).
+			SetOffset(group, topic, 2, 0, "", sarama.ErrNoError),
+	})
+
+	kafka, err := sarama.NewClient([]string{mockBroker.Addr()}, sarama.NewConfig())
+	assert(t, err, nil)
+	client := &SaramaClient{config: DefaultConsumerConfig(), client: kafka}
+	defer client.Close()
+
+	// the last processed offset is 9, so the next message to consume is 10
+	assert(t, client.CommitOffset(group, topic, 0, 9), nil)
+	var commit *sarama.OffsetCommitRequest
+	for _, exchange := range mockBroker.History() {
+		if request, ok := exchange.Request.(*sarama.OffsetCommitRequest); ok {
+			commit = request
+		}
+	}
+	assert(t, commit != nil, true)
+	committed, _, err := commit.Offset(topic, 0)
+	assert(t, err, nil)
+	assert(t, committed, int64(10))
+
+	offset, err := client.GetOffset(group, topic, 0)
+	assert(t, err, nil)
+	assert(t, offset, int64(9))
+	offset, err = client.GetOffset(group, topic, 1)
+	assert(t, err, nil)
+	assert(t, offset, InvalidOffset)
+	// another client committed that the partition is consumed from its first message
+	offset, err = client.GetOffset(group, topic, 2)
+	assert(t, err, nil)
+	assert(t, offset, BeforeFirstOffset)
+	assert(t, nextOffset(BeforeFirstOffset), int64(0))
+}
+
+func TestConsumerStartsAtFirstOffsetCommittedByOtherClients(t *testing.T) {
+	topic := "test-before-first-offset"
+	topics := map[string][]int32{topic: []int32{0}}
+	consumed := make(chan int64, 10)
+
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 10), topics)
+	// a missing offset would skip the whole partition
+	config.AutoOffsetReset = LargestOffset
+	config.OffsetStorage.CommitOffset(config.Groupid, topic, 0, BeforeFirstOffset)
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		consumed <- msg.Offset
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+	select {
+	case offset := <-consumed:
+		assert(t, offset, int64(0))
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Failed to consume a message within %s", consumeTimeout)
+	}
+	closeWithin(t, 10*time.Second, consumer)
+}
+
+func TestSaramaClientRebasesCompressedMessageOffsets(t *testing.T) {
+	topic := "test-compressed-offsets"
+	client := &SaramaClient{config: DefaultConsumerConfig()}
+
+	// a v1 compressed message holds the offsets of its inner messages relative to the first one and its own offset is the last one's
+	newInner := func(relative int64, version int8) *sarama.MessageBlock {
+		return &sarama.MessageBlock{Offset: relative, Msg: &sarama.Message{Value: []byte("value"), Version: version}}
+	}
+	newWrapper := func(offset int64, version int8) *sarama.MessageBlock {
+		return &sarama.MessageBlock{Offset: offset, Msg: &sarama.Message{
+			Codec:   sarama.CompressionGZIP,
+			Version: version,
+			Set:     &sarama.MessageSet{Messages: []*sarama.MessageBlock{newInner(0, version), newInner(1, version), newInner(2, version)}},
+		}}
+	}
+	offsets := func(requestedOffset int64, wrappers ...*sarama.MessageBlock) []int64 {
+		block := &sarama.FetchResponseBlock{RecordsSet: []*sarama.Records{&sarama.Records{MsgSet: &sarama.MessageSet{Messages: wrappers}}}}
+		result := make([]int64, 0)
+		for _, message := range client.collectMessages(block, topic, 0, requestedOffset) {
+			result = append(result, message.Offset)
+		}
+		return result
+	}
+
+	assert(t, offsets(10, newWrapper(12, 1), newWrapper(15, 1)), []int64{10, 11, 12, 13, 14, 15})
+	assert(t, offsets(11, newWrapper(12, 1)), []int64{11, 12})
+	// inner offsets of v0 compressed messages are absolute
+	assert(t, offsets(1, newWrapper(2, 0)), []int64{1, 2})
+}
@@ -0,0 +1,125 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+)
+
+// DualOffsetStorage implements BatchOffsetStorage by writing offsets to two backends at once, so a consumer group can be moved
+// from one offset storage to another without stopping it. Offsets are read from both backends and the larger one is used,
+// so whichever backend is ahead wins. Failures to read from the secondary backend are logged and ignored,
+// failures to read from the primary backend and failures to write to any backend are returned.
+type DualOffsetStorage struct {
+	primary   OffsetStorage
+	secondary OffsetStorage
+}
+
+// Creates a new DualOffsetStorage that reads from and writes to both given backends.
+func NewDualOffsetStorage(primary OffsetStorage, secondary OffsetStorage) *DualOffsetStorage {
+	return &DualOffsetStorage{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+func (this *DualOffsetStorage) String() string {
+	return fmt.Sprintf("Dual offset storage (%v, %v)", this.primary, this.secondary)
+}
+
+// Gets the larger offset of both backends for a given group, topic and partition.
+func (this *DualOffsetStorage) GetOffset(group string, topic string, partition int32) (int64, error) {
+	topicPartition := &TopicAndPartition{topic, partition}
+	offsets, err := this.GetOffsets(group, []*TopicAndPartition{topicPartition})
+	if err != nil {
+		return InvalidOffset, err
+	}
+	return offsets[*topicPartition].Offset, nil
+}
+
+// Commits the given offset for a given group, topic and partition to both backends.
+func (this *DualOffsetStorage) CommitOffset(group string, topic string, partition int32, offset int64) error {
+	return this.CommitOffsets(group, map[TopicAndPartition]OffsetAndMetadata{
+		TopicAndPartition{topic, partition}: OffsetAndMetadata{Offset: offset},
+	})
+}
+
+// Gets the offsets for a given group and topic partitions from both backends and takes the larger offset for each partition.
+func (this *DualOffsetStorage) GetOffsets(group string, topicPartitions []*TopicAndPartition) (map[TopicAndPartition]OffsetAndMetadata, error) {
+	offsets, err := getOffsets(this.primary, group, topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+
+	secondaryOffsets, err := getOffsets(this.secondary, group, topicPartitions)
+	if err != nil {
+		Warnf(this, "Failed to get offsets for group %s from secondary storage, using primary offsets only: %s", group, err)
+		return offsets, nil
+	}
+
+	for topicPartition, secondary := range secondaryOffsets {
+		if primary, exists := offsets[topicPartition]; !exists || isOffsetAfter(secondary.Offset, primary.Offset) {
+			if exists {
+				Infof(this, "Offsets for group %s and %s disagree: primary %d, secondary %d. Using %d", group, &topicPartition, primary.Offset, secondary.Offset, secondary.Offset)
+			}
+			offsets[topicPartition] = secondary
+		}
+	}
+
+	return offsets, nil
+}
+
+// Commits the given offsets for a given group to both backends. The secondary backend is written even if the primary one fails.
+func (this *DualOffsetStorage) CommitOffsets(group string, offsets map[TopicAndPartition]OffsetAndMetadata) error {
+	primaryErr := commitOffsets(this.primary, group, offsets)
+	secondaryErr := commitOffsets(this.secondary, group, offsets)
+
+	if primaryErr != nil {
+		return primaryErr
+	}
+	return secondaryErr
+}
+
+// getOffsets gets offsets from any OffsetStorage, using a single request if it is a BatchOffsetStorage.
+func getOffsets(storage OffsetStorage, group string, topicPartitions []*TopicAndPartition) (map[TopicAndPartition]OffsetAndMetadata, error) {
+	if batchStorage, ok := storage.(BatchOffsetStorage); ok {
+		return batchStorage.GetOffsets(group, topicPartitions)
+	}
+
+	offsets := make(map[TopicAndPartition]OffsetAndMetadata)
+	for _, topicPartition := range topicPartitions {
+		offset, err := storage.GetOffset(group, topicPartition.Topic, topicPartition.Partition)
+		if err != nil {
+			return nil, err
+		}
+		offsets[*topicPartition] = OffsetAndMetadata{Offset: offset}
+	}
+	return offsets, nil
+}
+
+// commitOffsets commits offsets to any OffsetStorage, using a single request if it is a BatchOffsetStorage.
+func commitOffsets(storage OffsetStorage, group string, offsets map[TopicAndPartition]OffsetAndMetadata) error {
+	if batchStorage, ok := storage.(BatchOffsetStorage); ok {
+		return batchStorage.CommitOffsets(group, offsets)
+	}
+
+	for topicPartition, offset := range offsets {
+		if err := storage.CommitOffset(group, topicPartition.Topic, topicPartition.Partition, offset.Offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
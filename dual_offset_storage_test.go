@@ -0,0 +1,117 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errTestStorageUnavailable = errors.New("storage unavailable")
+
+type unavailableOffsetStorage struct{}
+
+func (this *unavailableOffsetStorage) GetOffset(group string, topic string, partition int32) (int64, error) {
+	return InvalidOffset, errTestStorageUnavailable
+}
+func (this *unavailableOffsetStorage) CommitOffset(group string, topic string, partition int32, offset int64) error {
+	return errTestStorageUnavailable
+}
+
+type staticGroupOffsetLister map[string]map[TopicAndPartition]int64
+
+func (this staticGroupOffsetLister) GetAllGroups() ([]string, error) {
+	groups := make([]string, 0, len(this))
+	for group := range this {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+func (this staticGroupOffsetLister) GetGroupOffsets(group string) (map[TopicAndPartition]int64, error) {
+	return this[group], nil
+}
+
+func TestDualOffsetStorage(t *testing.T) {
+	primary := newInMemoryCoordinator(nil)
+	secondary := newInMemoryBatchOffsetStorage()
+	storage := NewDualOffsetStorage(primary, secondary)
+
+	offset, err := storage.GetOffset("group", "topic", 0)
+	assert(t, err, nil)
+	assert(t, offset, InvalidOffset)
+
+	assert(t, storage.CommitOffset("group", "topic", 0, 10), nil)
+	offset, _ = primary.GetOffset("group", "topic", 0)
+	assert(t, offset, int64(10))
+	offset, _ = secondary.GetOffset("group", "topic", 0)
+	assert(t, offset, int64(10))
+
+	primary.CommitOffset("group", "topic", 0, 15)
+	secondary.CommitOffset("group", "topic", 1, 7)
+	offsets, err := storage.GetOffsets("group", []*TopicAndPartition{&TopicAndPartition{"topic", 0}, &TopicAndPartition{"topic", 1}})
+	assert(t, err, nil)
+	assert(t, offsets[TopicAndPartition{"topic", 0}].Offset, int64(15))
+	assert(t, offsets[TopicAndPartition{"topic", 1}].Offset, int64(7))
+
+	// a partition to consume from the start is further than one without an offset
+	secondary.CommitOffset("group", "topic", 2, BeforeFirstOffset)
+	offset, err = storage.GetOffset("group", "topic", 2)
+	assert(t, err, nil)
+	assert(t, offset, BeforeFirstOffset)
+
+	storage = NewDualOffsetStorage(primary, &unavailableOffsetStorage{})
+	offset, err = storage.GetOffset("group", "topic", 0)
+	assert(t, err, nil)
+	assert(t, offset, int64(15))
+	assert(t, storage.CommitOffset("group", "topic", 0, 20), errTestStorageUnavailable)
+	offset, _ = primary.GetOffset("group", "topic", 0)
+	assert(t, offset, int64(20))
+
+	storage = NewDualOffsetStorage(&unavailableOffsetStorage{}, primary)
+	_, err = storage.GetOffset("group", "topic", 0)
+	assert(t, err, errTestStorageUnavailable)
+}
+
+func TestMigrateOffsets(t *testing.T) {
+	source := staticGroupOffsetLister{
+		"group1": {TopicAndPartition{"topic", 0}: 10, TopicAndPartition{"topic", 1}: 20},
+		"group2": {TopicAndPartition{"other", 0}: 5},
+	}
+	target := newInMemoryCoordinator(nil)
+	target.CommitOffset("group1", "topic", 1, 25)
+
+	out := &bytes.Buffer{}
+	copied, err := MigrateOffsets(source, target, nil, true, out)
+	assert(t, err, nil)
+	assert(t, copied, 2)
+	assert(t, strings.Count(out.String(), "\n"), 3)
+	offset, _ := target.GetOffset("group1", "topic", 0)
+	assert(t, offset, InvalidOffset)
+
+	out.Reset()
+	copied, err = MigrateOffsets(source, target, []string{"group1"}, false, out)
+	assert(t, err, nil)
+	assert(t, copied, 1)
+	assert(t, out.String(), "group1\ttopic\t0\t10\t-1\tcopy\ngroup1\ttopic\t1\t20\t25\tskip\n")
+	offset, _ = target.GetOffset("group1", "topic", 0)
+	assert(t, offset, int64(10))
+	offset, _ = target.GetOffset("group1", "topic", 1)
+	assert(t, offset, int64(25))
+	offset, _ = target.GetOffset("group2", "other", 0)
+	assert(t, offset, InvalidOffset)
+}
@@ -0,0 +1,425 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Injected errors are the errors sarama reports for the same failures, so code handling sarama.KError handles them as well.
+var (
+	// Injected instead of a real fetch error to simulate an offset that is out of range.
+	ErrInjectedOffsetOutOfRange error = sarama.ErrOffsetOutOfRange
+
+	// Injected to simulate a partition leader that is not available, e.g. during broker failover.
+	ErrInjectedLeaderNotAvailable error = sarama.ErrLeaderNotAvailable
+
+	// Injected to simulate a request that timed out.
+	ErrInjectedTimeout error = sarama.ErrRequestTimedOut
+)
+
+// FaultInjectionConfig defines which faults are injected and how often. All probabilities are in range [0, 1].
+// Faults are drawn from random sources seeded with Seed. Fetches and offset requests of every partition have their own source,
+// so the same seed produces the same schedule for the same sequence of calls per partition, no matter how calls of different partitions interleave.
+type FaultInjectionConfig struct {
+	// Seed for the fault schedule.
+	Seed int64
+
+	// Probability to delay a call.
+	LatencyProbability float64
+
+	// Minimum and maximum injected delay. The actual delay is picked uniformly in this range.
+	MinLatency time.Duration
+	MaxLatency time.Duration
+
+	// Probability of a fetch to fail with ErrInjectedOffsetOutOfRange.
+	OffsetOutOfRangeProbability float64
+
+	// Probability of a call to fail with ErrInjectedLeaderNotAvailable.
+	LeaderNotAvailableProbability float64
+
+	// Probability of a call to fail with ErrInjectedTimeout.
+	TimeoutProbability float64
+
+	// Probability of a single message to be delivered twice.
+	DuplicateProbability float64
+
+	// Probability of a single message value to be corrupted.
+	CorruptionProbability float64
+}
+
+// NewFaultInjectionConfig creates a FaultInjectionConfig that injects no faults.
+func NewFaultInjectionConfig(seed int64) *FaultInjectionConfig {
+	return &FaultInjectionConfig{
+		Seed: seed,
+	}
+}
+
+func (this *FaultInjectionConfig) String() string {
+	return fmt.Sprintf("{Seed: %d, Latency: %.2f (%s-%s), OffsetOutOfRange: %.2f, LeaderNotAvailable: %.2f, Timeout: %.2f, Duplicate: %.2f, Corruption: %.2f}",
+		this.Seed, this.LatencyProbability, this.MinLatency, this.MaxLatency, this.OffsetOutOfRangeProbability,
+		this.LeaderNotAvailableProbability, this.TimeoutProbability, this.DuplicateProbability, this.CorruptionProbability)
+}
+
+// FaultInjectionStats holds the number of faults injected so far.
+type FaultInjectionStats struct {
+	Delays              int64
+	OffsetsOutOfRange   int64
+	LeadersNotAvailable int64
+	Timeouts            int64
+	Duplicates          int64
+	Corruptions         int64
+}
+
+// faultSchedule draws faults from a seeded random source.
+type faultSchedule struct {
+	config     *FaultInjectionConfig
+	random     *rand.Rand
+	lock       sync.Mutex
+	stats      *FaultInjectionStats
+	partitions map[TopicAndPartition]*faultSchedule
+}
+
+func newFaultSchedule(config *FaultInjectionConfig) *faultSchedule {
+	return &faultSchedule{
+		config:     config,
+		random:     rand.New(rand.NewSource(config.Seed)),
+		stats:      &FaultInjectionStats{},
+		partitions: make(map[TopicAndPartition]*faultSchedule),
+	}
+}
+
+// partition returns the schedule of a given partition. It has its own random source seeded from Seed, topic and partition
+// and counts faults in the stats of this schedule.
+func (this *faultSchedule) partition(topic string, partition int32) *faultSchedule {
+	topicPartition := TopicAndPartition{topic, partition}
+	var schedule *faultSchedule
+	inLock(&this.lock, func() {
+		schedule = this.partitions[topicPartition]
+		if schedule == nil {
+			hash := fnv.New64a()
+			hash.Write([]byte(fmt.Sprintf("%d-%s-%d", this.config.Seed, topic, partition)))
+			schedule = &faultSchedule{
+				config: this.config,
+				random: rand.New(rand.NewSource(int64(hash.Sum64()))),
+				stats:  this.stats,
+			}
+			this.partitions[topicPartition] = schedule
+		}
+	})
+	return schedule
+}
+
+func (this *faultSchedule) happens(probability float64) bool {
+	if probability <= 0 {
+		return false
+	}
+
+	var value float64
+	inLock(&this.lock, func() {
+		value = this.random.Float64()
+	})
+	return value < probability
+}
+
+func (this *faultSchedule) delay() {
+	if !this.happens(this.config.LatencyProbability) {
+		return
+	}
+
+	latency := this.config.MinLatency
+	if spread := int64(this.config.MaxLatency - this.config.MinLatency); spread > 0 {
+		inLock(&this.lock, func() {
+			latency += time.Duration(this.random.Int63n(spread))
+		})
+	}
+	atomic.AddInt64(&this.stats.Delays, 1)
+	time.Sleep(latency)
+}
+
+// Returns an injected error or nil. OffsetOutOfRange is only considered if allowOffsetOutOfRange is true.
+func (this *faultSchedule) failure(allowOffsetOutOfRange bool) error {
+	if allowOffsetOutOfRange && this.happens(this.config.OffsetOutOfRangeProbability) {
+		atomic.AddInt64(&this.stats.OffsetsOutOfRange, 1)
+		return ErrInjectedOffsetOutOfRange
+	}
+	if this.happens(this.config.LeaderNotAvailableProbability) {
+		atomic.AddInt64(&this.stats.LeadersNotAvailable, 1)
+		return ErrInjectedLeaderNotAvailable
+	}
+	if this.happens(this.config.TimeoutProbability) {
+		atomic.AddInt64(&this.stats.Timeouts, 1)
+		return ErrInjectedTimeout
+	}
+
+	return nil
+}
+
+func (this *faultSchedule) duplicate() bool {
+	if this.happens(this.config.DuplicateProbability) {
+		atomic.AddInt64(&this.stats.Duplicates, 1)
+		return true
+	}
+	return false
+}
+
+func (this *faultSchedule) corrupt(value []byte) ([]byte, bool) {
+	if len(value) == 0 || !this.happens(this.config.CorruptionProbability) {
+		return value, false
+	}
+
+	corrupted := make([]byte, len(value))
+	copy(corrupted, value)
+	inLock(&this.lock, func() {
+		position := this.random.Intn(len(corrupted))
+		corrupted[position] ^= byte(1 + this.random.Intn(255))
+	})
+	atomic.AddInt64(&this.stats.Corruptions, 1)
+	return corrupted, true
+}
+
+func (this *faultSchedule) snapshot() FaultInjectionStats {
+	return FaultInjectionStats{
+		Delays:              atomic.LoadInt64(&this.stats.Delays),
+		OffsetsOutOfRange:   atomic.LoadInt64(&this.stats.OffsetsOutOfRange),
+		LeadersNotAvailable: atomic.LoadInt64(&this.stats.LeadersNotAvailable),
+		Timeouts:            atomic.LoadInt64(&this.stats.Timeouts),
+		Duplicates:          atomic.LoadInt64(&this.stats.Duplicates),
+		Corruptions:         atomic.LoadInt64(&this.stats.Corruptions),
+	}
+}
+
+// FaultInjectingClient implements LowLevelClient by decorating another LowLevelClient and injecting faults according to FaultInjectionConfig.
+type FaultInjectingClient struct {
+	client   LowLevelClient
+	schedule *faultSchedule
+}
+
+// Creates a new FaultInjectingClient that wraps a given LowLevelClient.
+func NewFaultInjectingClient(client LowLevelClient, config *FaultInjectionConfig) *FaultInjectingClient {
+	return &FaultInjectingClient{
+		client:   client,
+		schedule: newFaultSchedule(config),
+	}
+}
+
+// Returns a string representation of this FaultInjectingClient.
+func (this *FaultInjectingClient) String() string {
+	return fmt.Sprintf("Fault injecting %s", this.client)
+}
+
+// Initializes the underlying client. May fail with an injected error.
+func (this *FaultInjectingClient) Initialize() error {
+	this.schedule.delay()
+	if err := this.schedule.failure(false); err != nil {
+		return err
+	}
+	return this.client.Initialize()
+}
+
+// Fetches messages using the underlying client. The call may be delayed, fail with an injected error,
+// or return messages which are duplicated or have corrupted values.
+func (this *FaultInjectingClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	schedule := this.schedule.partition(topic, partition)
+	schedule.delay()
+	if err := schedule.failure(true); err != nil {
+		Debugf(this, "Injecting %s for %s:%d at offset %d", err, topic, partition, offset)
+		return nil, err
+	}
+
+	messages, err := this.client.Fetch(topic, partition, offset)
+	if err != nil {
+		return messages, err
+	}
+
+	faulty := make([]*Message, 0, len(messages))
+	for _, message := range messages {
+		if value, corrupted := schedule.corrupt(message.Value); corrupted {
+			message = corruptedCopy(message, value)
+		}
+		faulty = append(faulty, message)
+		if schedule.duplicate() {
+			duplicate := *message
+			faulty = append(faulty, &duplicate)
+		}
+	}
+
+	return faulty, nil
+}
+
+// Checks whether the given error is an injected or real OffsetOutOfRange error.
+func (this *FaultInjectingClient) IsOffsetOutOfRange(err error) bool {
+	return err == ErrInjectedOffsetOutOfRange || this.client.IsOffsetOutOfRange(err)
+}
+
+// Gets the available offset using the underlying client. May fail with an injected error.
+func (this *FaultInjectingClient) GetAvailableOffset(topic string, partition int32, offsetTime string) (int64, error) {
+	schedule := this.schedule.partition(topic, partition)
+	schedule.delay()
+	if err := schedule.failure(false); err != nil {
+		return -1, err
+	}
+	return this.client.GetAvailableOffset(topic, partition, offsetTime)
+}
+
+// Closes the underlying client.
+func (this *FaultInjectingClient) Close() {
+	this.client.Close()
+}
+
+// Returns the number of faults injected by this client so far.
+func (this *FaultInjectingClient) Stats() FaultInjectionStats {
+	return this.schedule.snapshot()
+}
+
+func corruptedCopy(message *Message, value []byte) *Message {
+	corrupted := *message
+	corrupted.Value = value
+	if _, isBytes := message.DecodedValue.([]byte); isBytes {
+		corrupted.DecodedValue = value
+	}
+	return &corrupted
+}
+
+// FaultInjectingProducer implements Producer by decorating another Producer and injecting faults according to FaultInjectionConfig.
+// Injected errors are reported via Errors() and the message is not passed to the underlying producer.
+// Messages are produced by a single goroutine, so the same seed produces the same schedule for the same sequence of messages.
+type FaultInjectingProducer struct {
+	producer   Producer
+	schedule   *faultSchedule
+	input      chan *ProducerMessage
+	errors     chan *FailedMessage
+	closed     chan bool
+	stopErrors chan struct{}
+}
+
+// Creates a new FaultInjectingProducer that wraps a given Producer.
+func NewFaultInjectingProducer(producer Producer, config *FaultInjectionConfig) *FaultInjectingProducer {
+	faultyProducer := &FaultInjectingProducer{
+		producer:   producer,
+		schedule:   newFaultSchedule(config),
+		input:      make(chan *ProducerMessage),
+		errors:     make(chan *FailedMessage),
+		closed:     make(chan bool),
+		stopErrors: make(chan struct{}),
+	}
+	go faultyProducer.produceRoutine()
+	go faultyProducer.errorsRoutine()
+
+	return faultyProducer
+}
+
+func (this *FaultInjectingProducer) String() string {
+	return "Fault injecting producer"
+}
+
+// Returns both injected and underlying producer errors. The channel is closed once Close returns,
+// or after AsyncClose once the underlying producer closes its errors channel.
+func (this *FaultInjectingProducer) Errors() <-chan *FailedMessage {
+	return this.errors
+}
+
+// Returns successfully produced messages of the underlying producer.
+func (this *FaultInjectingProducer) Successes() <-chan *ProducerMessage {
+	return this.producer.Successes()
+}
+
+// Returns a channel to write messages to.
+func (this *FaultInjectingProducer) Input() chan<- *ProducerMessage {
+	return this.input
+}
+
+// Stops accepting new messages and closes the underlying producer.
+func (this *FaultInjectingProducer) Close() error {
+	close(this.input)
+	<-this.closed
+	err := this.producer.Close()
+	close(this.stopErrors)
+	return err
+}
+
+// Stops accepting new messages and asynchronously closes the underlying producer.
+func (this *FaultInjectingProducer) AsyncClose() {
+	close(this.input)
+	go func() {
+		<-this.closed
+		this.producer.AsyncClose()
+	}()
+}
+
+// Returns the number of faults injected by this producer so far.
+func (this *FaultInjectingProducer) Stats() FaultInjectionStats {
+	return this.schedule.snapshot()
+}
+
+func (this *FaultInjectingProducer) produceRoutine() {
+	for message := range this.input {
+		this.schedule.delay()
+		if err := this.schedule.failure(false); err != nil {
+			this.errors <- &FailedMessage{message, err}
+			continue
+		}
+
+		if value, ok := message.Value.([]byte); ok {
+			if corruptedValue, corrupted := this.schedule.corrupt(value); corrupted {
+				corruptedMessage := *message
+				corruptedMessage.Value = corruptedValue
+				message = &corruptedMessage
+			}
+		}
+
+		this.producer.Input() <- message
+		if this.schedule.duplicate() {
+			duplicate := *message
+			this.producer.Input() <- &duplicate
+		}
+	}
+	this.closed <- true
+}
+
+func (this *FaultInjectingProducer) errorsRoutine() {
+	defer close(this.errors)
+	errors := this.producer.Errors()
+	for {
+		select {
+		case failed, ok := <-errors:
+			if !ok {
+				return
+			}
+			this.errors <- failed
+		case <-this.stopErrors:
+			// the underlying producer is closed, forward the errors it still buffers
+			for {
+				select {
+				case failed, ok := <-errors:
+					if !ok {
+						return
+					}
+					this.errors <- failed
+				default:
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+var errTestOffsetOutOfRange = errors.New("offset out of range")
+
+// staticClient is a LowLevelClient serving messages from memory.
+type staticClient struct {
+	messages []*Message
+}
+
+func newStaticClient(topic string, partition int32, numMessages int) *staticClient {
+	messages := make([]*Message, numMessages)
+	for i := 0; i < numMessages; i++ {
+		messages[i] = &Message{
+			Topic:               topic,
+			Partition:           partition,
+			Offset:              int64(i),
+			Value:               []byte(fmt.Sprintf("message-%d", i)),
+			HighwaterMarkOffset: int64(numMessages),
+		}
+	}
+	return &staticClient{messages}
+}
+
+func (this *staticClient) Initialize() error { return nil }
+func (this *staticClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	if offset > int64(len(this.messages)) {
+		return nil, errTestOffsetOutOfRange
+	}
+	return this.messages[offset:], nil
+}
+func (this *staticClient) IsOffsetOutOfRange(err error) bool { return err == errTestOffsetOutOfRange }
+func (this *staticClient) GetAvailableOffset(topic string, partition int32, offsetTime string) (int64, error) {
+	if offsetTime == SmallestOffset {
+		return 0, nil
+	}
+	return int64(len(this.messages)), nil
+}
+func (this *staticClient) Close() {}
+
+func TestFaultInjectingClientIsDeterministic(t *testing.T) {
+	config := NewFaultInjectionConfig(42)
+	config.LeaderNotAvailableProbability = 0.2
+	config.TimeoutProbability = 0.1
+	config.OffsetOutOfRangeProbability = 0.1
+	config.DuplicateProbability = 0.1
+	config.CorruptionProbability = 0.1
+
+	run := func() []string {
+		client := NewFaultInjectingClient(newStaticClient("test", 0, 10), config)
+		outcomes := make([]string, 0)
+		for i := 0; i < 50; i++ {
+			messages, err := client.Fetch("test", 0, 0)
+			outcomes = append(outcomes, fmt.Sprintf("%v-%d", err, len(messages)))
+		}
+		return outcomes
+	}
+
+	assert(t, run(), run())
+
+	// the schedule of a partition does not depend on how fetches of other partitions interleave with it
+	interleaved := func(partitions []int32) map[int32][]string {
+		client := NewFaultInjectingClient(newStaticClient("test", 0, 10), config)
+		outcomes := make(map[int32][]string)
+		for i := 0; i < 50; i++ {
+			for _, partition := range partitions {
+				messages, err := client.Fetch("test", partition, 0)
+				outcomes[partition] = append(outcomes[partition], fmt.Sprintf("%v-%d", err, len(messages)))
+			}
+		}
+		return outcomes
+	}
+	assert(t, interleaved([]int32{0, 1}), interleaved([]int32{1, 0}))
+	assertNot(t, interleaved([]int32{0})[0], interleaved([]int32{1})[1])
+}
+
+func TestFaultInjectingClientFaults(t *testing.T) {
+	config := NewFaultInjectionConfig(1)
+	config.DuplicateProbability = 1
+	client := NewFaultInjectingClient(newStaticClient("test", 0, 5), config)
+	messages, err := client.Fetch("test", 0, 0)
+	assert(t, err, nil)
+	assert(t, len(messages), 10)
+	assert(t, client.Stats().Duplicates, int64(5))
+
+	config = NewFaultInjectionConfig(1)
+	config.CorruptionProbability = 1
+	original := newStaticClient("test", 0, 5)
+	client = NewFaultInjectingClient(original, config)
+	messages, err = client.Fetch("test", 0, 0)
+	assert(t, err, nil)
+	for i, message := range messages {
+		if bytes.Equal(message.Value, original.messages[i].Value) {
+			t.Errorf("Message %s should be corrupted", message)
+		}
+	}
+
+	config = NewFaultInjectionConfig(1)
+	config.OffsetOutOfRangeProbability = 1
+	client = NewFaultInjectingClient(newStaticClient("test", 0, 5), config)
+	_, err = client.Fetch("test", 0, 0)
+	assert(t, client.IsOffsetOutOfRange(err), true)
+	assert(t, client.IsOffsetOutOfRange(errTestOffsetOutOfRange), true)
+	assert(t, client.IsOffsetOutOfRange(ErrInjectedTimeout), false)
+
+	config = NewFaultInjectionConfig(1)
+	config.LatencyProbability = 1
+	config.MinLatency = 10 * time.Millisecond
+	config.MaxLatency = 20 * time.Millisecond
+	client = NewFaultInjectingClient(newStaticClient("test", 0, 5), config)
+	start := time.Now()
+	client.Fetch("test", 0, 0)
+	if elapsed := time.Since(start); elapsed < config.MinLatency {
+		t.Errorf("Fetch should be delayed for at least %s, actual %s", config.MinLatency, elapsed)
+	}
+}
+
+// channelProducer is a Producer reporting every message as failed.
+type channelProducer struct {
+	input     chan *ProducerMessage
+	errors    chan *FailedMessage
+	successes chan *ProducerMessage
+}
+
+func newChannelProducer() *channelProducer {
+	producer := &channelProducer{
+		input:     make(chan *ProducerMessage),
+		errors:    make(chan *FailedMessage, 10),
+		successes: make(chan *ProducerMessage),
+	}
+	go func() {
+		for message := range producer.input {
+			producer.errors <- &FailedMessage{message, sarama.ErrMessageSizeTooLarge}
+		}
+	}()
+	return producer
+}
+
+func (this *channelProducer) Errors() <-chan *FailedMessage      { return this.errors }
+func (this *channelProducer) Successes() <-chan *ProducerMessage { return this.successes }
+func (this *channelProducer) Input() chan<- *ProducerMessage     { return this.input }
+func (this *channelProducer) Close() error                       { close(this.input); return nil }
+func (this *channelProducer) AsyncClose()                        { close(this.input) }
+
+func TestFaultInjectingProducerErrors(t *testing.T) {
+	config := NewFaultInjectionConfig(1)
+	config.TimeoutProbability = 1
+	producer := NewFaultInjectingProducer(newChannelProducer(), config)
+
+	go func() {
+		producer.Input() <- &ProducerMessage{Topic: "test", Value: []byte("injected")}
+		producer.Close()
+	}()
+
+	// injected errors are sarama errors, and ranging over Errors() ends after Close
+	failures := make([]error, 0)
+	for failed := range producer.Errors() {
+		failures = append(failures, failed.err)
+		if _, ok := failed.err.(sarama.KError); !ok {
+			t.Errorf("Expected a sarama.KError, got %v", failed.err)
+		}
+	}
+	assert(t, failures, []error{sarama.ErrRequestTimedOut})
+}
@@ -16,8 +16,11 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"time"
 )
@@ -36,12 +39,26 @@ type consumerFetcherManager struct {
 
 	metrics *ConsumerMetrics
 	client  LowLevelClient
+
+	// Skipped regions of corrupted data waiting to be written to the QuarantineSink, so a slow sink does not stall fetching.
+	quarantined        chan *QuarantinedData
+	quarantineFinished chan bool
+	// Guards sending to quarantined against closing it, as partitions may still be removed from fetchers while the manager is closed.
+	quarantineLock   sync.Mutex
+	quarantineClosed bool
 }
 
+// Number of skipped regions that may wait for the QuarantineSink before fetchers skipping more corrupted data block.
+const quarantineQueueSize = 100
+
 func (m *consumerFetcherManager) String() string {
 	return fmt.Sprintf("%s-manager", m.config.Consumerid)
 }
 
+func (m *consumerFetcherManager) LogFields() Fields {
+	return Fields{"consumer": m.config.Consumerid, "group": m.config.Groupid}
+}
+
 func newConsumerFetcherManager(config *ConsumerConfig, disconnectChannelsForPartition chan TopicAndPartition, metrics *ConsumerMetrics) *consumerFetcherManager {
 	manager := &consumerFetcherManager{
 		config:                         config,
@@ -51,16 +68,52 @@ func newConsumerFetcherManager(config *ConsumerConfig, disconnectChannelsForPart
 		disconnectChannelsForPartition: disconnectChannelsForPartition,
 		client:  config.LowLevelClient,
 		metrics: metrics,
+
+		quarantined:        make(chan *QuarantinedData, quarantineQueueSize),
+		quarantineFinished: make(chan bool),
 	}
 	manager.updatedCond = sync.NewCond(manager.updateLock.RLocker())
+	go manager.quarantineRoutine()
 
 	return manager
 }
 
+// quarantine counts a skipped region of corrupted data and queues it for the QuarantineSink and the CorruptedDataCallback.
+func (m *consumerFetcherManager) quarantine(region *QuarantinedData) {
+	Errorw(m, "Skipped corrupted data", Fields{"topic": region.Topic, "partition": region.Partition, "region": region})
+	m.metrics.quarantinedRegions().Inc(1)
+	m.metrics.quarantinedOffsets().Inc(region.EndOffset - region.StartOffset + 1)
+
+	inLock(&m.quarantineLock, func() {
+		if m.quarantineClosed {
+			Warnw(m, "Manager is closed, dropping corrupted data instead of quarantining it", Fields{"topic": region.Topic, "partition": region.Partition, "region": region})
+			return
+		}
+		// the quarantine routine does not need the lock, so a full queue is drained meanwhile
+		m.quarantined <- region
+	})
+}
+
+// quarantineRoutine writes the queued regions of corrupted data to the configured QuarantineSink and notifies the CorruptedDataCallback
+// until the manager is closed.
+func (m *consumerFetcherManager) quarantineRoutine() {
+	for region := range m.quarantined {
+		if m.config.QuarantineSink != nil {
+			if err := m.config.QuarantineSink.Write(region); err != nil {
+				Errorw(m, "Failed to quarantine corrupted data", Fields{"topic": region.Topic, "partition": region.Partition, "region": region, "error": err})
+			}
+		}
+		if m.config.CorruptedDataCallback != nil {
+			m.config.CorruptedDataCallback(region)
+		}
+	}
+	m.quarantineFinished <- true
+}
+
 func (m *consumerFetcherManager) startConnections(topicInfos []*partitionTopicInfo, numStreams int) {
 	if Logger.IsAllowed(DebugLevel) {
 		Debug(m, "Fetcher Manager started")
-		Debugf(m, "TopicInfos = %s", topicInfos)
+		Debugw(m, "Got topic infos", Fields{"topicInfos": topicInfos})
 	}
 	m.numStreams = numStreams
 
@@ -84,8 +137,8 @@ func (m *consumerFetcherManager) startConnections(topicInfos []*partitionTopicIn
 		}
 
 		if Logger.IsAllowed(DebugLevel) {
-			Debugf(m, "Got new list of partitions to process %v", newPartitionMap)
-			Debugf(m, "All partitions map: %v", m.partitionMap)
+			Debugw(m, "Got new list of partitions to process", Fields{"partitions": newPartitionMap})
+			Debugw(m, "All partitions map", Fields{"partitions": m.partitionMap})
 		}
 		//receive obsolete partitions map
 		for k := range newPartitionMap {
@@ -98,17 +151,17 @@ func (m *consumerFetcherManager) startConnections(topicInfos []*partitionTopicIn
 			topicPartitionsToRemove = append(topicPartitionsToRemove, tp)
 		}
 		if Logger.IsAllowed(DebugLevel) {
-			Debugf(m, "There are obsolete partitions %v", topicPartitionsToRemove)
+			Debugw(m, "There are obsolete partitions", Fields{"partitions": topicPartitionsToRemove})
 		}
 
 		//removing unnecessary partition-fetchRoutine bindings
 		for _, fetcher := range m.fetcherRoutineMap {
 			if Logger.IsAllowed(DebugLevel) {
-				Debugf(m, "Fetcher %s parition map before obsolete partitions removal", fetcher, fetcher.partitionMap)
+				Debugw(m, "Fetcher partition map before obsolete partitions removal", Fields{"fetcher": fetcher, "partitions": fetcher.partitionMap})
 			}
 			fetcher.removePartitions(topicPartitionsToRemove)
 			if Logger.IsAllowed(DebugLevel) {
-				Debugf(m, "Fetcher %s parition map after obsolete partitions removal", fetcher, fetcher.partitionMap)
+				Debugw(m, "Fetcher partition map after obsolete partitions removal", Fields{"fetcher": fetcher, "partitions": fetcher.partitionMap})
 			}
 		}
 		for tp := range m.partitionMap {
@@ -125,7 +178,7 @@ func (m *consumerFetcherManager) startConnections(topicInfos []*partitionTopicIn
 
 		m.updateInProgress = false
 		if Logger.IsAllowed(DebugLevel) {
-			Debugf(m, "Applied new partition map %v", m.partitionMap)
+			Debugw(m, "Applied new partition map", Fields{"partitions": m.partitionMap})
 		}
 	})
 
@@ -137,7 +190,7 @@ func (m *consumerFetcherManager) startConnections(topicInfos []*partitionTopicIn
 
 func (m *consumerFetcherManager) addFetcherForPartitions(partitionInfos map[TopicAndPartition]*partitionTopicInfo) {
 	if Logger.IsAllowed(InfoLevel) {
-		Infof(m, "Adding fetcher for partitions %v", partitionInfos)
+		Infow(m, "Adding fetcher for partitions", Fields{"partitions": partitionInfos})
 	}
 	partitionsPerFetcher := make(map[int]map[TopicAndPartition]*partitionTopicInfo)
 	for topicAndPartition, info := range partitionInfos {
@@ -149,12 +202,12 @@ func (m *consumerFetcherManager) addFetcherForPartitions(partitionInfos map[Topi
 	}
 
 	if Logger.IsAllowed(DebugLevel) {
-		Debugf(m, "partitionsPerFetcher: %v", partitionsPerFetcher)
+		Debugw(m, "Assigned partitions to fetchers", Fields{"partitionsPerFetcher": partitionsPerFetcher})
 	}
 	for fetcherId, partitionInfos := range partitionsPerFetcher {
 		if m.fetcherRoutineMap[fetcherId] == nil {
 			if Logger.IsAllowed(DebugLevel) {
-				Debugf(m, "Starting new fetcher")
+				Debug(m, "Starting new fetcher")
 			}
 			fetcherRoutine := newConsumerFetcher(m,
 				fmt.Sprintf("ConsumerFetcherRoutine-%s-%d", m.config.Consumerid, fetcherId))
@@ -166,6 +219,24 @@ func (m *consumerFetcherManager) addFetcherForPartitions(partitionInfos map[Topi
 	}
 }
 
+// fetcherAssignments returns the partitions each fetcher routine is responsible for, keyed by fetcher name.
+func (m *consumerFetcherManager) fetcherAssignments() map[string][]*TopicAndPartition {
+	assignments := make(map[string][]*TopicAndPartition)
+	inReadLock(&m.updateLock, func() {
+		for _, fetcher := range m.fetcherRoutineMap {
+			partitions := make([]*TopicAndPartition, 0)
+			inReadLock(&fetcher.lock, func() {
+				for topicPartition := range fetcher.partitionMap {
+					partitions = append(partitions, &TopicAndPartition{topicPartition.Topic, topicPartition.Partition})
+				}
+			})
+			sort.Sort(byTopicAndPartition(partitions))
+			assignments[fetcher.name] = partitions
+		}
+	})
+	return assignments
+}
+
 func (m *consumerFetcherManager) getFetcherId(topic string, partitionId int32) int {
 	return int(math.Abs(float64(31*hash(topic)+partitionId))) % int(m.numStreams)
 }
@@ -176,7 +247,7 @@ func (m *consumerFetcherManager) shutdownIdleFetchers() {
 	}
 	for key, fetcher := range m.fetcherRoutineMap {
 		if len(fetcher.partitionMap) <= 0 {
-			Debugf(m, "There is idle fetcher: %s", fetcher)
+			Debugw(m, "There is idle fetcher", Fields{"fetcher": fetcher})
 			<-fetcher.close()
 			delete(m.fetcherRoutineMap, key)
 		}
@@ -195,11 +266,11 @@ func (m *consumerFetcherManager) closeAllFetchers() {
 			delete(m.partitionMap, k)
 		}
 
-		Debugf(m, "Trying to close %d fetchers", len(m.fetcherRoutineMap))
+		Debugw(m, "Trying to close fetchers", Fields{"fetchers": len(m.fetcherRoutineMap)})
 		for key, fetcher := range m.fetcherRoutineMap {
-			Debugf(m, "Closing %s", fetcher)
+			Debugw(m, "Closing fetcher", Fields{"fetcher": fetcher})
 			<-fetcher.close()
-			Debugf(m, "Closed %s", fetcher)
+			Debugw(m, "Closed fetcher", Fields{"fetcher": fetcher})
 			delete(m.fetcherRoutineMap, key)
 		}
 	})
@@ -213,6 +284,12 @@ func (m *consumerFetcherManager) close() <-chan bool {
 		m.closeAllFetchers()
 		m.updatedCond.Broadcast()
 		m.partitionMap = nil
+		// fetchers have reported their open regions of corrupted data when closed
+		inLock(&m.quarantineLock, func() {
+			m.quarantineClosed = true
+			close(m.quarantined)
+		})
+		<-m.quarantineFinished
 		m.closeFinished <- true
 		Info(m, "Successfully closed all fetcher manager routines")
 	}()
@@ -228,12 +305,20 @@ type consumerFetcherRoutine struct {
 	closeFinished chan bool
 	fetchStopper  chan bool
 	askNext       chan TopicAndPartition
+
+	// Regions of corrupted data being skipped, keyed by partition. Accessed by the fetcher goroutine under the read lock
+	// and by removePartitions under the write lock.
+	corruptedRegions map[TopicAndPartition]*QuarantinedData
 }
 
 func (f *consumerFetcherRoutine) String() string {
 	return f.name
 }
 
+func (f *consumerFetcherRoutine) LogFields() Fields {
+	return Fields{"consumer": f.manager.config.Consumerid, "group": f.manager.config.Groupid, "fetcher": f.name}
+}
+
 func newConsumerFetcher(m *consumerFetcherManager, name string) *consumerFetcherRoutine {
 	return &consumerFetcherRoutine{
 		manager:       m,
@@ -242,6 +327,8 @@ func newConsumerFetcher(m *consumerFetcherManager, name string) *consumerFetcher
 		closeFinished: make(chan bool),
 		fetchStopper:  make(chan bool),
 		askNext:       make(chan TopicAndPartition, m.config.AskNextChannelSize),
+
+		corruptedRegions: make(map[TopicAndPartition]*QuarantinedData),
 	}
 }
 
@@ -260,39 +347,52 @@ func (f *consumerFetcherRoutine) start() {
 				timestamp := time.Now().UnixNano() / int64(time.Millisecond)
 				f.manager.metrics.fetchersIdle().Update(time.Since(ts))
 				if Logger.IsAllowed(DebugLevel) {
-					Debugf(f, "Received asknext for %s", &nextTopicPartition)
+					Debugw(f, "Received asknext", Fields{"topic": nextTopicPartition.Topic, "partition": nextTopicPartition.Partition})
 				}
+				var backoff time.Duration
 				inReadLock(&f.lock, func() {
 					if !f.manager.shuttingDown {
 						if Logger.IsAllowed(DebugLevel) {
-							Debugf(f, "Partition map: %v", f.partitionMap)
+							Debugw(f, "Partition map", Fields{"partitions": f.partitionMap})
 						}
 						if _, exists := f.partitionMap[nextTopicPartition]; !exists {
 							if Logger.IsAllowed(WarnLevel) {
-								Warnf(f, "Message buffer for partition %s has been terminated. Aborting processing task...", nextTopicPartition)
+								Warnw(f, "Message buffer has been terminated. Aborting processing task...", Fields{"topic": nextTopicPartition.Topic, "partition": nextTopicPartition.Partition})
 							}
 							return
 						}
-						offset := f.partitionMap[nextTopicPartition].FetchedOffset
+						offset := f.partitionMap[nextTopicPartition].fetchedOffset()
 
 						var messages []*Message
 						var err error
+						_, span := f.manager.config.Tracer.StartSpan(context.Background(), SpanFetch,
+							partitionAttributes(nextTopicPartition, SpanAttribute{"kafka.offset", offset})...)
 						f.manager.metrics.fetchDuration().Time(func() {
 							messages, err = f.manager.client.Fetch(nextTopicPartition.Topic, nextTopicPartition.Partition, offset)
 						})
-
+						span.SetAttributes(SpanAttribute{"kafka.messages", len(messages)})
 						if err != nil {
+							span.RecordError(err)
+						}
+						span.End()
+
+						if corrupted, ok := err.(*CorruptedDataError); ok && f.manager.config.skipsCorruptedMessages() {
+							f.skipCorruptedData(nextTopicPartition, offset, corrupted)
+						} else if err != nil {
 							if offset > -1 { // Negative offsets are obviously out of range but don't spam the logs...
 								if f.manager.client.IsOffsetOutOfRange(err) {
-									Warnf(f, "Current offset %d for topic %s and partition %s is out of range.", offset, nextTopicPartition.Topic, nextTopicPartition.Partition)
+									Warnw(f, "Current offset is out of range", Fields{"topic": nextTopicPartition.Topic, "partition": nextTopicPartition.Partition, "offset": offset})
 									f.handleOffsetOutOfRange(&nextTopicPartition)
 								} else {
-									Warnf(f, "Got a fetch error for topic %s, partition %d: %s", nextTopicPartition.Topic, nextTopicPartition.Partition, err)
-									//TODO new backoff type?
-									panic(fmt.Errorf("Got a fetch error for topic %s, partition %d: %s", nextTopicPartition.Topic, nextTopicPartition.Partition, err))
-									//time.Sleep(1 * time.Second)
+									// Leader changes and timeouts are expected during broker failures, so back off and let the
+									// message buffer ask for the same offset again. The backoff happens outside of the lock
+									// so that partitions can be removed meanwhile.
+									Warnw(f, "Got a fetch error. Retrying...", Fields{"topic": nextTopicPartition.Topic, "partition": nextTopicPartition.Partition, "error": err, "backoff": f.manager.config.RefreshLeaderBackoff})
+									backoff = f.manager.config.RefreshLeaderBackoff
 								}
 							}
+						} else {
+							f.closeCorruptedRegion(nextTopicPartition)
 						}
 
 						if f.manager.config.Debug {
@@ -304,6 +404,15 @@ func (f *consumerFetcherRoutine) start() {
 						f.processPartitionData(nextTopicPartition, messages)
 					}
 				})
+
+				if backoff > 0 {
+					select {
+					case <-time.After(backoff):
+					case <-f.fetchStopper:
+						Info(f, "Stopped fetcher")
+						return
+					}
+				}
 			}
 		case <-f.fetchStopper:
 			{
@@ -318,23 +427,25 @@ func (f *consumerFetcherRoutine) start() {
 
 func (f *consumerFetcherRoutine) addPartitions(partitionTopicInfos map[TopicAndPartition]*partitionTopicInfo) {
 	if Logger.IsAllowed(DebugLevel) {
-		Debugf(f, "Adding partitions: %v", partitionTopicInfos)
+		Debugw(f, "Adding partitions", Fields{"partitions": partitionTopicInfos})
 	}
 	newPartitions := make(map[TopicAndPartition]chan TopicAndPartition)
 	inWriteLock(&f.lock, func() {
 		for topicAndPartition, info := range partitionTopicInfos {
 			if _, contains := f.partitionMap[topicAndPartition]; !contains {
 				f.partitionMap[topicAndPartition] = info
-				validOffset := info.FetchedOffset + 1
-				if isOffsetInvalid(info.FetchedOffset) {
+				validOffset := info.fetchedOffset() + 1
+				if info.fetchedOffset() == BeforeFirstOffset {
+					f.partitionMap[topicAndPartition].setFetchedOffset(0)
+				} else if isOffsetInvalid(info.fetchedOffset()) {
 					f.handleOffsetOutOfRange(&topicAndPartition)
 				} else {
-					f.partitionMap[topicAndPartition].FetchedOffset = validOffset
+					f.partitionMap[topicAndPartition].setFetchedOffset(validOffset)
 				}
 				f.partitionMap[topicAndPartition].Buffer.start(f.askNext)
 				newPartitions[topicAndPartition] = f.askNext
 				if Logger.IsAllowed(DebugLevel) {
-					Debugf(f, "Owner of %s", topicAndPartition)
+					Debugw(f, "Owner of partition", Fields{"topic": topicAndPartition.Topic, "partition": topicAndPartition.Partition})
 				}
 			}
 		}
@@ -342,7 +453,7 @@ func (f *consumerFetcherRoutine) addPartitions(partitionTopicInfos map[TopicAndP
 
 	for topicAndPartition, askNext := range newPartitions {
 		if Logger.IsAllowed(DebugLevel) {
-			Debugf(f, "Sending ask next to %s for %s", f, topicAndPartition)
+			Debugw(f, "Sending ask next", Fields{"topic": topicAndPartition.Topic, "partition": topicAndPartition.Partition})
 		}
 	Loop:
 		for {
@@ -360,7 +471,7 @@ func (f *consumerFetcherRoutine) addPartitions(partitionTopicInfos map[TopicAndP
 			}
 		}
 		if Logger.IsAllowed(DebugLevel) {
-			Debugf(f, "Sent ask next to %s for %s", f, topicAndPartition)
+			Debugw(f, "Sent ask next", Fields{"topic": topicAndPartition.Topic, "partition": topicAndPartition.Partition})
 		}
 	}
 }
@@ -368,29 +479,65 @@ func (f *consumerFetcherRoutine) addPartitions(partitionTopicInfos map[TopicAndP
 func (f *consumerFetcherRoutine) processPartitionData(topicAndPartition TopicAndPartition, messages []*Message) {
 	if Logger.IsAllowed(TraceLevel) {
 		Trace(f, "Trying to acquire lock for partition processing")
-		Tracef(f, "Processing partition data for %s", topicAndPartition)
+		Tracew(f, "Processing partition data", Fields{"topic": topicAndPartition.Topic, "partition": topicAndPartition.Partition})
 	}
 	if len(messages) > 0 {
-		f.partitionMap[topicAndPartition].FetchedOffset = messages[len(messages)-1].Offset + 1
+		setFetched(messages, time.Now())
+		f.partitionMap[topicAndPartition].setFetchedOffset(messages[len(messages)-1].Offset + 1)
+		f.manager.metrics.updateHighwaterMark(topicAndPartition, messages[len(messages)-1].HighwaterMarkOffset)
 	}
 	go f.partitionMap[topicAndPartition].Buffer.addBatch(messages)
 	if Logger.IsAllowed(TraceLevel) {
-		Tracef(f, "Sent partition data to %s", topicAndPartition)
+		Tracew(f, "Sent partition data", Fields{"topic": topicAndPartition.Topic, "partition": topicAndPartition.Partition})
 	}
 }
 
+// skipCorruptedData moves the fetch offset past a corrupted offset and remembers it as a part of the corrupted region of the partition.
+func (f *consumerFetcherRoutine) skipCorruptedData(topicAndPartition TopicAndPartition, offset int64, corrupted *CorruptedDataError) {
+	Warnw(f, "Skipping corrupted data", Fields{"topic": topicAndPartition.Topic, "partition": topicAndPartition.Partition, "offset": offset, "error": corrupted.Cause})
+	region, exists := f.corruptedRegions[topicAndPartition]
+	if !exists {
+		region = &QuarantinedData{
+			Topic:       topicAndPartition.Topic,
+			Partition:   topicAndPartition.Partition,
+			StartOffset: offset,
+		}
+		f.corruptedRegions[topicAndPartition] = region
+	}
+	region.EndOffset = offset
+	// offsets of a single corrupted record batch all report the whole batch
+	if !bytes.HasSuffix(region.Payload, corrupted.Payload) {
+		region.Payload = append(region.Payload, corrupted.Payload...)
+	}
+	region.Reasons = append(region.Reasons, corrupted.Cause.Error())
+
+	f.partitionMap[topicAndPartition].setFetchedOffset(offset + 1)
+}
+
+// closeCorruptedRegion reports the corrupted region of a given partition, if any, once the data is readable again
+// or the partition is removed from this fetcher.
+func (f *consumerFetcherRoutine) closeCorruptedRegion(topicAndPartition TopicAndPartition) {
+	region, exists := f.corruptedRegions[topicAndPartition]
+	if !exists {
+		return
+	}
+	delete(f.corruptedRegions, topicAndPartition)
+
+	region.Timestamp = time.Now()
+	f.manager.quarantine(region)
+}
+
 func (f *consumerFetcherRoutine) handleOffsetOutOfRange(topicAndPartition *TopicAndPartition) {
 	newOffset, err := f.manager.client.GetAvailableOffset(topicAndPartition.Topic, topicAndPartition.Partition, f.manager.config.AutoOffsetReset)
 	if err != nil {
-		Errorf(f, "Cannot get available offset for %s. Reason: %s", topicAndPartition, err)
+		Errorw(f, "Cannot get available offset", Fields{"topic": topicAndPartition.Topic, "partition": topicAndPartition.Partition, "error": err})
 		return
 	}
 
 	// Do not use a lock here just because it's faster and it will be checked afterwards if we should still fetch that TopicPartition
 	// This just guarantees we dont get a nil pointer dereference here
 	if topicInfo, exists := f.partitionMap[*topicAndPartition]; exists {
-		topicInfo.FetchedOffset = newOffset
-		f.partitionMap[*topicAndPartition].FetchedOffset = newOffset
+		topicInfo.setFetchedOffset(newOffset)
 	}
 }
 
@@ -409,6 +556,8 @@ func (f *consumerFetcherRoutine) removePartitions(partitions []TopicAndPartition
 	inWriteLock(&f.lock, func() {
 		for _, topicAndPartition := range partitions {
 			delete(f.partitionMap, topicAndPartition)
+			// the partition may never be fetched by this fetcher again, so do not wait for readable data
+			f.closeCorruptedRegion(topicAndPartition)
 		}
 	})
 }
@@ -0,0 +1,281 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const fileOffsetStorageVersion = 1
+
+// FileOffsetStorage implements BatchOffsetStorage and keeps offsets in a local JSON file, so consumers started with
+// StartStaticPartitions depend neither on ZooKeeper nor on Kafka to store offsets.
+// Every commit rewrites the file atomically: the new contents are written and synced to a temporary file which then replaces
+// the previous file with a rename. A crash at any point leaves either the previous or the new offsets on disk, never a mix of both.
+type FileOffsetStorage struct {
+	path    string
+	offsets map[string]map[TopicAndPartition]OffsetAndMetadata
+	lock    sync.Mutex
+}
+
+// fileOffsets is the on-disk and export format of FileOffsetStorage.
+type fileOffsets struct {
+	Version int                           `json:"version"`
+	Groups  map[string][]*fileOffsetEntry `json:"groups"`
+}
+
+type fileOffsetEntry struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Metadata  string `json:"metadata,omitempty"`
+}
+
+// Creates a new FileOffsetStorage keeping offsets in a file at a given path. Offsets already stored in the file are loaded.
+// Returns an error if the existing file cannot be read.
+func NewFileOffsetStorage(path string) (*FileOffsetStorage, error) {
+	storage := &FileOffsetStorage{
+		path:    path,
+		offsets: make(map[string]map[TopicAndPartition]OffsetAndMetadata),
+	}
+
+	// A leftover temporary file means a crash before the rename, so the file at path still holds the last complete commit.
+	if err := os.Remove(storage.tempPath()); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return storage, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	offsets, err := readFileOffsets(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load offsets from %s: %s", path, err)
+	}
+	storage.offsets = offsets
+
+	return storage, nil
+}
+
+func (this *FileOffsetStorage) String() string {
+	return fmt.Sprintf("File offset storage %s", this.path)
+}
+
+// Gets the offset for a given group, topic and partition. Returns InvalidOffset if no offset has been committed.
+func (this *FileOffsetStorage) GetOffset(group string, topic string, partition int32) (int64, error) {
+	topicPartition := &TopicAndPartition{topic, partition}
+	offsets, err := this.GetOffsets(group, []*TopicAndPartition{topicPartition})
+	if err != nil {
+		return InvalidOffset, err
+	}
+	return offsets[*topicPartition].Offset, nil
+}
+
+// Commits the given offset for a given group, topic and partition and persists it to disk.
+func (this *FileOffsetStorage) CommitOffset(group string, topic string, partition int32, offset int64) error {
+	return this.CommitOffsets(group, map[TopicAndPartition]OffsetAndMetadata{
+		TopicAndPartition{topic, partition}: OffsetAndMetadata{Offset: offset},
+	})
+}
+
+// Gets the offsets and metadata for a given group and topic partitions. Partitions without a committed offset are mapped to InvalidOffset.
+func (this *FileOffsetStorage) GetOffsets(group string, topicPartitions []*TopicAndPartition) (map[TopicAndPartition]OffsetAndMetadata, error) {
+	offsets := make(map[TopicAndPartition]OffsetAndMetadata)
+	inLock(&this.lock, func() {
+		for _, topicPartition := range topicPartitions {
+			offset, exists := this.offsets[group][*topicPartition]
+			if !exists {
+				offset = OffsetAndMetadata{Offset: InvalidOffset}
+			}
+			offsets[*topicPartition] = offset
+		}
+	})
+	return offsets, nil
+}
+
+// Commits the given offsets and metadata for a given group and persists them to disk with a single write.
+// If persisting fails the offsets are not committed.
+func (this *FileOffsetStorage) CommitOffsets(group string, offsets map[TopicAndPartition]OffsetAndMetadata) error {
+	var err error
+	inLock(&this.lock, func() {
+		updated := copyFileOffsets(this.offsets)
+		if _, exists := updated[group]; !exists {
+			updated[group] = make(map[TopicAndPartition]OffsetAndMetadata)
+		}
+		for topicPartition, offset := range offsets {
+			updated[group][topicPartition] = offset
+		}
+
+		if err = this.persist(updated); err == nil {
+			this.offsets = updated
+		}
+	})
+	return err
+}
+
+// Writes all stored offsets to a given writer in JSON format. The format is the same as the format of the offsets file.
+func (this *FileOffsetStorage) Export(writer io.Writer) error {
+	var err error
+	inLock(&this.lock, func() {
+		err = writeFileOffsets(writer, this.offsets)
+	})
+	return err
+}
+
+// Reads offsets in the format written by Export from a given reader and commits them. Offsets of groups and partitions
+// not present in the input are kept. Nothing is committed if the input is invalid.
+func (this *FileOffsetStorage) Import(reader io.Reader) error {
+	imported, err := readFileOffsets(reader)
+	if err != nil {
+		return err
+	}
+
+	inLock(&this.lock, func() {
+		updated := copyFileOffsets(this.offsets)
+		for group, offsets := range imported {
+			if _, exists := updated[group]; !exists {
+				updated[group] = make(map[TopicAndPartition]OffsetAndMetadata)
+			}
+			for topicPartition, offset := range offsets {
+				updated[group][topicPartition] = offset
+			}
+		}
+
+		if err = this.persist(updated); err == nil {
+			this.offsets = updated
+		}
+	})
+	return err
+}
+
+func (this *FileOffsetStorage) tempPath() string {
+	return this.path + ".tmp"
+}
+
+// persist atomically replaces the offsets file with given offsets. Must be called with the lock held.
+func (this *FileOffsetStorage) persist(offsets map[string]map[TopicAndPartition]OffsetAndMetadata) error {
+	temp, err := os.OpenFile(this.tempPath(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileOffsets(temp, offsets); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(this.tempPath(), this.path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash.
+	dir, err := os.Open(filepath.Dir(this.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func writeFileOffsets(writer io.Writer, offsets map[string]map[TopicAndPartition]OffsetAndMetadata) error {
+	contents := &fileOffsets{
+		Version: fileOffsetStorageVersion,
+		Groups:  make(map[string][]*fileOffsetEntry),
+	}
+	for group, groupOffsets := range offsets {
+		entries := make([]*fileOffsetEntry, 0, len(groupOffsets))
+		for topicPartition, offset := range groupOffsets {
+			entries = append(entries, &fileOffsetEntry{
+				Topic:     topicPartition.Topic,
+				Partition: topicPartition.Partition,
+				Offset:    offset.Offset,
+				Metadata:  offset.Metadata,
+			})
+		}
+		sort.Sort(byFileOffsetEntry(entries))
+		contents.Groups[group] = entries
+	}
+
+	encoded, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(encoded)
+	return err
+}
+
+func readFileOffsets(reader io.Reader) (map[string]map[TopicAndPartition]OffsetAndMetadata, error) {
+	encoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := &fileOffsets{}
+	if err := json.Unmarshal(encoded, contents); err != nil {
+		return nil, err
+	}
+	if contents.Version != fileOffsetStorageVersion {
+		return nil, fmt.Errorf("Unsupported offsets version %d", contents.Version)
+	}
+
+	offsets := make(map[string]map[TopicAndPartition]OffsetAndMetadata)
+	for group, entries := range contents.Groups {
+		offsets[group] = make(map[TopicAndPartition]OffsetAndMetadata)
+		for _, entry := range entries {
+			offsets[group][TopicAndPartition{entry.Topic, entry.Partition}] = OffsetAndMetadata{Offset: entry.Offset, Metadata: entry.Metadata}
+		}
+	}
+	return offsets, nil
+}
+
+func copyFileOffsets(offsets map[string]map[TopicAndPartition]OffsetAndMetadata) map[string]map[TopicAndPartition]OffsetAndMetadata {
+	copied := make(map[string]map[TopicAndPartition]OffsetAndMetadata)
+	for group, groupOffsets := range offsets {
+		copied[group] = make(map[TopicAndPartition]OffsetAndMetadata)
+		for topicPartition, offset := range groupOffsets {
+			copied[group][topicPartition] = offset
+		}
+	}
+	return copied
+}
+
+type byFileOffsetEntry []*fileOffsetEntry
+
+func (a byFileOffsetEntry) Len() int      { return len(a) }
+func (a byFileOffsetEntry) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byFileOffsetEntry) Less(i, j int) bool {
+	if a[i].Topic != a[j].Topic {
+		return a[i].Topic < a[j].Topic
+	}
+	return a[i].Partition < a[j].Partition
+}
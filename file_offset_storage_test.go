@@ -0,0 +1,178 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func tempOffsetsPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "offsets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "offsets.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestFileOffsetStorageSurvivesRestart(t *testing.T) {
+	path, cleanup := tempOffsetsPath(t)
+	defer cleanup()
+
+	storage, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	offset, err := storage.GetOffset("group", "topic", 0)
+	assert(t, err, nil)
+	assert(t, offset, InvalidOffset)
+
+	assert(t, storage.CommitOffset("group", "topic", 0, 10), nil)
+	assert(t, storage.CommitOffsets("group", map[TopicAndPartition]OffsetAndMetadata{
+		TopicAndPartition{"topic", 1}: OffsetAndMetadata{Offset: 20, Metadata: "consumer-1"},
+	}), nil)
+
+	restarted, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	offsets, err := restarted.GetOffsets("group", []*TopicAndPartition{&TopicAndPartition{"topic", 0}, &TopicAndPartition{"topic", 1}})
+	assert(t, err, nil)
+	assert(t, offsets[TopicAndPartition{"topic", 0}], OffsetAndMetadata{Offset: 10})
+	assert(t, offsets[TopicAndPartition{"topic", 1}], OffsetAndMetadata{Offset: 20, Metadata: "consumer-1"})
+}
+
+func TestFileOffsetStorageCrashBeforeRename(t *testing.T) {
+	path, cleanup := tempOffsetsPath(t)
+	defer cleanup()
+
+	storage, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	assert(t, storage.CommitOffset("group", "topic", 0, 10), nil)
+
+	// A crash while writing the next commit leaves a partially written temporary file behind.
+	assert(t, ioutil.WriteFile(path+".tmp", []byte(`{"version":1,"groups":{"group":[{"topic":"topic","partition":0,"off`), 0644), nil)
+
+	restarted, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	offset, _ := restarted.GetOffset("group", "topic", 0)
+	assert(t, offset, int64(10))
+	_, err = os.Stat(path + ".tmp")
+	assert(t, os.IsNotExist(err), true)
+}
+
+func TestFileOffsetStorageFailedCommit(t *testing.T) {
+	path, cleanup := tempOffsetsPath(t)
+	defer cleanup()
+
+	storage, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	assert(t, storage.CommitOffset("group", "topic", 0, 10), nil)
+
+	// Make writing the temporary file fail.
+	assert(t, os.Mkdir(path+".tmp", 0755), nil)
+	assertNot(t, storage.CommitOffset("group", "topic", 0, 20), nil)
+
+	offset, _ := storage.GetOffset("group", "topic", 0)
+	assert(t, offset, int64(10))
+	assert(t, os.Remove(path+".tmp"), nil)
+	restarted, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	offset, _ = restarted.GetOffset("group", "topic", 0)
+	assert(t, offset, int64(10))
+}
+
+func TestFileOffsetStorageIsAlwaysReadable(t *testing.T) {
+	path, cleanup := tempOffsetsPath(t)
+	defer cleanup()
+
+	storage, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	assert(t, storage.CommitOffset("group", "topic", 0, 0), nil)
+
+	var wg sync.WaitGroup
+	for partition := int32(0); partition < 4; partition++ {
+		wg.Add(1)
+		go func(partition int32) {
+			defer wg.Done()
+			for offset := int64(1); offset <= 50; offset++ {
+				if err := storage.CommitOffset("group", "topic", partition, offset); err != nil {
+					t.Error(err)
+				}
+			}
+		}(partition)
+	}
+
+	done := make(chan bool)
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			restarted, err := NewFileOffsetStorage(path)
+			assert(t, err, nil)
+			for partition := int32(0); partition < 4; partition++ {
+				offset, _ := restarted.GetOffset("group", "topic", partition)
+				assert(t, offset, int64(50))
+			}
+			return
+		default:
+			contents, err := ioutil.ReadFile(path)
+			assert(t, err, nil)
+			if !json.Valid(contents) {
+				t.Fatalf("Offsets file is not valid JSON: %s", contents)
+			}
+		}
+	}
+}
+
+func TestFileOffsetStorageExportImport(t *testing.T) {
+	path, cleanup := tempOffsetsPath(t)
+	defer cleanup()
+
+	storage, err := NewFileOffsetStorage(path)
+	assert(t, err, nil)
+	storage.CommitOffset("group1", "topic", 1, 10)
+	storage.CommitOffset("group1", "topic", 0, 5)
+	storage.CommitOffset("group2", "other", 0, 7)
+
+	exported := &bytes.Buffer{}
+	assert(t, storage.Export(exported), nil)
+
+	otherPath, otherCleanup := tempOffsetsPath(t)
+	defer otherCleanup()
+	other, err := NewFileOffsetStorage(otherPath)
+	assert(t, err, nil)
+	other.CommitOffset("group1", "topic", 2, 3)
+	assert(t, other.Import(bytes.NewReader(exported.Bytes())), nil)
+
+	offsets, _ := other.GetOffsets("group1", []*TopicAndPartition{&TopicAndPartition{"topic", 0}, &TopicAndPartition{"topic", 1}, &TopicAndPartition{"topic", 2}})
+	assert(t, offsets[TopicAndPartition{"topic", 0}].Offset, int64(5))
+	assert(t, offsets[TopicAndPartition{"topic", 1}].Offset, int64(10))
+	assert(t, offsets[TopicAndPartition{"topic", 2}].Offset, int64(3))
+	offset, _ := other.GetOffset("group2", "other", 0)
+	assert(t, offset, int64(7))
+
+	assertNot(t, other.Import(strings.NewReader(`{"version":2}`)), nil)
+	assertNot(t, other.Import(strings.NewReader(`not json`)), nil)
+	offset, _ = other.GetOffset("group2", "other", 0)
+	assert(t, offset, int64(7))
+}
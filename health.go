@@ -0,0 +1,233 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HealthCheck is the result of a single health or readiness check of a consumer.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// HealthReport is the result of all health or readiness checks of a consumer. It is OK only if all its checks are OK.
+type HealthReport struct {
+	Consumer string         `json:"consumer"`
+	Group    string         `json:"group"`
+	OK       bool           `json:"ok"`
+	Checks   []*HealthCheck `json:"checks"`
+}
+
+func newHealthReport(consumer string, group string, checks ...*HealthCheck) *HealthReport {
+	report := &HealthReport{
+		Consumer: consumer,
+		Group:    group,
+		OK:       true,
+		Checks:   checks,
+	}
+	for _, check := range checks {
+		report.OK = report.OK && check.OK
+	}
+	return report
+}
+
+// Checks whether this consumer is healthy, i.e. it is connected to its coordinator, its fetchers are not stuck,
+// its offset commits are recent and none of its worker managers has reached the WorkerRetryThreshold.
+// An unhealthy consumer is unlikely to recover without a restart.
+func (c *Consumer) Health() *HealthReport {
+	return newHealthReport(c.config.Consumerid, c.config.Groupid, c.healthChecks()...)
+}
+
+// Checks whether this consumer is ready, i.e. it is healthy, it is not shutting down and its last rebalance succeeded.
+// A consumer that is not ready is expected to become ready again, e.g. once an ongoing rebalance is over.
+func (c *Consumer) Readiness() *HealthReport {
+	checks := append(c.healthChecks(), c.checkRebalance(), c.checkShutdown())
+	return newHealthReport(c.config.Consumerid, c.config.Groupid, checks...)
+}
+
+// Creates an http.Handler serving the Health of this consumer on paths ending with /healthz and its Readiness on paths ending with /readyz.
+// Reports are served as JSON with status 200 if they are OK and 503 otherwise.
+func (c *Consumer) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report *HealthReport
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/healthz"):
+			report = c.Health()
+		case strings.HasSuffix(r.URL.Path, "/readyz"):
+			report = c.Readiness()
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.OK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			Warnf(c, "Failed to write health report: %s", err)
+		}
+	})
+}
+
+func (c *Consumer) healthChecks() []*HealthCheck {
+	return []*HealthCheck{c.checkCoordinator(), c.checkFetchers(), c.checkCommits(), c.checkFailures()}
+}
+
+func (c *Consumer) checkCoordinator() *HealthCheck {
+	check := &HealthCheck{Name: "coordinator", OK: true}
+	coordinator, ok := c.config.Coordinator.(ConnectionStateCoordinator)
+	if !ok {
+		check.Detail = fmt.Sprintf("Connection state of coordinator %s is unknown", c.config.Coordinator)
+	} else if !coordinator.IsConnected() {
+		check.OK = false
+		check.Detail = fmt.Sprintf("Not connected to coordinator %s", c.config.Coordinator)
+	}
+	return check
+}
+
+func (c *Consumer) checkFetchers() *HealthCheck {
+	check := &HealthCheck{Name: "fetchers", OK: true}
+	if c.config.HealthFetchTimeout <= 0 || c.numWorkerManagers() == 0 {
+		return check
+	}
+
+	// Message buffers only ask fetchers for more once their batches are taken by worker managers, so fetchers are
+	// expected to be idle while a worker manager is busy and idle time only counts since the last one became free.
+	lastFetch := c.metrics.fetchersIdleTimer.lastUpdated()
+	if lastFetch.IsZero() {
+		lastFetch = c.created
+	}
+	busy := false
+	inLock(&c.workerManagersLock, func() {
+		for _, workerManager := range c.workerManagers {
+			active, changed := workerManager.batchActivity()
+			busy = busy || active
+			if changed.After(lastFetch) {
+				lastFetch = changed
+			}
+		}
+	})
+	if busy {
+		check.Detail = "Fetchers wait for worker managers to take the fetched batches"
+		return check
+	}
+
+	if idle := time.Since(lastFetch); idle > c.config.HealthFetchTimeout {
+		check.OK = false
+		check.Detail = fmt.Sprintf("No fetch request has been picked up for %s", idle)
+	}
+	return check
+}
+
+func (c *Consumer) checkCommits() *HealthCheck {
+	check := &HealthCheck{Name: "commits", OK: true}
+	if c.config.HealthCommitTimeout <= 0 {
+		return check
+	}
+
+	lags := c.metrics.Lags()
+	stale := make([]string, 0)
+	c.metrics.eachPartition(func(topicPartition TopicAndPartition, partition *partitionMetrics) {
+		lag, exists := lags[topicPartition]
+		if !exists || lag.ProcessedOffset <= lag.CommittedOffset {
+			return
+		}
+		if age := partition.lastCommitAgeGauge.age(); age > c.config.HealthCommitTimeout {
+			stale = append(stale, fmt.Sprintf("%s committed %s ago", &topicPartition, age))
+		}
+	})
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		check.OK = false
+		check.Detail = fmt.Sprintf("Processed offsets have not been committed recently: %s", strings.Join(stale, ", "))
+	}
+	return check
+}
+
+func (c *Consumer) checkFailures() *HealthCheck {
+	check := &HealthCheck{Name: "failures", OK: true}
+	failed := make([]string, 0)
+	inLock(&c.workerManagersLock, func() {
+		for topicPartition, workerManager := range c.workerManagers {
+			if workerManager.failCounter.ThresholdReached() {
+				failed = append(failed, topicPartition.String())
+			}
+		}
+	})
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		check.OK = false
+		check.Detail = fmt.Sprintf("Worker retry threshold reached for %s", strings.Join(failed, ", "))
+	}
+	return check
+}
+
+func (c *Consumer) checkRebalance() *HealthCheck {
+	check := &HealthCheck{Name: "rebalance", OK: true}
+	var rebalancingSince time.Time
+	var assigned bool
+	inReadLock(&c.rebalanceStateLock, func() {
+		rebalancingSince, assigned = c.rebalancingSince, c.partitionsAssigned
+	})
+	if !rebalancingSince.IsZero() {
+		check.OK = false
+		check.Detail = fmt.Sprintf("Rebalancing for %s", time.Since(rebalancingSince))
+	} else if !assigned {
+		check.OK = false
+		check.Detail = "Partitions have not been assigned yet"
+	}
+	return check
+}
+
+// rebalanceStarted records that partitions are being reassigned. Called with the rebalanceLock held, which is held for the whole
+// rebalance, so the state is guarded by its own lock to be readable meanwhile.
+func (c *Consumer) rebalanceStarted() {
+	inWriteLock(&c.rebalanceStateLock, func() {
+		c.rebalancingSince = time.Now()
+	})
+}
+
+// rebalanceFinished records that partitions are no longer being reassigned and whether this consumer has partitions assigned.
+func (c *Consumer) rebalanceFinished(assigned bool) {
+	inWriteLock(&c.rebalanceStateLock, func() {
+		c.rebalancingSince = time.Time{}
+		c.partitionsAssigned = assigned
+	})
+}
+
+func (c *Consumer) checkShutdown() *HealthCheck {
+	check := &HealthCheck{Name: "shutdown", OK: true}
+	if c.isShuttingdown {
+		check.OK = false
+		check.Detail = "Consumer is shutting down"
+	}
+	return check
+}
+
+func (c *Consumer) numWorkerManagers() int {
+	num := 0
+	inLock(&c.workerManagersLock, func() { num = len(c.workerManagers) })
+	return num
+}
@@ -0,0 +1,121 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connectionStateCoordinator is an inMemoryCoordinator reporting a given connection state.
+type connectionStateCoordinator struct {
+	*inMemoryCoordinator
+	connected bool
+}
+
+func (this *connectionStateCoordinator) IsConnected() bool {
+	return this.connected
+}
+
+func healthCheck(report *HealthReport, name string) *HealthCheck {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return nil
+}
+
+func TestConsumerHealth(t *testing.T) {
+	topicPartition := TopicAndPartition{"topic", 0}
+	topics := map[string][]int32{"topic": []int32{0}}
+	config := inMemoryConsumerConfig(newStaticClient("topic", 0, 10), topics)
+	coordinator := &connectionStateCoordinator{config.Coordinator.(*inMemoryCoordinator), true}
+	config.Coordinator = coordinator
+	config.HealthFetchTimeout = time.Minute
+	config.HealthCommitTimeout = time.Minute
+	consumer := NewConsumer(config)
+	defer consumer.Metrics().close()
+
+	assert(t, consumer.Health().OK, true)
+	assert(t, consumer.Readiness().OK, false)
+	assert(t, healthCheck(consumer.Readiness(), "rebalance").OK, false)
+	consumer.rebalanceFinished(true)
+	assert(t, consumer.Readiness().OK, true)
+	consumer.rebalanceStarted()
+	assert(t, healthCheck(consumer.Readiness(), "rebalance").OK, false)
+	consumer.rebalanceFinished(true)
+	assert(t, consumer.Readiness().OK, true)
+
+	coordinator.connected = false
+	assert(t, healthCheck(consumer.Health(), "coordinator").OK, false)
+	coordinator.connected = true
+
+	counter := NewFailureCounter(1, time.Hour)
+	defer counter.Close()
+	workerManager := &WorkerManager{failCounter: counter}
+	consumer.workerManagers[topicPartition] = workerManager
+	consumer.created = time.Now().Add(-2 * time.Minute)
+	assert(t, healthCheck(consumer.Health(), "fetchers").OK, false)
+	consumer.Metrics().fetchersIdle().Update(time.Millisecond)
+	assert(t, healthCheck(consumer.Health(), "fetchers").OK, true)
+
+	// fetchers are not asked for more while a worker manager is busy, e.g. with slow tasks or held by MinMessageAge
+	longAgo := time.Now().Add(-2 * time.Minute).UnixNano()
+	atomic.StoreInt64(&consumer.Metrics().fetchersIdleTimer.lastUpdate, longAgo)
+	atomic.StoreInt64(&workerManager.batchChanged, longAgo)
+	atomic.StoreInt32(&workerManager.batchActive, 1)
+	assert(t, healthCheck(consumer.Health(), "fetchers").OK, true)
+	// idle time counts since the worker manager became free
+	workerManager.setBatchActive(false)
+	assert(t, healthCheck(consumer.Health(), "fetchers").OK, true)
+	atomic.StoreInt64(&workerManager.batchChanged, longAgo)
+	assert(t, healthCheck(consumer.Health(), "fetchers").OK, false)
+
+	counter.Failed()
+	assert(t, healthCheck(consumer.Health(), "failures").OK, false)
+	assert(t, consumer.Health().OK, false)
+	consumer.workerManagers = make(map[TopicAndPartition]*WorkerManager)
+
+	partition := consumer.Metrics().partition(topicPartition)
+	consumer.Metrics().updateCommittedOffset(topicPartition, 3)
+	consumer.Metrics().updateProcessedOffset(topicPartition, 3)
+	atomic.StoreInt64(&partition.lastCommitAgeGauge.lastCommit, time.Now().Add(-2*time.Minute).UnixNano())
+	assert(t, healthCheck(consumer.Health(), "commits").OK, true)
+	consumer.Metrics().updateProcessedOffset(topicPartition, 5)
+	assert(t, healthCheck(consumer.Health(), "commits").OK, false)
+
+	recorder := httptest.NewRecorder()
+	consumer.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	assert(t, recorder.Code, http.StatusServiceUnavailable)
+	report := &HealthReport{}
+	assert(t, json.Unmarshal(recorder.Body.Bytes(), report), nil)
+	assert(t, report.OK, false)
+	assert(t, healthCheck(report, "commits").OK, false)
+
+	consumer.Metrics().updateCommittedOffset(topicPartition, 5)
+	recorder = httptest.NewRecorder()
+	consumer.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/consumer/readyz", nil))
+	assert(t, recorder.Code, http.StatusOK)
+
+	recorder = httptest.NewRecorder()
+	consumer.HealthHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/unknown", nil))
+	assert(t, recorder.Code, http.StatusNotFound)
+}
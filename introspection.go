@@ -0,0 +1,131 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// IntrospectionSnapshot extends StateSnapshot with the internal state of a consumer's fetchers, message buffers and worker managers.
+// It is meant for debugging a misbehaving consumer without turning on trace logging.
+type IntrospectionSnapshot struct {
+	*StateSnapshot
+
+	// Partitions are a map where keys are topics and values are maps where keys are partitions and values are the internal states of these topic-partitions.
+	// Contains all partitions in the consumer's topic registry as well as all partitions with a worker manager.
+	Partitions map[string]map[int32]*PartitionState
+
+	// Fetchers are a map where keys are fetcher routine names and values are the topic-partitions these routines fetch.
+	Fetchers map[string][]*TopicAndPartition
+}
+
+// PartitionState is the internal state of a single topic-partition owned by a consumer.
+type PartitionState struct {
+	// True if the topic-partition is in the consumer's topic registry.
+	Registered bool
+
+	// Offset of the next message to fetch, or InvalidOffset if the topic-partition is not registered.
+	FetchedOffset int64
+
+	// Number of fetched messages waiting in the message buffer to be handed to the worker manager.
+	BufferedMessages int
+
+	// Last offset committed by the worker manager, or InvalidOffset if nothing has been committed yet.
+	LastCommittedOffset int64
+
+	// Batch the worker manager is currently processing, nil if the topic-partition has no worker manager.
+	Batch *BatchState
+}
+
+// BatchState is the state of the batch of messages a WorkerManager is currently processing.
+type BatchState struct {
+	// Number of tasks of the batch that are not done yet.
+	Outstanding int
+
+	// Tasks of the batch in message order.
+	Tasks []*TaskState
+}
+
+// TaskState is the state of a single task of a batch.
+type TaskState struct {
+	// Offset of the message processed by the task.
+	Offset int64
+
+	// Number of retries used for the task.
+	Retries int
+
+	// True if the task is done, either successfully or not.
+	Done bool
+}
+
+// Returns an introspection snapshot of this consumer's internal state.
+func (c *Consumer) Introspect() *IntrospectionSnapshot {
+	snapshot := &IntrospectionSnapshot{
+		StateSnapshot: c.StateSnapshot(),
+		Partitions:    make(map[string]map[int32]*PartitionState),
+		Fetchers:      c.fetcher.fetcherAssignments(),
+	}
+
+	partitionState := func(topic string, partition int32) *PartitionState {
+		if _, exists := snapshot.Partitions[topic]; !exists {
+			snapshot.Partitions[topic] = make(map[int32]*PartitionState)
+		}
+		state, exists := snapshot.Partitions[topic][partition]
+		if !exists {
+			state = &PartitionState{
+				FetchedOffset:       InvalidOffset,
+				LastCommittedOffset: InvalidOffset,
+			}
+			snapshot.Partitions[topic][partition] = state
+		}
+		return state
+	}
+
+	// rebalances and Close release partitions from the topic registry meanwhile
+	inReadLock(&c.topicRegistryLock, func() {
+		for topic, partitions := range c.topicRegistry {
+			for partition, info := range partitions {
+				state := partitionState(topic, partition)
+				state.Registered = true
+				state.FetchedOffset = info.fetchedOffset()
+				state.BufferedMessages = info.Buffer.numBuffered()
+			}
+		}
+	})
+
+	inLock(&c.workerManagersLock, func() {
+		for topicPartition, workerManager := range c.workerManagers {
+			state := partitionState(topicPartition.Topic, topicPartition.Partition)
+			state.LastCommittedOffset = workerManager.GetLastCommittedOffset()
+			state.Batch = workerManager.BatchState()
+		}
+	})
+
+	return snapshot
+}
+
+// Creates an http.Handler serving the Introspect snapshot of this consumer as JSON.
+func (c *Consumer) IntrospectionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(c.Introspect()); err != nil {
+			Warnf(c, "Failed to write introspection snapshot: %s", err)
+		}
+	})
+}
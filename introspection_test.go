@@ -0,0 +1,143 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsumerIntrospection(t *testing.T) {
+	topic := "test-introspection"
+	topics := map[string][]int32{topic: []int32{0}}
+	release := make(chan bool)
+	var failed int32
+
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 10), topics)
+	config.FetchBatchSize = 10
+	config.OffsetCommitInterval = 100 * time.Millisecond
+	config.WorkerBackoff = 10 * time.Millisecond
+	config.Strategy = func(_ *Worker, message *Message, id TaskId) WorkerResult {
+		if message.Offset == 5 && atomic.CompareAndSwapInt32(&failed, 0, 1) {
+			return NewProcessingFailedResult(id)
+		}
+		if message.Offset == 9 {
+			<-release
+		}
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+
+	introspectWithin := func(condition func(*PartitionState) bool) *IntrospectionSnapshot {
+		timeout := time.After(consumeTimeout)
+		for {
+			snapshot := consumer.Introspect()
+			if state, exists := snapshot.Partitions[topic][0]; exists && condition(state) {
+				return snapshot
+			}
+			select {
+			case <-timeout:
+				t.Fatalf("Consumer did not reach expected state within %s", consumeTimeout)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	snapshot := introspectWithin(func(state *PartitionState) bool {
+		return state.Batch != nil && len(state.Batch.Tasks) == 10 && state.Batch.Outstanding == 1
+	})
+	state := snapshot.Partitions[topic][0]
+	assert(t, state.Registered, true)
+	assert(t, state.FetchedOffset, int64(10))
+	assert(t, state.Batch.Tasks[0].Done, true)
+	assert(t, state.Batch.Tasks[5].Retries, 1)
+	assert(t, state.Batch.Tasks[5].Done, true)
+	assert(t, state.Batch.Tasks[9].Done, false)
+	assert(t, len(snapshot.Fetchers), 1)
+	for _, partitions := range snapshot.Fetchers {
+		assert(t, partitions, []*TopicAndPartition{&TopicAndPartition{topic, 0}})
+	}
+
+	close(release)
+	introspectWithin(func(state *PartitionState) bool { return state.LastCommittedOffset == 9 })
+
+	recorder := httptest.NewRecorder()
+	consumer.IntrospectionHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/consumer", nil))
+	served := &IntrospectionSnapshot{}
+	assert(t, json.Unmarshal(recorder.Body.Bytes(), served), nil)
+	assert(t, served.Partitions[topic][0].LastCommittedOffset, int64(9))
+	assert(t, served.Offsets[topic][0], int64(9))
+
+	closeWithin(t, 10*time.Second, consumer)
+}
+
+// Meant to be run with -race: partitions are released from the topic registry while the consumer is introspected.
+func TestConsumerIntrospectionDuringRebalance(t *testing.T) {
+	topic := "test-introspection-rebalance"
+	topics := map[string][]int32{topic: []int32{0, 1, 2, 3}}
+	consumed := make(chan bool, 1)
+
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 100), topics)
+	config.Strategy = func(_ *Worker, message *Message, id TaskId) WorkerResult {
+		select {
+		case consumed <- true:
+		default:
+		}
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+	select {
+	case <-consumed:
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Failed to consume a message within %s", consumeTimeout)
+	}
+
+	introspecting := make(chan bool)
+	stop := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		consumer.Introspect()
+		close(introspecting)
+		for {
+			select {
+			case <-stop:
+				close(stopped)
+				return
+			default:
+				consumer.Introspect()
+			}
+		}
+	}()
+
+	<-introspecting
+	inLock(&consumer.rebalanceLock, func() {
+		consumer.releasePartitionOwnership(consumer.topicRegistry)
+	})
+	close(stop)
+	<-stopped
+
+	for _, state := range consumer.Introspect().Partitions[topic] {
+		assert(t, state.Registered, false)
+	}
+	closeWithin(t, 10*time.Second, consumer)
+}
@@ -0,0 +1,192 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// KafkaVersionAuto tells the client to negotiate the protocol version with the brokers using the ApiVersions request.
+	KafkaVersionAuto = "auto"
+
+	// DefaultKafkaVersion is the oldest protocol version supported by this client. It is used unless configured otherwise.
+	DefaultKafkaVersion = "0.8.2.0"
+)
+
+// KafkaFeature is a protocol feature that is only available starting from a certain Kafka version.
+type KafkaFeature string
+
+const (
+	// Message timestamps, available since Kafka 0.10.0.
+	TimestampsFeature KafkaFeature = "timestamps"
+
+	// LZ4 compression, available since Kafka 0.10.0. Older brokers use a framing incompatible with the LZ4 specification.
+	LZ4Feature KafkaFeature = "lz4"
+
+	// Record headers, available since Kafka 0.11.0.
+	HeadersFeature KafkaFeature = "headers"
+
+	// Zstandard compression, available since Kafka 2.1.0.
+	ZstdFeature KafkaFeature = "zstd"
+)
+
+var kafkaFeatureVersions = map[KafkaFeature]sarama.KafkaVersion{
+	TimestampsFeature: sarama.V0_10_0_0,
+	LZ4Feature:        sarama.V0_10_0_0,
+	HeadersFeature:    sarama.V0_11_0_0,
+	ZstdFeature:       sarama.V2_1_0_0,
+}
+
+// Maximum Fetch API version to the Kafka release that introduced it. Ordered from the newest to the oldest.
+var fetchApiVersions = []struct {
+	fetchVersion int16
+	kafkaVersion sarama.KafkaVersion
+}{
+	{10, sarama.V2_1_0_0},
+	{8, sarama.V2_0_0_0},
+	{7, sarama.V1_1_0_0},
+	{6, sarama.V1_0_0_0},
+	{4, sarama.V0_11_0_0},
+	{3, sarama.V0_10_1_0},
+	{2, sarama.V0_10_0_0},
+}
+
+// Fetch API key as defined by the Kafka protocol.
+const fetchApiKey = 1
+
+// UnsupportedFeatureError is returned when a feature is used against a Kafka version that does not support it.
+type UnsupportedFeatureError struct {
+	Feature  KafkaFeature
+	Required sarama.KafkaVersion
+	Actual   sarama.KafkaVersion
+}
+
+func (this *UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("Kafka feature %s requires protocol version %s or newer but %s is in use", this.Feature, this.Required, this.Actual)
+}
+
+// ValidateKafkaVersion checks that a given version string is either KafkaVersionAuto or a version known to this client.
+func ValidateKafkaVersion(version string) error {
+	if version == KafkaVersionAuto {
+		return nil
+	}
+	_, err := sarama.ParseKafkaVersion(version)
+	return err
+}
+
+// CheckKafkaFeature returns an UnsupportedFeatureError if a given feature is not available in a given Kafka version and nil otherwise.
+func CheckKafkaFeature(version sarama.KafkaVersion, feature KafkaFeature) error {
+	required, exists := kafkaFeatureVersions[feature]
+	if !exists {
+		return fmt.Errorf("Unknown Kafka feature %s", feature)
+	}
+
+	if !version.IsAtLeast(required) {
+		return &UnsupportedFeatureError{
+			Feature:  feature,
+			Required: required,
+			Actual:   version,
+		}
+	}
+
+	return nil
+}
+
+// ResolveKafkaVersion turns a configured version string into a protocol version.
+// If the configured version is KafkaVersionAuto the version is negotiated with the given brokers.
+func ResolveKafkaVersion(version string, brokerList []string, clientId string) (sarama.KafkaVersion, error) {
+	if version == "" {
+		version = DefaultKafkaVersion
+	}
+
+	if version != KafkaVersionAuto {
+		return sarama.ParseKafkaVersion(version)
+	}
+
+	return NegotiateKafkaVersion(brokerList, clientId)
+}
+
+// NegotiateKafkaVersion asks the given brokers for the API versions they support and returns the newest protocol version
+// every reachable broker understands. Brokers older than 0.10.0 do not support ApiVersions, in this case DefaultKafkaVersion is returned.
+func NegotiateKafkaVersion(brokerList []string, clientId string) (sarama.KafkaVersion, error) {
+	if len(brokerList) == 0 {
+		return sarama.KafkaVersion{}, errors.New("Cannot negotiate Kafka version without brokers")
+	}
+
+	config := sarama.NewConfig()
+	config.ClientID = clientId
+	config.Version = sarama.V0_10_0_0
+
+	negotiated := sarama.MaxVersion
+	reachable := 0
+	for _, address := range brokerList {
+		version, err := brokerKafkaVersion(address, config)
+		if err != nil {
+			Warnf("version-negotiation", "Failed to get API versions from broker %s: %s", address, err)
+			continue
+		}
+		reachable++
+		if !version.IsAtLeast(negotiated) {
+			negotiated = version
+		}
+	}
+
+	if reachable == 0 {
+		Warnf("version-negotiation", "No broker responded to ApiVersions request, falling back to %s", DefaultKafkaVersion)
+		return sarama.ParseKafkaVersion(DefaultKafkaVersion)
+	}
+
+	Infof("version-negotiation", "Negotiated Kafka protocol version %s", negotiated)
+	return negotiated, nil
+}
+
+func brokerKafkaVersion(address string, config *sarama.Config) (sarama.KafkaVersion, error) {
+	broker := sarama.NewBroker(address)
+	if err := broker.Open(config); err != nil {
+		return sarama.KafkaVersion{}, err
+	}
+	defer broker.Close()
+
+	response, err := broker.ApiVersions(&sarama.ApiVersionsRequest{})
+	if err != nil {
+		return sarama.KafkaVersion{}, err
+	}
+	if response.Err != sarama.ErrNoError {
+		return sarama.KafkaVersion{}, response.Err
+	}
+
+	for _, block := range response.ApiVersions {
+		if block.ApiKey == fetchApiKey {
+			return kafkaVersionForFetchApi(block.MaxVersion), nil
+		}
+	}
+
+	return sarama.KafkaVersion{}, errors.New("Broker did not report Fetch API version")
+}
+
+func kafkaVersionForFetchApi(maxVersion int16) sarama.KafkaVersion {
+	for _, entry := range fetchApiVersions {
+		if maxVersion >= entry.fetchVersion {
+			return entry.kafkaVersion
+		}
+	}
+
+	return sarama.V0_10_0_0
+}
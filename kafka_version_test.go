@@ -0,0 +1,63 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestValidateKafkaVersion(t *testing.T) {
+	assert(t, ValidateKafkaVersion(KafkaVersionAuto), nil)
+	assert(t, ValidateKafkaVersion(DefaultKafkaVersion), nil)
+	assert(t, ValidateKafkaVersion("0.10.2.0"), nil)
+	assertNot(t, ValidateKafkaVersion("not-a-version"), nil)
+}
+
+func TestResolveStaticKafkaVersion(t *testing.T) {
+	version, err := ResolveKafkaVersion("", nil, "test")
+	assert(t, err, nil)
+	assert(t, version, sarama.V0_8_2_0)
+
+	version, err = ResolveKafkaVersion("0.11.0.0", nil, "test")
+	assert(t, err, nil)
+	assert(t, version, sarama.V0_11_0_0)
+}
+
+func TestCheckKafkaFeature(t *testing.T) {
+	assertNot(t, CheckKafkaFeature(sarama.V0_8_2_0, TimestampsFeature), nil)
+	assert(t, CheckKafkaFeature(sarama.V0_10_0_0, TimestampsFeature), nil)
+
+	err := CheckKafkaFeature(sarama.V0_10_2_0, HeadersFeature)
+	if unsupported, ok := err.(*UnsupportedFeatureError); !ok {
+		t.Errorf("Expected UnsupportedFeatureError, actual %v", err)
+	} else {
+		assert(t, unsupported.Required, sarama.V0_11_0_0)
+	}
+	assert(t, CheckKafkaFeature(sarama.V0_11_0_0, HeadersFeature), nil)
+
+	assertNot(t, CheckKafkaFeature(sarama.V2_0_0_0, ZstdFeature), nil)
+	assert(t, CheckKafkaFeature(sarama.V2_1_0_0, ZstdFeature), nil)
+}
+
+func TestKafkaVersionForFetchApi(t *testing.T) {
+	assert(t, kafkaVersionForFetchApi(2), sarama.V0_10_0_0)
+	assert(t, kafkaVersionForFetchApi(3), sarama.V0_10_1_0)
+	assert(t, kafkaVersionForFetchApi(5), sarama.V0_11_0_0)
+	assert(t, kafkaVersionForFetchApi(7), sarama.V1_1_0_0)
+	assert(t, kafkaVersionForFetchApi(11), sarama.V2_1_0_0)
+}
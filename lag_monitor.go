@@ -0,0 +1,466 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LagStatus is the result of evaluating the lag of a consumer group or a single partition over the sliding window.
+type LagStatus string
+
+const (
+	// The lag was zero at some point in the window or is not growing.
+	LagOK LagStatus = "OK"
+
+	// Fewer samples than WindowSize have been taken yet, so the lag cannot be evaluated.
+	LagPending LagStatus = "PENDING"
+
+	// The committed offset moves but the lag grew over every interval of the window.
+	LagFallingBehind LagStatus = "FALLING_BEHIND"
+
+	// The committed offset did not move during the window while there are messages to consume and the group has live members.
+	LagStalled LagStatus = "STALLED"
+
+	// The committed offset did not move during the window while there are messages to consume and the group has no members.
+	LagStopped LagStatus = "STOPPED"
+)
+
+// Higher severity wins when the statuses of partitions are combined into the status of a group.
+var lagStatusSeverity = map[LagStatus]int{
+	LagOK:            0,
+	LagPending:       1,
+	LagFallingBehind: 2,
+	LagStalled:       3,
+	LagStopped:       4,
+}
+
+// PartitionLagStatus is the evaluated lag of a consumer group on a single topic partition.
+type PartitionLagStatus struct {
+	Topic           string    `json:"topic"`
+	Partition       int32     `json:"partition"`
+	CommittedOffset int64     `json:"committedOffset"`
+	LogEndOffset    int64     `json:"logEndOffset"`
+	Lag             int64     `json:"lag"`
+	Status          LagStatus `json:"status"`
+}
+
+// GroupLagStatus is the evaluated lag of a consumer group. The status of a group is the most severe status of its partitions.
+type GroupLagStatus struct {
+	Group      string                `json:"group"`
+	Status     LagStatus             `json:"status"`
+	TotalLag   int64                 `json:"totalLag"`
+	Partitions []*PartitionLagStatus `json:"partitions"`
+	Timestamp  time.Time             `json:"timestamp"`
+}
+
+// LagMonitorConfig is used to configure a LagMonitor.
+type LagMonitorConfig struct {
+	// Source of committed offsets, e.g. a ZookeeperCoordinator or an OffsetStorageGroupLister.
+	Offsets GroupOffsetLister
+
+	// Client used to get log end offsets from brokers. Must be initialized.
+	Client LowLevelClient
+
+	// Coordinator used to tell stalled groups from stopped ones. If not set, groups that do not make progress are reported as stalled. (optional)
+	Coordinator ConsumerCoordinator
+
+	// Consumer groups to monitor. All groups known to Offsets are monitored if empty.
+	Groups []string
+
+	// Interval between two offset samples.
+	Interval time.Duration
+
+	// Number of samples in the sliding window lag is evaluated over.
+	WindowSize int
+
+	// Producer to publish the status of every group to Topic after each evaluation. (optional)
+	Producer Producer
+
+	// Topic to publish group statuses to. Required if Producer is set.
+	Topic string
+
+	// Path the LagMonitor is served under over HTTP. Whatever follows it in a request path is the name of a group. Defaults to /lag/.
+	HTTPPath string
+}
+
+// Creates a LagMonitorConfig with sane defaults. Offsets and Client are still required.
+func NewLagMonitorConfig() *LagMonitorConfig {
+	return &LagMonitorConfig{
+		Interval:   30 * time.Second,
+		WindowSize: 10,
+		HTTPPath:   "/lag/",
+	}
+}
+
+// Validates this LagMonitorConfig. Returns a corresponding error if the config is invalid and nil otherwise.
+func (this *LagMonitorConfig) Validate() error {
+	if this.Offsets == nil {
+		return errors.New("Please provide Offsets")
+	}
+	if this.Client == nil {
+		return errors.New("Please provide a Client")
+	}
+	if this.Interval <= 0 {
+		return errors.New("Interval must be greater than 0")
+	}
+	if this.WindowSize < 2 {
+		return errors.New("WindowSize must be at least 2")
+	}
+	if this.Producer != nil && this.Topic == "" {
+		return errors.New("Please provide a Topic to publish group statuses to")
+	}
+	if this.HTTPPath != "" && !strings.HasSuffix(this.HTTPPath, "/") {
+		return errors.New("HTTPPath must end with a slash")
+	}
+	return nil
+}
+
+type lagSample struct {
+	committedOffset int64
+	logEndOffset    int64
+}
+
+func (this lagSample) lag() int64 {
+	return lagBehind(this.logEndOffset, this.committedOffset)
+}
+
+// LagMonitor periodically samples the committed offsets of consumer groups and the log end offsets of their partitions
+// and evaluates the lag of each group over a sliding window of samples. Evaluated statuses are served over HTTP as JSON
+// and optionally published to a Kafka topic.
+type LagMonitor struct {
+	config   *LagMonitorConfig
+	samples  map[string]map[TopicAndPartition][]lagSample
+	statuses map[string]*GroupLagStatus
+	lock     sync.RWMutex
+	stop     chan bool
+}
+
+// Creates a new LagMonitor with a given config.
+func NewLagMonitor(config *LagMonitorConfig) *LagMonitor {
+	return &LagMonitor{
+		config:   config,
+		samples:  make(map[string]map[TopicAndPartition][]lagSample),
+		statuses: make(map[string]*GroupLagStatus),
+		stop:     make(chan bool),
+	}
+}
+
+func (this *LagMonitor) String() string {
+	return "lag-monitor"
+}
+
+// Starts sampling and evaluating lag every Interval. Call to this method blocks until Stop is called.
+func (this *LagMonitor) Start() {
+	for {
+		if err := this.Evaluate(); err != nil {
+			Errorf(this, "Failed to evaluate lag: %s", err)
+		}
+
+		select {
+		case <-this.stop:
+			return
+		case <-time.After(this.config.Interval):
+		}
+	}
+}
+
+// Stops this LagMonitor.
+func (this *LagMonitor) Stop() {
+	this.stop <- true
+}
+
+// Takes a single sample of committed and log end offsets for all monitored groups and re-evaluates their statuses.
+// Groups that fail to be sampled keep their previous status. Returns the last error encountered.
+func (this *LagMonitor) Evaluate() error {
+	groups := this.config.Groups
+	if len(groups) == 0 {
+		var err error
+		groups, err = this.config.Offsets.GetAllGroups()
+		if err != nil {
+			return err
+		}
+	}
+
+	var lastErr error
+	for _, group := range groups {
+		status, err := this.evaluateGroup(group)
+		if err != nil {
+			Warnf(this, "Failed to evaluate lag of group %s: %s", group, err)
+			lastErr = err
+			continue
+		}
+
+		inWriteLock(&this.lock, func() {
+			this.statuses[group] = status
+		})
+		this.publish(status)
+	}
+
+	return lastErr
+}
+
+// Gets the latest statuses of all monitored groups sorted by group name.
+func (this *LagMonitor) Statuses() []*GroupLagStatus {
+	statuses := make([]*GroupLagStatus, 0)
+	inReadLock(&this.lock, func() {
+		for _, status := range this.statuses {
+			statuses = append(statuses, status)
+		}
+	})
+	sort.Sort(byGroup(statuses))
+	return statuses
+}
+
+// Gets the latest status of a given group. Returns nil if the group has not been evaluated yet.
+func (this *LagMonitor) Status(group string) *GroupLagStatus {
+	var status *GroupLagStatus
+	inReadLock(&this.lock, func() {
+		status = this.statuses[group]
+	})
+	return status
+}
+
+// Serves the latest statuses as JSON. Requests to HTTPPath followed by a group name get the status of that group only,
+// requests to HTTPPath itself get all groups. Group names may contain slashes.
+func (this *LagMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := this.config.HTTPPath
+	if path == "" {
+		path = "/lag/"
+	}
+	if !strings.HasPrefix(r.URL.Path, path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var response interface{} = this.Statuses()
+	if group := strings.TrimPrefix(r.URL.Path, path); group != "" {
+		status := this.Status(group)
+		if status == nil {
+			http.Error(w, fmt.Sprintf("Unknown group %s", group), http.StatusNotFound)
+			return
+		}
+		response = status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		Warnf(this, "Failed to write lag status: %s", err)
+	}
+}
+
+func (this *LagMonitor) evaluateGroup(group string) (*GroupLagStatus, error) {
+	offsets, err := this.config.Offsets.GetGroupOffsets(group)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only ask the coordinator for members if some partition doesn't make progress, and only once per evaluation.
+	hasMembers := func() bool { return true }
+	if this.config.Coordinator != nil {
+		var members *bool
+		hasMembers = func() bool {
+			if members == nil {
+				alive := true
+				consumers, err := this.config.Coordinator.GetConsumersInGroup(group)
+				if err != nil {
+					Warnf(this, "Failed to get members of group %s, assuming it is alive: %s", group, err)
+				} else {
+					alive = len(consumers) > 0
+				}
+				members = &alive
+			}
+			return *members
+		}
+	}
+
+	status := &GroupLagStatus{
+		Group:      group,
+		Status:     LagOK,
+		Partitions: make([]*PartitionLagStatus, 0, len(offsets)),
+		Timestamp:  time.Now(),
+	}
+
+	var samples map[TopicAndPartition][]lagSample
+	inWriteLock(&this.lock, func() {
+		if _, exists := this.samples[group]; !exists {
+			this.samples[group] = make(map[TopicAndPartition][]lagSample)
+		}
+		samples = this.samples[group]
+	})
+
+	for topicPartition, committedOffset := range offsets {
+		logEndOffset, err := this.config.Client.GetAvailableOffset(topicPartition.Topic, topicPartition.Partition, LargestOffset)
+		if err != nil {
+			return nil, err
+		}
+		// a lag computed from an unknown log end offset would look fine, so keep the previous status instead
+		if logEndOffset < 0 {
+			return nil, fmt.Errorf("Unknown log end offset of %s", &topicPartition)
+		}
+
+		sample := lagSample{committedOffset: committedOffset, logEndOffset: logEndOffset}
+		window := append(samples[topicPartition], sample)
+		if len(window) > this.config.WindowSize {
+			window = window[len(window)-this.config.WindowSize:]
+		}
+		samples[topicPartition] = window
+
+		partitionStatus := &PartitionLagStatus{
+			Topic:           topicPartition.Topic,
+			Partition:       topicPartition.Partition,
+			CommittedOffset: committedOffset,
+			LogEndOffset:    logEndOffset,
+			Lag:             sample.lag(),
+			Status:          evaluateLagWindow(window, this.config.WindowSize, hasMembers),
+		}
+		status.Partitions = append(status.Partitions, partitionStatus)
+		status.TotalLag += partitionStatus.Lag
+		if lagStatusSeverity[partitionStatus.Status] > lagStatusSeverity[status.Status] {
+			status.Status = partitionStatus.Status
+		}
+	}
+	sort.Sort(byPartitionLagStatus(status.Partitions))
+
+	return status, nil
+}
+
+func (this *LagMonitor) publish(status *GroupLagStatus) {
+	if this.config.Producer == nil {
+		return
+	}
+
+	encoded, err := json.Marshal(status)
+	if err != nil {
+		Warnf(this, "Failed to encode lag status of group %s: %s", status.Group, err)
+		return
+	}
+
+	this.config.Producer.Input() <- &ProducerMessage{
+		Topic:        this.config.Topic,
+		Key:          []byte(status.Group),
+		Value:        encoded,
+		KeyEncoder:   &ByteEncoder{},
+		ValueEncoder: &ByteEncoder{},
+	}
+}
+
+// evaluateLagWindow evaluates the lag of a single partition over a given window of samples, oldest first, once it holds windowSize samples.
+// hasMembers is only called if the partition does not make progress.
+func evaluateLagWindow(window []lagSample, windowSize int, hasMembers func() bool) LagStatus {
+	if len(window) < windowSize {
+		return LagPending
+	}
+
+	for _, sample := range window {
+		if sample.lag() == 0 {
+			return LagOK
+		}
+	}
+
+	first, last := window[0], window[len(window)-1]
+	if first.committedOffset == last.committedOffset {
+		if hasMembers() {
+			return LagStalled
+		}
+		return LagStopped
+	}
+
+	for i := 1; i < len(window); i++ {
+		if window[i].lag() <= window[i-1].lag() {
+			return LagOK
+		}
+	}
+	return LagFallingBehind
+}
+
+// OffsetStorageGroupLister implements GroupOffsetLister on top of any OffsetStorage, which cannot list groups and partitions by itself.
+// Groups and the topics they consume are given upfront and partitions of the topics are read from a ConsumerCoordinator.
+type OffsetStorageGroupLister struct {
+	storage     OffsetStorage
+	coordinator ConsumerCoordinator
+	groupTopics map[string][]string
+}
+
+// Creates a new OffsetStorageGroupLister that gets offsets of given groups for given topics from a given OffsetStorage.
+func NewOffsetStorageGroupLister(storage OffsetStorage, coordinator ConsumerCoordinator, groupTopics map[string][]string) *OffsetStorageGroupLister {
+	return &OffsetStorageGroupLister{
+		storage:     storage,
+		coordinator: coordinator,
+		groupTopics: groupTopics,
+	}
+}
+
+// Gets the names of all configured groups.
+func (this *OffsetStorageGroupLister) GetAllGroups() ([]string, error) {
+	groups := make([]string, 0, len(this.groupTopics))
+	for group := range this.groupTopics {
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// Gets offsets committed by a given group for all partitions of its topics. Partitions without a committed offset are omitted.
+func (this *OffsetStorageGroupLister) GetGroupOffsets(group string) (map[TopicAndPartition]int64, error) {
+	partitions, err := this.coordinator.GetPartitionsForTopics(this.groupTopics[group])
+	if err != nil {
+		return nil, err
+	}
+
+	topicPartitions := make([]*TopicAndPartition, 0)
+	for topic, topicPartitionIds := range partitions {
+		for _, partition := range topicPartitionIds {
+			topicPartitions = append(topicPartitions, &TopicAndPartition{topic, partition})
+		}
+	}
+
+	offsets, err := getOffsets(this.storage, group, topicPartitions)
+	if err != nil {
+		return nil, err
+	}
+
+	groupOffsets := make(map[TopicAndPartition]int64)
+	for topicPartition, offset := range offsets {
+		if !isOffsetInvalid(offset.Offset) || offset.Offset == BeforeFirstOffset {
+			groupOffsets[topicPartition] = offset.Offset
+		}
+	}
+	return groupOffsets, nil
+}
+
+type byGroup []*GroupLagStatus
+
+func (a byGroup) Len() int           { return len(a) }
+func (a byGroup) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byGroup) Less(i, j int) bool { return a[i].Group < a[j].Group }
+
+type byPartitionLagStatus []*PartitionLagStatus
+
+func (a byPartitionLagStatus) Len() int      { return len(a) }
+func (a byPartitionLagStatus) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPartitionLagStatus) Less(i, j int) bool {
+	if a[i].Topic != a[j].Topic {
+		return a[i].Topic < a[j].Topic
+	}
+	return a[i].Partition < a[j].Partition
+}
@@ -0,0 +1,182 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// logEndClient is a LowLevelClient that only reports given log end offsets.
+type logEndClient struct {
+	staticClient
+	logEnd map[TopicAndPartition]int64
+}
+
+func (this *logEndClient) GetAvailableOffset(topic string, partition int32, offsetTime string) (int64, error) {
+	return this.logEnd[TopicAndPartition{topic, partition}], nil
+}
+
+func TestEvaluateLagWindow(t *testing.T) {
+	alive := func() bool { return true }
+	dead := func() bool { return false }
+
+	assert(t, evaluateLagWindow([]lagSample{{5, 100}}, 3, alive), LagPending)
+	assert(t, evaluateLagWindow([]lagSample{{5, 100}, {50, 100}}, 3, alive), LagPending)
+	assert(t, evaluateLagWindow([]lagSample{{5, 100}, {50, 100}, {99, 100}}, 3, alive), LagOK)
+	assert(t, evaluateLagWindow([]lagSample{{5, 100}, {50, 120}, {60, 110}}, 3, alive), LagOK)
+	assert(t, evaluateLagWindow([]lagSample{{5, 100}, {10, 120}, {15, 140}}, 3, alive), LagFallingBehind)
+	assert(t, evaluateLagWindow([]lagSample{{5, 100}, {5, 100}, {5, 120}}, 3, alive), LagStalled)
+	assert(t, evaluateLagWindow([]lagSample{{5, 100}, {5, 100}, {5, 120}}, 3, dead), LagStopped)
+	assert(t, evaluateLagWindow([]lagSample{{5, 6}, {5, 6}, {5, 6}}, 3, dead), LagOK)
+}
+
+func TestLagMonitor(t *testing.T) {
+	topicPartition := TopicAndPartition{"topic", 0}
+	offsets := staticGroupOffsetLister{
+		"moving":  {topicPartition: 10},
+		"stalled": {topicPartition: 10},
+	}
+	client := &logEndClient{logEnd: map[TopicAndPartition]int64{topicPartition: 100}}
+
+	config := NewLagMonitorConfig()
+	config.Offsets = offsets
+	config.Client = client
+	config.WindowSize = 3
+	assert(t, config.Validate(), nil)
+	monitor := NewLagMonitor(config)
+
+	for i := 0; i < 4; i++ {
+		assert(t, monitor.Evaluate(), nil)
+		if i == 0 {
+			// a single sample does not fill the window
+			assert(t, monitor.Status("moving").Status, LagPending)
+		}
+		offsets["moving"][topicPartition] += 5
+		client.logEnd[topicPartition] += 10
+	}
+
+	statuses := monitor.Statuses()
+	assert(t, len(statuses), 2)
+	assert(t, statuses[0].Group, "moving")
+	assert(t, statuses[0].Status, LagFallingBehind)
+	assert(t, statuses[0].TotalLag, int64(104))
+	assert(t, statuses[1].Status, LagStalled)
+	assert(t, statuses[1].Partitions[0].CommittedOffset, int64(10))
+	assert(t, statuses[1].Partitions[0].LogEndOffset, int64(130))
+
+	config.Coordinator = newInMemoryCoordinator(nil)
+	assert(t, monitor.Evaluate(), nil)
+	assert(t, monitor.Status("stalled").Status, LagStopped)
+
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", "/lag/stalled", nil))
+	assert(t, recorder.Code, http.StatusOK)
+	status := &GroupLagStatus{}
+	assert(t, json.Unmarshal(recorder.Body.Bytes(), status), nil)
+	assert(t, status.Status, LagStopped)
+	assert(t, status.Partitions[0].Lag, int64(129))
+
+	recorder = httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", "/lag/", nil))
+	all := make([]*GroupLagStatus, 0)
+	assert(t, json.Unmarshal(recorder.Body.Bytes(), &all), nil)
+	assert(t, len(all), 2)
+
+	recorder = httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", "/lag/unknown", nil))
+	assert(t, recorder.Code, http.StatusNotFound)
+
+	// only the path prefix is stripped from group names containing slashes
+	offsets["team/stalled"] = map[TopicAndPartition]int64{topicPartition: 10}
+	assert(t, monitor.Evaluate(), nil)
+	recorder = httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", "/lag/team/stalled", nil))
+	assert(t, recorder.Code, http.StatusOK)
+	assert(t, json.Unmarshal(recorder.Body.Bytes(), status), nil)
+	assert(t, status.Group, "team/stalled")
+}
+
+// countingCoordinator counts requests for the members of a group.
+type countingCoordinator struct {
+	*inMemoryCoordinator
+	requests int
+}
+
+func (this *countingCoordinator) GetConsumersInGroup(group string) ([]string, error) {
+	this.requests++
+	return this.inMemoryCoordinator.GetConsumersInGroup(group)
+}
+
+func TestLagMonitorAsksForGroupMembersOncePerEvaluation(t *testing.T) {
+	offsets := staticGroupOffsetLister{"stalled": {}}
+	client := &logEndClient{logEnd: make(map[TopicAndPartition]int64)}
+	for partition := int32(0); partition < 5; partition++ {
+		offsets["stalled"][TopicAndPartition{"topic", partition}] = 10
+		client.logEnd[TopicAndPartition{"topic", partition}] = 100
+	}
+	coordinator := &countingCoordinator{inMemoryCoordinator: newInMemoryCoordinator(nil)}
+
+	config := NewLagMonitorConfig()
+	config.Offsets = offsets
+	config.Client = client
+	config.Coordinator = coordinator
+	config.WindowSize = 2
+	monitor := NewLagMonitor(config)
+
+	assert(t, monitor.Evaluate(), nil)
+	assert(t, monitor.Evaluate(), nil)
+	assert(t, monitor.Status("stalled").Status, LagStopped)
+	assert(t, coordinator.requests, 1)
+}
+
+func TestLagMonitorKeepsStatusOnUnknownLogEndOffset(t *testing.T) {
+	topicPartition := TopicAndPartition{"topic", 0}
+	offsets := staticGroupOffsetLister{"group": {topicPartition: 10}}
+	client := &logEndClient{logEnd: map[TopicAndPartition]int64{topicPartition: 100}}
+
+	config := NewLagMonitorConfig()
+	config.Offsets = offsets
+	config.Client = client
+	config.WindowSize = 2
+	monitor := NewLagMonitor(config)
+
+	assert(t, monitor.Evaluate(), nil)
+	assert(t, monitor.Evaluate(), nil)
+	assert(t, monitor.Status("group").Status, LagStalled)
+
+	// a broker outage must not make the group look caught up
+	client.logEnd[topicPartition] = InvalidOffset
+	assertNot(t, monitor.Evaluate(), nil)
+	assert(t, monitor.Status("group").Status, LagStalled)
+	assert(t, monitor.Status("group").Partitions[0].LogEndOffset, int64(100))
+}
+
+func TestOffsetStorageGroupLister(t *testing.T) {
+	coordinator := newInMemoryCoordinator(map[string][]int32{"topic": []int32{0, 1}})
+	coordinator.CommitOffset("group", "topic", 1, 42)
+	lister := NewOffsetStorageGroupLister(coordinator, coordinator, map[string][]string{"group": []string{"topic"}})
+
+	groups, err := lister.GetAllGroups()
+	assert(t, err, nil)
+	assert(t, groups, []string{"group"})
+
+	offsets, err := lister.GetGroupOffsets("group")
+	assert(t, err, nil)
+	assert(t, offsets, map[TopicAndPartition]int64{TopicAndPartition{"topic", 1}: 42})
+}
@@ -0,0 +1,137 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	kafka "github.com/mistsys/go_kafka_client"
+)
+
+var zkConnect = flag.String("zookeeper", "", "Zookeeper connection string host:port[,host:port...].")
+var zkRoot = flag.String("zookeeper.root", "", "Kafka root path in Zookeeper.")
+var offsetStorage = flag.String("offset.storage", "zookeeper", "Where consumer groups commit offsets: zookeeper or kafka.")
+var groups = flag.String("groups", "", "Comma separated list of consumer groups to monitor. All groups are monitored if empty. Required for kafka offset storage.")
+var topics = flag.String("topics", "", "Comma separated list of topics consumed by the monitored groups. Required for kafka offset storage.")
+var kafkaVersion = flag.String("kafka.version", kafka.DefaultKafkaVersion, "Kafka protocol version, or 'auto' to negotiate it with brokers.")
+var interval = flag.Duration("interval", 30*time.Second, "Interval between two offset samples.")
+var window = flag.Int("window", 10, "Number of samples in the sliding window lag is evaluated over.")
+var port = flag.Int("port", 8080, "HTTP port to serve lag statuses on.")
+var producerConfig = flag.String("producer.config", "", "Path to producer configuration file. If set, lag statuses are published to --topic.")
+var topic = flag.String("topic", "", "Topic to publish lag statuses to.")
+
+func main() {
+	flag.Parse()
+	if *zkConnect == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	zkConfig := kafka.NewZookeeperConfig()
+	zkConfig.ZookeeperConnect = strings.Split(*zkConnect, ",")
+	zkConfig.Root = *zkRoot
+	zk := kafka.NewZookeeperCoordinator(zkConfig)
+	if err := zk.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to Zookeeper: %s\n", err)
+		os.Exit(1)
+	}
+	defer zk.Disconnect()
+
+	consumerConfig := kafka.DefaultConsumerConfig()
+	consumerConfig.Coordinator = zk
+	consumerConfig.KafkaVersion = *kafkaVersion
+	client := kafka.NewSaramaClient(consumerConfig)
+	if err := client.Initialize(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to Kafka: %s\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var groupList []string
+	if *groups != "" {
+		groupList = strings.Split(*groups, ",")
+	}
+
+	config := kafka.NewLagMonitorConfig()
+	config.Client = client
+	config.Coordinator = zk
+	config.Groups = groupList
+	config.Interval = *interval
+	config.WindowSize = *window
+
+	switch *offsetStorage {
+	case "zookeeper":
+		config.Offsets = zk
+	case "kafka":
+		if len(groupList) == 0 || *topics == "" {
+			fmt.Fprintln(os.Stderr, "--groups and --topics are required for kafka offset storage.")
+			os.Exit(1)
+		}
+		groupTopics := make(map[string][]string)
+		for _, group := range groupList {
+			groupTopics[group] = strings.Split(*topics, ",")
+		}
+		config.Offsets = kafka.NewOffsetStorageGroupLister(client, zk, groupTopics)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown offset storage %s\n", *offsetStorage)
+		os.Exit(1)
+	}
+
+	if *producerConfig != "" {
+		producerConf, err := kafka.ProducerConfigFromFile(*producerConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read producer config: %s\n", err)
+			os.Exit(1)
+		}
+		// Nobody reads successes here.
+		producerConf.AckSuccesses = false
+		producer := kafka.NewSaramaProducer(producerConf)
+		defer producer.Close()
+		go func() {
+			for failed := range producer.Errors() {
+				fmt.Fprintf(os.Stderr, "Failed to publish lag status: %v\n", failed)
+			}
+		}()
+		config.Producer = producer
+		config.Topic = *topic
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	monitor := kafka.NewLagMonitor(config)
+	http.Handle(config.HTTPPath, monitor)
+	go func() {
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to serve HTTP: %s\n", err)
+			os.Exit(1)
+		}
+	}()
+	go monitor.Start()
+
+	ctrlc := make(chan os.Signal, 1)
+	signal.Notify(ctrlc, os.Interrupt)
+	<-ctrlc
+	monitor.Stop()
+}
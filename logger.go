@@ -16,7 +16,10 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
+
 	log "github.com/cihub/seelog"
 )
 
@@ -83,76 +86,191 @@ var logLevelPriorities = map[LogLevel]int {
 	CriticalLevel: 5,
 }
 
+// Fields are key-value pairs describing a log message, e.g. the consumer, group, topic, partition and offset it is about.
+type Fields map[string]interface{}
+
+// StructuredLogger is a KafkaLogger that also accepts fields along with messages instead of formatting them into messages.
+// If Logger implements StructuredLogger, fields are passed to it as is. Otherwise they are appended to messages as key=value pairs.
+type StructuredLogger interface {
+	KafkaLogger
+
+	// Logs a given message with given fields with a given level.
+	Log(level LogLevel, message string, fields Fields)
+}
+
+// FieldsProvider is implemented by log tags describing themselves with fields, e.g. Consumer and WorkerManager.
+// Their fields are added to every message logged with them as a tag.
+type FieldsProvider interface {
+	LogFields() Fields
+}
+
 //Writes a given message with a given tag to log with level Trace.
 func Trace(tag interface{}, message interface{}) {
-	Logger.Trace(fmt.Sprintf("[%s] %s", tag, message))
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), TraceLogTypeId, fmt.Sprintf("%s", message), nil))
+	logf(TraceLevel, tag, "%s", message)
 }
 
 //Formats a given message according to given params with a given tag to log with level Trace.
 func Tracef(tag interface{}, message interface{}, params ...interface{}) {
-	Logger.Trace(fmt.Sprintf("[%s] %s", tag, message), params...)
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), TraceLogTypeId, fmt.Sprintf(fmt.Sprintf("%s", message), params...), nil))
+	logf(TraceLevel, tag, fmt.Sprintf("%s", message), params...)
+}
+
+//Writes a given message with given fields and a given tag to log with level Trace.
+func Tracew(tag interface{}, message string, fields Fields) {
+	logw(TraceLevel, tag, message, fields)
 }
 
 //Writes a given message with a given tag to log with level Debug.
 func Debug(tag interface{}, message interface{}) {
-	Logger.Debug(fmt.Sprintf("[%s] %s", tag, message))
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), DebugLogTypeId, fmt.Sprintf("%s", message), nil))
+	logf(DebugLevel, tag, "%s", message)
 }
 
 //Formats a given message according to given params with a given tag to log with level Debug.
 func Debugf(tag interface{}, message interface{}, params ...interface{}) {
-	Logger.Debug(fmt.Sprintf("[%s] %s", tag, message), params...)
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), DebugLogTypeId, fmt.Sprintf(fmt.Sprintf("%s", message), params...), nil))
+	logf(DebugLevel, tag, fmt.Sprintf("%s", message), params...)
+}
+
+//Writes a given message with given fields and a given tag to log with level Debug.
+func Debugw(tag interface{}, message string, fields Fields) {
+	logw(DebugLevel, tag, message, fields)
 }
 
 //Writes a given message with a given tag to log with level Info.
 func Info(tag interface{}, message interface{}) {
-	Logger.Info(fmt.Sprintf("[%s] %s", tag, message))
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), InfoLogTypeId, fmt.Sprintf("%s", message), nil))
+	logf(InfoLevel, tag, "%s", message)
 }
 
 //Formats a given message according to given params with a given tag to log with level Info.
 func Infof(tag interface{}, message interface{}, params ...interface{}) {
-	Logger.Info(fmt.Sprintf("[%s] %s", tag, message), params...)
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), InfoLogTypeId, fmt.Sprintf(fmt.Sprintf("%s", message), params...), nil))
+	logf(InfoLevel, tag, fmt.Sprintf("%s", message), params...)
+}
+
+//Writes a given message with given fields and a given tag to log with level Info.
+func Infow(tag interface{}, message string, fields Fields) {
+	logw(InfoLevel, tag, message, fields)
 }
 
 //Writes a given message with a given tag to log with level Warn.
 func Warn(tag interface{}, message interface{}) {
-	Logger.Warn(fmt.Sprintf("[%s] %s", tag, message))
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), WarnLogTypeId, fmt.Sprintf("%s", message), nil))
+	logf(WarnLevel, tag, "%s", message)
 }
 
 //Formats a given message according to given params with a given tag to log with level Warn.
 func Warnf(tag interface{}, message interface{}, params ...interface{}) {
-	Logger.Warn(fmt.Sprintf("[%s] %s", tag, message), params...)
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), WarnLogTypeId, fmt.Sprintf(fmt.Sprintf("%s", message), params...), nil))
+	logf(WarnLevel, tag, fmt.Sprintf("%s", message), params...)
+}
+
+//Writes a given message with given fields and a given tag to log with level Warn.
+func Warnw(tag interface{}, message string, fields Fields) {
+	logw(WarnLevel, tag, message, fields)
 }
 
 //Writes a given message with a given tag to log with level Error.
 func Error(tag interface{}, message interface{}) {
-	Logger.Error(fmt.Sprintf("[%s] %s", tag, message))
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), ErrorLogTypeId, fmt.Sprintf("%s", message), nil))
+	logf(ErrorLevel, tag, "%s", message)
 }
 
 //Formats a given message according to given params with a given tag to log with level Error.
 func Errorf(tag interface{}, message interface{}, params ...interface{}) {
-	Logger.Error(fmt.Sprintf("[%s] %s", tag, message), params...)
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), ErrorLogTypeId, fmt.Sprintf(fmt.Sprintf("%s", message), params...), nil))
+	logf(ErrorLevel, tag, fmt.Sprintf("%s", message), params...)
+}
+
+//Writes a given message with given fields and a given tag to log with level Error.
+func Errorw(tag interface{}, message string, fields Fields) {
+	logw(ErrorLevel, tag, message, fields)
 }
 
 //Writes a given message with a given tag to log with level Critical.
 func Critical(tag interface{}, message interface{}) {
-	Logger.Critical(fmt.Sprintf("[%s] %s", tag, message))
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), CriticalLogTypeId, fmt.Sprintf("%s", message), nil))
+	logf(CriticalLevel, tag, "%s", message)
 }
 
 //Formats a given message according to given params with a given tag to log with level Critical.
 func Criticalf(tag interface{}, message interface{}, params ...interface{}) {
-	Logger.Critical(fmt.Sprintf("[%s] %s", tag, message), params...)
-	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), CriticalLogTypeId, fmt.Sprintf(fmt.Sprintf("%s", message), params...), nil))
+	logf(CriticalLevel, tag, fmt.Sprintf("%s", message), params...)
+}
+
+//Writes a given message with given fields and a given tag to log with level Critical.
+func Criticalw(tag interface{}, message string, fields Fields) {
+	logw(CriticalLevel, tag, message, fields)
+}
+
+// logf formats a given message according to given params. StructuredLoggers get the fields of the tag along with the message,
+// other loggers get the message prefixed with the tag as before.
+func logf(level LogLevel, tag interface{}, message string, params ...interface{}) {
+	fields := tagFields(tag, nil)
+	if structured, ok := Logger.(StructuredLogger); ok {
+		structured.Log(level, fmt.Sprintf(message, params...), fields)
+	} else {
+		logAt(level, fmt.Sprintf("[%s] %s", tag, message), params...)
+	}
+	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), logLevels[level], fmt.Sprintf(message, params...), fields.tags()))
+}
+
+// logw writes a given message with given fields merged into the fields of the tag.
+func logw(level LogLevel, tag interface{}, message string, fields Fields) {
+	fields = tagFields(tag, fields)
+	if structured, ok := Logger.(StructuredLogger); ok {
+		structured.Log(level, message, fields)
+	} else {
+		logAt(level, "%s", fmt.Sprintf("[%s] %s%s", tag, message, fields))
+	}
+	EmitterLogs.Emit(newLogLine(fmt.Sprintf("%s", tag), logLevels[level], message, fields.tags()))
+}
+
+// logAt passes a given message and params to the method of Logger for a given level.
+func logAt(level LogLevel, message string, params ...interface{}) {
+	switch level {
+	case TraceLevel:
+		Logger.Trace(message, params...)
+	case DebugLevel:
+		Logger.Debug(message, params...)
+	case InfoLevel:
+		Logger.Info(message, params...)
+	case WarnLevel:
+		Logger.Warn(message, params...)
+	case ErrorLevel:
+		Logger.Error(message, params...)
+	default:
+		Logger.Critical(message, params...)
+	}
+}
+
+// tagFields returns the fields of a given tag if it is a FieldsProvider, overridden by given fields.
+func tagFields(tag interface{}, fields Fields) Fields {
+	merged := make(Fields)
+	if provider, ok := tag.(FieldsProvider); ok {
+		for key, value := range provider.LogFields() {
+			merged[key] = value
+		}
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
+// String formats these fields as space separated key=value pairs sorted by key, with a leading space unless there are no fields.
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&buffer, " %s=%v", key, f[key])
+	}
+	return buffer.String()
+}
+
+// tags returns these fields formatted as LogLine tags.
+func (f Fields) tags() map[string]string {
+	tags := make(map[string]string)
+	for key, value := range f {
+		tags[key] = fmt.Sprint(value)
+	}
+	return tags
 }
 
 //Default implementation of KafkaLogger interface used in this client.
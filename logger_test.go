@@ -0,0 +1,104 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"testing"
+)
+
+type loggedLine struct {
+	level   LogLevel
+	message string
+	fields  Fields
+}
+
+// recordingLogger is a KafkaLogger recording all formatted messages.
+type recordingLogger struct {
+	lines []loggedLine
+}
+
+func (this *recordingLogger) record(level LogLevel, message string, params ...interface{}) {
+	this.lines = append(this.lines, loggedLine{level, fmt.Sprintf(message, params...), nil})
+}
+
+func (this *recordingLogger) Trace(message string, params ...interface{}) {
+	this.record(TraceLevel, message, params...)
+}
+func (this *recordingLogger) Debug(message string, params ...interface{}) {
+	this.record(DebugLevel, message, params...)
+}
+func (this *recordingLogger) Info(message string, params ...interface{}) {
+	this.record(InfoLevel, message, params...)
+}
+func (this *recordingLogger) Warn(message string, params ...interface{}) {
+	this.record(WarnLevel, message, params...)
+}
+func (this *recordingLogger) Error(message string, params ...interface{}) {
+	this.record(ErrorLevel, message, params...)
+}
+func (this *recordingLogger) Critical(message string, params ...interface{}) {
+	this.record(CriticalLevel, message, params...)
+}
+func (this *recordingLogger) GetLogLevel() LogLevel     { return TraceLevel }
+func (this *recordingLogger) IsAllowed(_ LogLevel) bool { return true }
+
+// recordingStructuredLogger is a StructuredLogger recording all messages along with their fields.
+type recordingStructuredLogger struct {
+	recordingLogger
+}
+
+func (this *recordingStructuredLogger) Log(level LogLevel, message string, fields Fields) {
+	this.lines = append(this.lines, loggedLine{level, message, fields})
+}
+
+type fieldsTag struct{}
+
+func (fieldsTag) String() string {
+	return "tag"
+}
+
+func (fieldsTag) LogFields() Fields {
+	return Fields{"consumer": "consumer-1", "group": "group-1"}
+}
+
+func TestStructuredLogging(t *testing.T) {
+	defer func(logger KafkaLogger) { Logger = logger }(Logger)
+
+	structured := &recordingStructuredLogger{}
+	Logger = structured
+	Warnw(fieldsTag{}, "Failed to commit offset", Fields{"offset": int64(5), "group": "group-2"})
+	Infof(fieldsTag{}, "Fetched %d messages", 10)
+	Debug("plain", "No fields")
+
+	assert(t, structured.lines, []loggedLine{
+		{WarnLevel, "Failed to commit offset", Fields{"consumer": "consumer-1", "group": "group-2", "offset": int64(5)}},
+		{InfoLevel, "Fetched 10 messages", Fields{"consumer": "consumer-1", "group": "group-1"}},
+		{DebugLevel, "No fields", Fields{}},
+	})
+
+	plain := &recordingLogger{}
+	Logger = plain
+	Warnw(fieldsTag{}, "Failed to commit offset", Fields{"offset": int64(5)})
+	Infof(fieldsTag{}, "Fetched %d messages", 10)
+	Errorw("plain", "100% failed", nil)
+
+	assert(t, plain.lines, []loggedLine{
+		{WarnLevel, "[tag] Failed to commit offset consumer=consumer-1 group=group-1 offset=5", nil},
+		{InfoLevel, "[tag] Fetched 10 messages", nil},
+		{ErrorLevel, "[plain] 100% failed", nil},
+	})
+}
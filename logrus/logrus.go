@@ -0,0 +1,97 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+// Package logrus adapts a logrus logger to the go_kafka_client StructuredLogger interface.
+package logrus
+
+import (
+	kafka "github.com/mistsys/go_kafka_client"
+	"github.com/sirupsen/logrus"
+)
+
+var levels = map[kafka.LogLevel]logrus.Level{
+	kafka.TraceLevel: logrus.TraceLevel,
+	kafka.DebugLevel: logrus.DebugLevel,
+	kafka.InfoLevel:  logrus.InfoLevel,
+	kafka.WarnLevel:  logrus.WarnLevel,
+	kafka.ErrorLevel: logrus.ErrorLevel,
+	// Critical messages are logged with Error level as logrus Fatal and Panic levels exit or panic.
+	kafka.CriticalLevel: logrus.ErrorLevel,
+}
+
+// Logger is a go_kafka_client StructuredLogger writing messages and their fields to a logrus entry.
+type Logger struct {
+	entry *logrus.Entry
+}
+
+// Creates a new Logger writing to a given logrus logger.
+func NewLogger(logger *logrus.Logger) *Logger {
+	return NewEntryLogger(logrus.NewEntry(logger))
+}
+
+// Creates a new Logger writing to a given logrus entry, adding the entry's fields to every message.
+func NewEntryLogger(entry *logrus.Entry) *Logger {
+	return &Logger{entry: entry}
+}
+
+// Formats a given message according to given params to log with level Trace.
+func (this *Logger) Trace(message string, params ...interface{}) {
+	this.entry.Tracef(message, params...)
+}
+
+// Formats a given message according to given params to log with level Debug.
+func (this *Logger) Debug(message string, params ...interface{}) {
+	this.entry.Debugf(message, params...)
+}
+
+// Formats a given message according to given params to log with level Info.
+func (this *Logger) Info(message string, params ...interface{}) {
+	this.entry.Infof(message, params...)
+}
+
+// Formats a given message according to given params to log with level Warn.
+func (this *Logger) Warn(message string, params ...interface{}) {
+	this.entry.Warnf(message, params...)
+}
+
+// Formats a given message according to given params to log with level Error.
+func (this *Logger) Error(message string, params ...interface{}) {
+	this.entry.Errorf(message, params...)
+}
+
+// Formats a given message according to given params to log with level Critical.
+func (this *Logger) Critical(message string, params ...interface{}) {
+	this.entry.Errorf(message, params...)
+}
+
+// Logs a given message with given fields with a given level.
+func (this *Logger) Log(level kafka.LogLevel, message string, fields kafka.Fields) {
+	this.entry.WithFields(logrus.Fields(fields)).Log(levels[level], message)
+}
+
+// Returns the lowest level enabled in the underlying logrus logger.
+func (this *Logger) GetLogLevel() kafka.LogLevel {
+	for _, level := range []kafka.LogLevel{kafka.TraceLevel, kafka.DebugLevel, kafka.InfoLevel, kafka.WarnLevel, kafka.ErrorLevel} {
+		if this.IsAllowed(level) {
+			return level
+		}
+	}
+	return kafka.CriticalLevel
+}
+
+// Checks whether a given level is enabled in the underlying logrus logger.
+func (this *Logger) IsAllowed(level kafka.LogLevel) bool {
+	return this.entry.Logger.IsLevelEnabled(levels[level])
+}
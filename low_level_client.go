@@ -16,7 +16,9 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -32,7 +34,8 @@ type LowLevelClient interface {
 	Initialize() error
 
 	// This will be called each time the fetch request to Kafka should be issued. Topic, partition and offset are self-explanatory.
-	// Should return a slice of Messages and an error if a fetch error occurred.
+	// Should return a slice of Messages and an error if a fetch error occurred. Data that cannot be decoded should be reported
+	// with a CorruptedDataError so the consumer can skip it when SkipCorruptedMessages is on.
 	// Note that for performance reasons it makes sense to keep open broker connections and reuse them on every fetch call.
 	Fetch(topic string, partition int32, offset int64) ([]*Message, error)
 
@@ -48,10 +51,24 @@ type LowLevelClient interface {
 	Close()
 }
 
-// SaramaClient implements LowLevelClient and uses github.com/Shopify/sarama as underlying implementation.
+// TimestampOffsetClient is a LowLevelClient that can look up offsets by message timestamp.
+type TimestampOffsetClient interface {
+	LowLevelClient
+
+	// Returns the earliest offset of a given topic and partition whose message timestamp is not before a given time,
+	// or the latest offset if there is no such message.
+	GetOffsetForTime(topic string, partition int32, timestamp time.Time) (int64, error)
+}
+
+// SaramaClient implements LowLevelClient and BatchOffsetStorage and uses github.com/Shopify/sarama as underlying implementation.
+// Offsets are stored in Kafka via the group coordinator broker. To use SaramaClient as OffsetStorage use the same instance
+// as LowLevelClient as it is only initialized through the LowLevelClient interface.
 type SaramaClient struct {
-	config *ConsumerConfig
-	client sarama.Client
+	config   *ConsumerConfig
+	client   sarama.Client
+	version  sarama.KafkaVersion
+	shared   *SharedClient
+	attached bool
 }
 
 // Creates a new SaramaClient using a given ConsumerConfig.
@@ -68,21 +85,57 @@ func (this *SaramaClient) String() string {
 
 // This will be called right after connecting to ConsumerCoordinator so this client can initialize itself
 // with bootstrap broker list for example. May return an error to signal this client is unable to work with given configuration.
+// A SaramaClient created by SharedClient.NewSaramaClient attaches to the broker connections of its SharedClient instead.
 func (this *SaramaClient) Initialize() error {
-	bootstrapBrokers, err := BootstrapBrokers(this.config.Coordinator)
-	if err != nil {
-		return err
+	if this.shared != nil {
+		if this.attached {
+			return nil
+		}
+		client, version, err := this.shared.attach(this.config)
+		if err != nil {
+			return err
+		}
+		this.client, this.version, this.attached = client, version, true
+		return nil
 	}
 
-	client, err := sarama.NewClient(bootstrapBrokers, nil)
+	client, version, err := connectSarama(this.config)
 	if err != nil {
 		return err
 	}
-	this.client = client
+	this.client, this.version = client, version
 
 	return nil
 }
 
+// connectSarama creates a sarama client connected to the bootstrap brokers known to the Coordinator of a given ConsumerConfig.
+func connectSarama(config *ConsumerConfig) (sarama.Client, sarama.KafkaVersion, error) {
+	bootstrapBrokers, err := BootstrapBrokers(config.Coordinator)
+	if err != nil {
+		return nil, sarama.KafkaVersion{}, err
+	}
+
+	version, err := ResolveKafkaVersion(config.KafkaVersion, bootstrapBrokers, config.Clientid)
+	if err != nil {
+		return nil, sarama.KafkaVersion{}, err
+	}
+
+	clientConfig := sarama.NewConfig()
+	clientConfig.ClientID = config.Clientid
+	clientConfig.Version = version
+	client, err := sarama.NewClient(bootstrapBrokers, clientConfig)
+	if err != nil {
+		return nil, sarama.KafkaVersion{}, err
+	}
+
+	return client, version, nil
+}
+
+// Returns the Kafka protocol version this client has been initialized with.
+func (this *SaramaClient) KafkaVersion() sarama.KafkaVersion {
+	return this.version
+}
+
 // This will be called each time the fetch request to Kafka should be issued. Topic, partition and offset are self-explanatory.
 // Returns slice of Messages and an error if a fetch error occurred.
 func (this *SaramaClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
@@ -92,14 +145,21 @@ func (this *SaramaClient) Fetch(topic string, partition int32, offset int64) ([]
 		return nil, err
 	}
 
-	fetchRequest := new(sarama.FetchRequest)
-	fetchRequest.MinBytes = this.config.FetchMinBytes
-	fetchRequest.MaxWaitTime = this.config.FetchWaitMaxMs
+	fetchRequest := this.newFetchRequest()
 	Debugf(this, "Adding block: topic=%s, partition=%d, offset=%d, fetchsize=%d", topic, partition, offset, this.config.FetchMessageMaxBytes)
-	fetchRequest.AddBlock(topic, partition, offset, this.config.FetchMessageMaxBytes)
 
-	response, err := leader.Fetch(fetchRequest)
+	var response *sarama.FetchResponse
+	if this.shared != nil {
+		// the block is added to the next request the shared client sends to the leader
+		response, err = this.shared.fetch(leader, fetchRequest, topic, partition, offset, this.config.FetchMessageMaxBytes)
+	} else {
+		fetchRequest.AddBlock(topic, partition, offset, this.config.FetchMessageMaxBytes)
+		response, err = leader.Fetch(fetchRequest)
+	}
 	if err != nil {
+		if _, ok := err.(sarama.PacketDecodingError); ok {
+			return nil, this.corruptedData(leader, fetchRequest.Version, topic, partition, offset, err)
+		}
 		this.client.RefreshMetadata(topic)
 		return nil, err
 	}
@@ -107,29 +167,31 @@ func (this *SaramaClient) Fetch(topic string, partition int32, offset int64) ([]
 	messages := make([]*Message, 0)
 	if response != nil {
 		Debug(this, "Processing fetch response")
-		for topic, partitionAndData := range response.Blocks {
-			for partition, data := range partitionAndData {
-				switch data.Err {
-				case sarama.ErrNoError:
-					{
-						if len(data.MsgSet.Messages) > 0 {
-							this.filterPartitionData(data, offset)
-							messages = this.collectMessages(data, topic, partition)
-							if this.config.Debug {
-								timestamp := time.Now().UnixNano() / int64(time.Millisecond)
-								for _, message := range messages {
-									message.DecodedKey = []int64{timestamp}
-								}
+		// a response of a shared client may contain blocks of other partitions
+		if data := response.GetBlock(topic, partition); data != nil {
+			switch data.Err {
+			case sarama.ErrNoError:
+				{
+					messages = this.collectMessages(data, topic, partition, offset)
+					if len(messages) > 0 {
+						if this.config.Debug {
+							timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+							for _, message := range messages {
+								message.DecodedKey = []int64{timestamp}
 							}
-						} else {
-							Debugf(this, "No messages in %s:%d at offset %d", topic, partition, offset)
 						}
+					} else {
+						Debugf(this, "No messages in %s:%d at offset %d", topic, partition, offset)
 					}
-				default:
-					{
-						this.client.RefreshMetadata(topic)
-						return nil, data.Err
-					}
+				}
+			case sarama.ErrInvalidMessage:
+				{
+					return nil, this.corruptedData(leader, fetchRequest.Version, topic, partition, offset, data.Err)
+				}
+			default:
+				{
+					this.client.RefreshMetadata(topic)
+					return nil, data.Err
 				}
 			}
 		}
@@ -138,6 +200,16 @@ func (this *SaramaClient) Fetch(topic string, partition int32, offset int64) ([]
 	return messages, nil
 }
 
+// corruptedData returns a CorruptedDataError for data at a given offset that failed to decode with a given cause.
+// sarama does not expose the bytes it failed to decode, so they are fetched again from the leader without decoding.
+func (this *SaramaClient) corruptedData(leader *sarama.Broker, version int16, topic string, partition int32, offset int64, cause error) *CorruptedDataError {
+	payload, err := fetchRawRecords(leader.Addr(), this.config.Clientid, version, topic, partition, offset, this.config.FetchMessageMaxBytes, this.config.SocketTimeout)
+	if err != nil {
+		Warnw(this, "Failed to fetch raw bytes of corrupted data", Fields{"topic": topic, "partition": partition, "offset": offset, "error": err})
+	}
+	return &CorruptedDataError{Topic: topic, Partition: partition, Offset: offset, Payload: payload, Cause: cause}
+}
+
 // Checks whether the given error indicates an OffsetOutOfRange error.
 func (this *SaramaClient) IsOffsetOutOfRange(err error) bool {
 	return err == sarama.ErrOffsetOutOfRange
@@ -151,83 +223,277 @@ func (this *SaramaClient) GetAvailableOffset(topic string, partition int32, offs
 	}
 	offset, err := this.client.GetOffset(topic, partition, time)
 	if err != nil {
-		return -1, nil
+		return InvalidOffset, err
 	}
 
 	return offset, nil
 }
 
-// Gracefully shuts down this client.
+// Returns the earliest offset of a given topic and partition whose message timestamp is not before a given time,
+// or the latest offset if there is no such message. Requires KafkaVersion 0.10.1.0 or later.
+func (this *SaramaClient) GetOffsetForTime(topic string, partition int32, timestamp time.Time) (int64, error) {
+	offset, err := this.client.GetOffset(topic, partition, timestamp.UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		return InvalidOffset, err
+	}
+	if offset < 0 {
+		return this.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	}
+	return offset, nil
+}
+
+// Gets the offset for a given group, topic and partition from the group coordinator.
+// May return an error if fails to retrieve the offset.
+func (this *SaramaClient) GetOffset(group string, topic string, partition int32) (int64, error) {
+	topicPartition := &TopicAndPartition{topic, partition}
+	offsets, err := this.GetOffsets(group, []*TopicAndPartition{topicPartition})
+	if err != nil {
+		return InvalidOffset, err
+	}
+	return offsets[*topicPartition].Offset, nil
+}
+
+// Commits the given offset for a given group, topic and partition to the group coordinator.
+// May return an error if fails to commit the offset.
+func (this *SaramaClient) CommitOffset(group string, topic string, partition int32, offset int64) error {
+	return this.CommitOffsets(group, map[TopicAndPartition]OffsetAndMetadata{
+		TopicAndPartition{topic, partition}: OffsetAndMetadata{Offset: offset},
+	})
+}
+
+// Gets the offsets and metadata for a given group and topic partitions from the group coordinator in a single request.
+// Returns the last processed offsets, i.e. one less than the offsets stored in Kafka. Partitions without a committed offset are mapped to InvalidOffset.
+func (this *SaramaClient) GetOffsets(group string, topicPartitions []*TopicAndPartition) (map[TopicAndPartition]OffsetAndMetadata, error) {
+	coordinator, err := this.coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &sarama.OffsetFetchRequest{
+		Version:       1,
+		ConsumerGroup: group,
+	}
+	for _, topicPartition := range topicPartitions {
+		request.AddPartition(topicPartition.Topic, topicPartition.Partition)
+	}
+
+	response, err := coordinator.FetchOffset(request)
+	if err != nil {
+		this.client.RefreshCoordinator(group)
+		return nil, err
+	}
+
+	offsets := make(map[TopicAndPartition]OffsetAndMetadata)
+	for _, topicPartition := range topicPartitions {
+		block := response.GetBlock(topicPartition.Topic, topicPartition.Partition)
+		if block == nil {
+			return nil, fmt.Errorf("Group coordinator returned no offset for %s", topicPartition)
+		}
+
+		switch block.Err {
+		case sarama.ErrNoError:
+			offsets[*topicPartition] = OffsetAndMetadata{Offset: lastProcessedOffset(block.Offset), Metadata: block.Metadata}
+		case sarama.ErrUnknownTopicOrPartition:
+			offsets[*topicPartition] = OffsetAndMetadata{Offset: InvalidOffset}
+		case sarama.ErrNotCoordinatorForConsumer, sarama.ErrConsumerCoordinatorNotAvailable:
+			this.client.RefreshCoordinator(group)
+			return nil, block.Err
+		default:
+			return nil, block.Err
+		}
+	}
+
+	return offsets, nil
+}
+
+// Commits the given last processed offsets and metadata for a given group to the group coordinator in a single request.
+// Kafka stores the offsets of the next messages to consume, i.e. one more than the given offsets.
+// Returns the first error reported for any partition.
+func (this *SaramaClient) CommitOffsets(group string, offsets map[TopicAndPartition]OffsetAndMetadata) error {
+	coordinator, err := this.coordinator(group)
+	if err != nil {
+		return err
+	}
+
+	request := &sarama.OffsetCommitRequest{
+		Version:                 1,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+	}
+	for topicPartition, offset := range offsets {
+		request.AddBlock(topicPartition.Topic, topicPartition.Partition, nextOffset(offset.Offset), sarama.ReceiveTime, offset.Metadata)
+	}
+
+	response, err := coordinator.CommitOffset(request)
+	if err != nil {
+		this.client.RefreshCoordinator(group)
+		return err
+	}
+
+	for topic, partitions := range response.Errors {
+		for partition, kerr := range partitions {
+			switch kerr {
+			case sarama.ErrNoError:
+			case sarama.ErrNotCoordinatorForConsumer, sarama.ErrConsumerCoordinatorNotAvailable:
+				this.client.RefreshCoordinator(group)
+				return kerr
+			default:
+				return fmt.Errorf("Failed to commit offset for %s:%d: %s", topic, partition, kerr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// nextOffset converts a last processed offset of the OffsetStorage API to the offset of the next message to consume,
+// which is what Kafka stores for a group and other Kafka tools expect.
+func nextOffset(lastProcessed int64) int64 {
+	if lastProcessed == BeforeFirstOffset {
+		return 0
+	}
+	if lastProcessed < 0 {
+		return lastProcessed
+	}
+	return lastProcessed + 1
+}
+
+// lastProcessedOffset converts an offset stored in Kafka for a group back to the last processed offset.
+// Kafka returns -1 if the group has not committed an offset, which is InvalidOffset, while a committed 0 is BeforeFirstOffset.
+func lastProcessedOffset(next int64) int64 {
+	if next < 0 {
+		return InvalidOffset
+	}
+	if next == 0 {
+		return BeforeFirstOffset
+	}
+	return next - 1
+}
+
+func (this *SaramaClient) coordinator(group string) (*sarama.Broker, error) {
+	if this.client == nil {
+		return nil, errors.New("Sarama client is not initialized")
+	}
+	return this.client.Coordinator(group)
+}
+
+// Gracefully shuts down this client. A SaramaClient attached to a SharedClient detaches from it instead,
+// and the broker connections are closed once the last attached client is closed.
 func (this *SaramaClient) Close() {
+	if this.shared != nil {
+		if this.attached {
+			this.attached = false
+			this.shared.detach()
+		}
+		return
+	}
 	this.client.Close()
 }
 
-func (this *SaramaClient) filterPartitionData(partitionData *sarama.FetchResponseBlock, requestedOffset int64) {
-	lowestCorrectIndex := 0
-	for i, v := range partitionData.MsgSet.Messages {
-		if v.Offset < requestedOffset {
-			lowestCorrectIndex = i + 1
-		} else {
-			break
-		}
+func (this *SaramaClient) newFetchRequest() *sarama.FetchRequest {
+	fetchRequest := new(sarama.FetchRequest)
+	fetchRequest.MinBytes = this.config.FetchMinBytes
+	fetchRequest.MaxWaitTime = this.config.FetchWaitMaxMs
+	if this.version.IsAtLeast(sarama.V0_10_0_0) {
+		fetchRequest.Version = 2
 	}
-	partitionData.MsgSet.Messages = partitionData.MsgSet.Messages[lowestCorrectIndex:]
+	if this.version.IsAtLeast(sarama.V0_10_1_0) {
+		fetchRequest.Version = 3
+		fetchRequest.MaxBytes = sarama.MaxResponseSize
+	}
+	if this.version.IsAtLeast(sarama.V0_11_0_0) {
+		fetchRequest.Version = 4
+		fetchRequest.Isolation = sarama.ReadUncommitted
+	}
+
+	return fetchRequest
 }
 
-func (this *SaramaClient) collectMessages(partitionData *sarama.FetchResponseBlock, topic string, partition int32) []*Message {
+func (this *SaramaClient) collectMessages(partitionData *sarama.FetchResponseBlock, topic string, partition int32, requestedOffset int64) []*Message {
 	messages := make([]*Message, 0)
-
-	for _, message := range partitionData.MsgSet.Messages {
-		if message.Msg.Set != nil {
-			for _, wrapped := range message.Msg.Set.Messages {
-				decodedKey, err := this.config.KeyDecoder.Decode(wrapped.Msg.Key)
-				if err != nil {
-					//TODO: what if we fail to decode the key: fail-fast or fail-safe strategy?
-					Error(this, err.Error())
-				}
-				decodedValue, err := this.config.ValueDecoder.Decode(wrapped.Msg.Value)
-				if err != nil {
-					//TODO: what if we fail to decode the value: fail-fast or fail-safe strategy?
-					Error(this, err.Error())
+	keyDecoder, valueDecoder := this.config.decoders(topic)
+
+	for _, records := range partitionData.RecordsSet {
+		if records.MsgSet != nil {
+			for _, message := range records.MsgSet.Messages {
+				if message.Msg.Set != nil {
+					inner := message.Msg.Set.Messages
+					for _, wrapped := range inner {
+						offset := wrapped.Offset
+						if wrapped.Msg.Version >= 1 {
+							// inner offsets of v1 compressed messages are relative, the wrapper holds the offset of the last one
+							offset += message.Offset - inner[len(inner)-1].Offset
+						}
+						if offset < requestedOffset {
+							continue
+						}
+						messages = append(messages, this.newMessage(keyDecoder, valueDecoder, wrapped.Msg.Key, wrapped.Msg.Value, topic, partition, offset,
+							partitionData.HighWaterMarkOffset, wrapped.Msg.Timestamp, nil))
+					}
+				} else {
+					if message.Offset < requestedOffset {
+						continue
+					}
+					messages = append(messages, this.newMessage(keyDecoder, valueDecoder, message.Msg.Key, message.Msg.Value, topic, partition, message.Offset,
+						partitionData.HighWaterMarkOffset, message.Msg.Timestamp, nil))
 				}
-				messages = append(messages, &Message{
-					Key:                 wrapped.Msg.Key,
-					Value:               wrapped.Msg.Value,
-					DecodedKey:          decodedKey,
-					DecodedValue:        decodedValue,
-					Topic:               topic,
-					Partition:           partition,
-					Offset:              wrapped.Offset,
-					HighwaterMarkOffset: partitionData.HighWaterMarkOffset,
-				})
 			}
-		} else {
-			decodedKey, err := this.config.KeyDecoder.Decode(message.Msg.Key)
-			if err != nil {
-				//TODO: what if we fail to decode the key: fail-fast or fail-safe strategy?
-				Error(this, err.Error())
+		}
+
+		if records.RecordBatch != nil {
+			batch := records.RecordBatch
+			if batch.Control {
+				continue
 			}
-			decodedValue, err := this.config.ValueDecoder.Decode(message.Msg.Value)
-			if err != nil {
-				//TODO: what if we fail to decode the value: fail-fast or fail-safe strategy?
-				Error(this, err.Error())
+			for _, record := range batch.Records {
+				offset := batch.FirstOffset + record.OffsetDelta
+				if offset < requestedOffset {
+					continue
+				}
+				timestamp := batch.FirstTimestamp.Add(record.TimestampDelta)
+				if batch.LogAppendTime {
+					timestamp = batch.MaxTimestamp
+				}
+				headers := make([]*MessageHeader, 0, len(record.Headers))
+				for _, header := range record.Headers {
+					headers = append(headers, &MessageHeader{Key: header.Key, Value: header.Value})
+				}
+				messages = append(messages, this.newMessage(keyDecoder, valueDecoder, record.Key, record.Value, topic, partition, offset,
+					partitionData.HighWaterMarkOffset, timestamp, headers))
 			}
-			messages = append(messages, &Message{
-				Key:                 message.Msg.Key,
-				Value:               message.Msg.Value,
-				DecodedKey:          decodedKey,
-				DecodedValue:        decodedValue,
-				Topic:               topic,
-				Partition:           partition,
-				Offset:              message.Offset,
-				HighwaterMarkOffset: partitionData.HighWaterMarkOffset,
-			})
 		}
 	}
 
 	return messages
 }
 
+func (this *SaramaClient) newMessage(keyDecoder Decoder, valueDecoder Decoder, key []byte, value []byte, topic string, partition int32, offset int64,
+	highwaterMarkOffset int64, timestamp time.Time, headers []*MessageHeader) *Message {
+	decodedKey, err := keyDecoder.Decode(key)
+	if err != nil {
+		//TODO: what if we fail to decode the key: fail-fast or fail-safe strategy?
+		Error(this, err.Error())
+	}
+	decodedValue, err := valueDecoder.Decode(value)
+	if err != nil {
+		//TODO: what if we fail to decode the value: fail-fast or fail-safe strategy?
+		Error(this, err.Error())
+	}
+
+	return &Message{
+		Key:                 key,
+		Value:               value,
+		DecodedKey:          decodedKey,
+		DecodedValue:        decodedValue,
+		Topic:               topic,
+		Partition:           partition,
+		Offset:              offset,
+		HighwaterMarkOffset: highwaterMarkOffset,
+		Timestamp:           timestamp,
+		Headers:             headers,
+	}
+}
+
 // SiestaClient implements LowLevelClient and OffsetStorage and uses github.com/mistsys/siesta as underlying implementation.
 type SiestaClient struct {
 	config    *ConsumerConfig
@@ -275,20 +541,24 @@ func (this *SiestaClient) Initialize() error {
 func (this *SiestaClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
 	Tracef(this, "Fetching %s %d from %d", topic, partition, offset)
 	response, err := this.connector.Fetch(topic, partition, offset)
+	if err == siesta.ErrInvalidMessage {
+		return nil, this.corruptedData(topic, partition, offset, err)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	messages := make([]*Message, 0)
 
+	keyDecoder, valueDecoder := this.config.decoders(topic)
 	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
 	collector := func(topic string, partition int32, offset int64, key []byte, value []byte) error {
-		decodedKey, err := this.config.KeyDecoder.Decode(key)
+		decodedKey, err := keyDecoder.Decode(key)
 		if err != nil {
 			//TODO: what if we fail to decode the key: fail-fast or fail-safe strategy?
 			Error(this, err.Error())
 		}
-		decodedValue, err := this.config.ValueDecoder.Decode(value)
+		decodedValue, err := valueDecoder.Decode(value)
 		if err != nil {
 			//TODO: what if we fail to decode the value: fail-fast or fail-safe strategy?
 			Error(this, err.Error())
@@ -311,7 +581,45 @@ func (this *SiestaClient) Fetch(topic string, partition int32, offset int64) ([]
 		return err
 	}
 
-	return messages, response.CollectMessages(collector)
+	err = response.CollectMessages(collector)
+	if err == siesta.ErrInvalidMessage {
+		return nil, this.corruptedData(topic, partition, offset, err)
+	}
+	return messages, err
+}
+
+// corruptedData returns a CorruptedDataError for data at a given offset that failed to decode with a given cause.
+// siesta does not expose the bytes it failed to decode, so they are fetched again from the leader without decoding.
+func (this *SiestaClient) corruptedData(topic string, partition int32, offset int64, cause error) *CorruptedDataError {
+	payload, err := this.fetchRawRecords(topic, partition, offset)
+	if err != nil {
+		Warnw(this, "Failed to fetch raw bytes of corrupted data", Fields{"topic": topic, "partition": partition, "offset": offset, "error": err})
+	}
+	return &CorruptedDataError{Topic: topic, Partition: partition, Offset: offset, Payload: payload, Cause: cause}
+}
+
+func (this *SiestaClient) fetchRawRecords(topic string, partition int32, offset int64) ([]byte, error) {
+	metadata, err := this.connector.GetTopicMetadata([]string{topic})
+	if err != nil {
+		return nil, err
+	}
+
+	leader := int32(-1)
+	for _, topicMetadata := range metadata.TopicsMetadata {
+		for _, partitionMetadata := range topicMetadata.PartitionsMetadata {
+			if topicMetadata.Topic == topic && partitionMetadata.PartitionID == partition {
+				leader = partitionMetadata.Leader
+			}
+		}
+	}
+	for _, broker := range metadata.Brokers {
+		if broker.ID == leader {
+			addr := net.JoinHostPort(broker.Host, fmt.Sprint(broker.Port))
+			// siesta speaks the version 0 protocol
+			return fetchRawRecords(addr, this.config.Clientid, 0, topic, partition, offset, this.config.FetchMessageMaxBytes, this.config.SocketTimeout)
+		}
+	}
+	return nil, fmt.Errorf("No leader for %s:%d", topic, partition)
 }
 
 // Checks whether the given error indicates an OffsetOutOfRange error.
@@ -0,0 +1,62 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import "time"
+
+const (
+	// Measure the age of a message from its timestamp, or from its fetch time if it has no timestamp
+	TimestampAge = "timestamp"
+	// Measure the age of a message from the time it was fetched
+	FetchTimeAge = "fetch"
+)
+
+// Returns the time this message was fetched from Kafka. Zero if the message did not come from a fetcher.
+func (m *Message) FetchedAt() time.Time {
+	return m.fetched
+}
+
+// setFetched records a given fetch time for all given messages.
+func setFetched(messages []*Message, fetched time.Time) {
+	for _, message := range messages {
+		message.fetched = fetched
+	}
+}
+
+// messageAgeStart returns the time the age of a given message is measured from, according to a given MessageAgeSource.
+// A timestamp after the fetch time, e.g. set by a producer with a skewed clock, is not trusted and the fetch time is used instead.
+func messageAgeStart(message *Message, source string) time.Time {
+	if source == TimestampAge && !message.Timestamp.IsZero() && (message.fetched.IsZero() || message.Timestamp.Before(message.fetched)) {
+		return message.Timestamp
+	}
+	return message.fetched
+}
+
+// batchReadyAt returns the time all messages of a given batch are at least minAge old.
+// Messages without a known timestamp or fetch time are considered old enough.
+func batchReadyAt(batch []*Message, minAge time.Duration, source string) time.Time {
+	var ready time.Time
+	for _, message := range batch {
+		start := messageAgeStart(message, source)
+		if start.IsZero() {
+			continue
+		}
+		if at := start.Add(minAge); at.After(ready) {
+			ready = at
+		}
+	}
+	return ready
+}
@@ -0,0 +1,110 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchReadyAt(t *testing.T) {
+	now := time.Now()
+	batch := []*Message{
+		&Message{Offset: 0, Timestamp: now.Add(-time.Minute), fetched: now},
+		&Message{Offset: 1, Timestamp: now.Add(-2 * time.Second), fetched: now},
+		&Message{Offset: 2, fetched: now.Add(-time.Second)},
+		&Message{Offset: 3},
+	}
+
+	// the youngest message decides, messages without a timestamp fall back to their fetch time
+	assert(t, batchReadyAt(batch, 5*time.Second, TimestampAge), now.Add(4*time.Second))
+	assert(t, batchReadyAt(batch, 5*time.Second, FetchTimeAge), now.Add(5*time.Second))
+
+	// messages with neither a timestamp nor a fetch time do not hold a batch
+	assert(t, batchReadyAt(batch[3:], 5*time.Second, TimestampAge).IsZero(), true)
+
+	// timestamps after the fetch time are not trusted
+	skewed := []*Message{&Message{Offset: 4, Timestamp: now.Add(time.Hour), fetched: now}}
+	assert(t, batchReadyAt(skewed, 5*time.Second, TimestampAge), now.Add(5*time.Second))
+}
+
+func TestMinMessageAge(t *testing.T) {
+	topic := "test-min-message-age"
+	topics := map[string][]int32{topic: []int32{0}}
+	minAge := 500 * time.Millisecond
+
+	var lock sync.Mutex
+	ages := make([]time.Duration, 0)
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 20), topics)
+	config.FetchBatchSize = 5
+	config.FetchBatchTimeout = 50 * time.Millisecond
+	config.MinMessageAge = minAge
+	config.Strategy = func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		inLock(&lock, func() { ages = append(ages, time.Since(msg.FetchedAt())) })
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+
+	timeout := time.After(consumeTimeout)
+	for {
+		var consumed int
+		inLock(&lock, func() { consumed = len(ages) })
+		if consumed == 20 {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("Failed to consume all messages within %s", consumeTimeout)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	closeWithin(t, 10*time.Second, consumer)
+
+	for i, age := range ages {
+		if age < minAge {
+			t.Errorf("Message %d was processed %s after it was fetched, expected at least %s", i, age, minAge)
+		}
+	}
+}
+
+func TestMinMessageAgeGivesUpHeldBatchOnStop(t *testing.T) {
+	topic := "test-min-message-age-stop"
+	topics := map[string][]int32{topic: []int32{0}}
+	var consumed int32
+
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 10), topics)
+	config.FetchBatchTimeout = 50 * time.Millisecond
+	config.MinMessageAge = time.Hour
+	config.MessageAgeSource = FetchTimeAge
+	config.Strategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult {
+		atomic.AddInt32(&consumed, 1)
+		return NewSuccessfulResult(id)
+	}
+	committed, _ := config.OffsetStorage.GetOffset(config.Groupid, topic, 0)
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+	time.Sleep(500 * time.Millisecond)
+	closeWithin(t, 10*time.Second, consumer)
+
+	assert(t, atomic.LoadInt32(&consumed), int32(0))
+	offset, _ := config.OffsetStorage.GetOffset(config.Groupid, topic, 0)
+	assert(t, offset, committed)
+}
@@ -16,8 +16,10 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -31,6 +33,8 @@ type messageBuffer struct {
 	stopSending    bool
 	TopicPartition TopicAndPartition
 	askNextBatch   chan TopicAndPartition
+	size           int64
+	batchSpan      Span
 }
 
 func newMessageBuffer(topicPartition TopicAndPartition, outputChannel chan []*Message, config *ConsumerConfig) *messageBuffer {
@@ -86,17 +90,34 @@ func (mb *messageBuffer) flush() {
 				break flushLoop
 			case <-timeout.C:
 				if mb.stopSending {
+					mb.endBatchSpan()
 					return
 				}
 			}
 		}
+		mb.endBatchSpan()
 		if Logger.IsAllowed(TraceLevel) {
 			Trace(mb, "Flushed")
 		}
 		mb.Messages = make([]*Message, 0)
+		atomic.StoreInt64(&mb.size, 0)
 	}
 }
 
+// endBatchSpan ends the span of the batch being flushed. Must be called with the message lock held.
+func (mb *messageBuffer) endBatchSpan() {
+	if mb.batchSpan != nil {
+		mb.batchSpan.SetAttributes(SpanAttribute{"kafka.messages", len(mb.Messages)})
+		mb.batchSpan.End()
+		mb.batchSpan = nil
+	}
+}
+
+// Gets the number of messages waiting in this buffer to be flushed.
+func (mb *messageBuffer) numBuffered() int {
+	return int(atomic.LoadInt64(&mb.size))
+}
+
 func (mb *messageBuffer) start(fetcherChannel chan TopicAndPartition) {
 	mb.askNextBatch = fetcherChannel
 	go mb.autoFlush()
@@ -160,7 +181,11 @@ func (mb *messageBuffer) add(msg *Message) {
 	if Logger.IsAllowed(TraceLevel) {
 		Tracef(mb, "Added message: %s", msg)
 	}
+	if len(mb.Messages) == 0 {
+		_, mb.batchSpan = mb.Config.Tracer.StartSpan(context.Background(), SpanBatch, partitionAttributes(mb.TopicPartition)...)
+	}
 	mb.Messages = append(mb.Messages, msg)
+	atomic.StoreInt64(&mb.size, int64(len(mb.Messages)))
 	if len(mb.Messages) == mb.Config.FetchBatchSize {
 		if Logger.IsAllowed(TraceLevel) {
 			Trace(mb, "Batch is ready. Flushing")
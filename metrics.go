@@ -18,30 +18,121 @@ package go_kafka_client
 import (
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	metrics "github.com/rcrowley/go-metrics"
 )
 
 type ConsumerMetrics struct {
-	registry metrics.Registry
+	registry     metrics.Registry
+	consumerName string
+	prefix       string
+	names        []string
 
 	numFetchRoutinesCounter metrics.Counter
-	fetchersIdleTimer       metrics.Timer
-	fetchDurationTimer      metrics.Timer
+	fetchersIdleTimer       *bucketedTimer
+	fetchDurationTimer      *bucketedTimer
 
 	numWorkerManagersGauge metrics.Gauge
 	activeWorkersCounter   metrics.Counter
 	pendingWMsTasksCounter metrics.Counter
 	taskTimeoutCounter     metrics.Counter
-	wmsBatchDurationTimer  metrics.Timer
-	wmsIdleTimer           metrics.Timer
+	wmsBatchDurationTimer  *bucketedTimer
+	wmsIdleTimer           *bucketedTimer
+	rateLimitWaitTimer     *bucketedTimer
+	messageAgeWaitTimer    *bucketedTimer
+
+	quarantinedRegionsCounter metrics.Counter
+	quarantinedOffsetsCounter metrics.Counter
+
+	partitions             map[TopicAndPartition]*partitionMetrics
+	partitionsLock         sync.Mutex
+	totalCommittedLagGauge metrics.Gauge
+	totalProcessedLagGauge metrics.Gauge
+}
+
+// PartitionLag describes how far a consumer is behind the end of a single topic partition.
+// Offsets are InvalidOffset and lags are 0 until they are known.
+type PartitionLag struct {
+	// High watermark offset of the partition as of the last fetch response.
+	HighwaterMarkOffset int64
+
+	// Last offset committed for the partition.
+	CommittedOffset int64
+
+	// Largest offset processed for the partition.
+	ProcessedOffset int64
+
+	// Number of messages between the committed offset and the high watermark.
+	CommittedLag int64
+
+	// Number of messages between the processed offset and the high watermark.
+	ProcessedLag int64
+}
+
+// partitionMetrics holds the metrics of a single topic partition. They are registered when the partition is assigned to the consumer
+// and unregistered when it is revoked.
+type partitionMetrics struct {
+	lag                    PartitionLag
+	committedLagGauge      metrics.Gauge
+	processedLagGauge      metrics.Gauge
+	messagesMeter          metrics.Meter
+	bytesMeter             metrics.Meter
+	taskDurationTimer      *bucketedTimer
+	taskRetriesCounter     metrics.Counter
+	failedDecisionCounters map[FailedDecision]metrics.Counter
+	lastCommitAgeGauge     *commitAgeGauge
+	workersGauge           metrics.Gauge
+	circuitStateGauge      metrics.Gauge
+	circuitOpensCounter    metrics.Counter
+	names                  []string
+}
+
+// Counts a given batch of messages and its size in bytes.
+func (this *partitionMetrics) consumed(batch []*Message) {
+	var bytes int64
+	for _, message := range batch {
+		bytes += int64(len(message.Key) + len(message.Value))
+	}
+	this.messagesMeter.Mark(int64(len(batch)))
+	this.bytesMeter.Mark(bytes)
+}
+
+func (this *partitionMetrics) taskDuration() metrics.Timer {
+	return this.taskDurationTimer
+}
+
+func (this *partitionMetrics) taskRetries() metrics.Counter {
+	return this.taskRetriesCounter
 }
 
-func newConsumerMetrics(consumerName, prefix string) *ConsumerMetrics {
+func (this *partitionMetrics) workers() metrics.Gauge {
+	return this.workersGauge
+}
+
+func (this *partitionMetrics) circuitState() metrics.Gauge {
+	return this.circuitStateGauge
+}
+
+func (this *partitionMetrics) circuitOpens() metrics.Counter {
+	return this.circuitOpensCounter
+}
+
+func (this *partitionMetrics) failedDecision(decision FailedDecision) metrics.Counter {
+	return this.failedDecisionCounters[decision]
+}
+
+// Creates a new ConsumerMetrics for a given consumer registering all its metrics in a given registry.
+// Metric names contain the consumer name, so multiple consumers may share a registry.
+func newConsumerMetrics(consumerName, prefix string, registry metrics.Registry) *ConsumerMetrics {
 	kafkaMetrics := &ConsumerMetrics{
-		registry: metrics.DefaultRegistry,
+		registry:     registry,
+		consumerName: consumerName,
+		partitions:   make(map[TopicAndPartition]*partitionMetrics),
 	}
 
 	// Ensure prefix ends with a dot (.) so it plays nice with statsd/graphite
@@ -49,20 +140,55 @@ func newConsumerMetrics(consumerName, prefix string) *ConsumerMetrics {
 	if prefix != "" && prefix[len(prefix)-1:] != "." {
 		prefix += "."
 	}
+	kafkaMetrics.prefix = prefix
 
-	kafkaMetrics.fetchersIdleTimer = metrics.NewRegisteredTimer(fmt.Sprintf("%sFetchersIdleTime-%s", prefix, consumerName), kafkaMetrics.registry)
-	kafkaMetrics.fetchDurationTimer = metrics.NewRegisteredTimer(fmt.Sprintf("%sFetchDuration-%s", prefix, consumerName), kafkaMetrics.registry)
+	kafkaMetrics.fetchersIdleTimer = newBucketedTimer()
+	kafkaMetrics.register("FetchersIdleTime", kafkaMetrics.fetchersIdleTimer)
+	kafkaMetrics.fetchDurationTimer = newBucketedTimer()
+	kafkaMetrics.register("FetchDuration", kafkaMetrics.fetchDurationTimer)
 
-	kafkaMetrics.numWorkerManagersGauge = metrics.NewRegisteredGauge(fmt.Sprintf("%sNumWorkerManagers-%s", prefix, consumerName), kafkaMetrics.registry)
-	kafkaMetrics.activeWorkersCounter = metrics.NewRegisteredCounter(fmt.Sprintf("%sWMsActiveWorkers-%s", prefix, consumerName), kafkaMetrics.registry)
-	kafkaMetrics.pendingWMsTasksCounter = metrics.NewRegisteredCounter(fmt.Sprintf("%sWMsPendingTasks-%s", prefix, consumerName), kafkaMetrics.registry)
-	kafkaMetrics.taskTimeoutCounter = metrics.NewRegisteredCounter(fmt.Sprintf("%sTaskTimeouts-%s", prefix, consumerName), kafkaMetrics.registry)
-	kafkaMetrics.wmsBatchDurationTimer = metrics.NewRegisteredTimer(fmt.Sprintf("%sWMsBatchDuration-%s", prefix, consumerName), kafkaMetrics.registry)
-	kafkaMetrics.wmsIdleTimer = metrics.NewRegisteredTimer(fmt.Sprintf("%sWMsIdleTime-%s", prefix, consumerName), kafkaMetrics.registry)
+	kafkaMetrics.numWorkerManagersGauge = metrics.NewGauge()
+	kafkaMetrics.register("NumWorkerManagers", kafkaMetrics.numWorkerManagersGauge)
+	kafkaMetrics.activeWorkersCounter = metrics.NewCounter()
+	kafkaMetrics.register("WMsActiveWorkers", kafkaMetrics.activeWorkersCounter)
+	kafkaMetrics.pendingWMsTasksCounter = metrics.NewCounter()
+	kafkaMetrics.register("WMsPendingTasks", kafkaMetrics.pendingWMsTasksCounter)
+	kafkaMetrics.taskTimeoutCounter = metrics.NewCounter()
+	kafkaMetrics.register("TaskTimeouts", kafkaMetrics.taskTimeoutCounter)
+	kafkaMetrics.wmsBatchDurationTimer = newBucketedTimer()
+	kafkaMetrics.register("WMsBatchDuration", kafkaMetrics.wmsBatchDurationTimer)
+	kafkaMetrics.wmsIdleTimer = newBucketedTimer()
+	kafkaMetrics.register("WMsIdleTime", kafkaMetrics.wmsIdleTimer)
+	kafkaMetrics.rateLimitWaitTimer = newBucketedTimer()
+	kafkaMetrics.register("RateLimitWait", kafkaMetrics.rateLimitWaitTimer)
+	kafkaMetrics.messageAgeWaitTimer = newBucketedTimer()
+	kafkaMetrics.register("MessageAgeWait", kafkaMetrics.messageAgeWaitTimer)
+
+	kafkaMetrics.quarantinedRegionsCounter = metrics.NewCounter()
+	kafkaMetrics.register("QuarantinedRegions", kafkaMetrics.quarantinedRegionsCounter)
+	kafkaMetrics.quarantinedOffsetsCounter = metrics.NewCounter()
+	kafkaMetrics.register("QuarantinedOffsets", kafkaMetrics.quarantinedOffsetsCounter)
+
+	kafkaMetrics.totalCommittedLagGauge = metrics.NewGauge()
+	kafkaMetrics.register("ConsumerLag", kafkaMetrics.totalCommittedLagGauge)
+	kafkaMetrics.totalProcessedLagGauge = metrics.NewGauge()
+	kafkaMetrics.register("ProcessingLag", kafkaMetrics.totalProcessedLagGauge)
 
 	return kafkaMetrics
 }
 
+// register registers a given consumer wide metric as <prefix><name>-<consumer> and remembers its name so it can be unregistered on close.
+func (this *ConsumerMetrics) register(name string, metric interface{}) {
+	name = fmt.Sprintf("%s%s-%s", this.prefix, name, this.consumerName)
+	this.registry.Register(name, metric)
+	this.names = append(this.names, name)
+}
+
+// Returns the registry this ConsumerMetrics registers its metrics in.
+func (this *ConsumerMetrics) Registry() metrics.Registry {
+	return this.registry
+}
+
 func (this *ConsumerMetrics) fetchersIdle() metrics.Timer {
 	return this.fetchersIdleTimer
 }
@@ -79,6 +205,14 @@ func (this *ConsumerMetrics) wMsIdle() metrics.Timer {
 	return this.wmsIdleTimer
 }
 
+func (this *ConsumerMetrics) rateLimitWait() metrics.Timer {
+	return this.rateLimitWaitTimer
+}
+
+func (this *ConsumerMetrics) messageAgeWait() metrics.Timer {
+	return this.messageAgeWaitTimer
+}
+
 func (this *ConsumerMetrics) wMsBatchDuration() metrics.Timer {
 	return this.wmsBatchDurationTimer
 }
@@ -95,9 +229,180 @@ func (this *ConsumerMetrics) activeWorkers() metrics.Counter {
 	return this.activeWorkersCounter
 }
 
+func (this *ConsumerMetrics) quarantinedRegions() metrics.Counter {
+	return this.quarantinedRegionsCounter
+}
+
+func (this *ConsumerMetrics) quarantinedOffsets() metrics.Counter {
+	return this.quarantinedOffsetsCounter
+}
+
+// Gets the lag of every topic partition this consumer is tracking.
+func (this *ConsumerMetrics) Lags() map[TopicAndPartition]PartitionLag {
+	lags := make(map[TopicAndPartition]PartitionLag)
+	inLock(&this.partitionsLock, func() {
+		for topicPartition, partition := range this.partitions {
+			lags[topicPartition] = partition.lag
+		}
+	})
+	return lags
+}
+
+// partition gets the metrics of a given topic partition, registering them if the partition is not tracked yet.
+func (this *ConsumerMetrics) partition(topicPartition TopicAndPartition) *partitionMetrics {
+	var partition *partitionMetrics
+	inLock(&this.partitionsLock, func() {
+		partition = this.getOrRegisterPartition(topicPartition)
+	})
+	return partition
+}
+
+// eachPartition calls a given function for the metrics of every tracked topic partition. The lock is not held during the calls.
+func (this *ConsumerMetrics) eachPartition(f func(TopicAndPartition, *partitionMetrics)) {
+	partitions := make(map[TopicAndPartition]*partitionMetrics)
+	inLock(&this.partitionsLock, func() {
+		for topicPartition, partition := range this.partitions {
+			partitions[topicPartition] = partition
+		}
+	})
+	for topicPartition, partition := range partitions {
+		f(topicPartition, partition)
+	}
+}
+
+// updateHighwaterMark sets the high watermark of a given topic partition as seen in a fetch response.
+func (this *ConsumerMetrics) updateHighwaterMark(topicPartition TopicAndPartition, highwaterMarkOffset int64) {
+	this.updateLag(topicPartition, func(partition *partitionMetrics) {
+		partition.lag.HighwaterMarkOffset = highwaterMarkOffset
+	})
+}
+
+// updateCommittedOffset sets the last offset committed for a given topic partition.
+func (this *ConsumerMetrics) updateCommittedOffset(topicPartition TopicAndPartition, offset int64) {
+	this.updateLag(topicPartition, func(partition *partitionMetrics) {
+		partition.lag.CommittedOffset = offset
+		partition.lastCommitAgeGauge.committed()
+	})
+}
+
+// updateProcessedOffset sets the largest offset processed for a given topic partition.
+func (this *ConsumerMetrics) updateProcessedOffset(topicPartition TopicAndPartition, offset int64) {
+	this.updateLag(topicPartition, func(partition *partitionMetrics) {
+		partition.lag.ProcessedOffset = offset
+	})
+}
+
+// removePartition unregisters the metrics of a given topic partition, e.g. when it is no longer owned by this consumer.
+func (this *ConsumerMetrics) removePartition(topicPartition TopicAndPartition) {
+	inLock(&this.partitionsLock, func() {
+		if partition, exists := this.partitions[topicPartition]; exists {
+			delete(this.partitions, topicPartition)
+			for _, name := range partition.names {
+				this.registry.Unregister(name)
+			}
+			this.updateTotalLags()
+		}
+	})
+}
+
+// updateLag updates the lag of a given topic partition. Partitions that are not tracked, e.g. because they have just been revoked, are ignored.
+func (this *ConsumerMetrics) updateLag(topicPartition TopicAndPartition, update func(*partitionMetrics)) {
+	inLock(&this.partitionsLock, func() {
+		partition, exists := this.partitions[topicPartition]
+		if !exists {
+			return
+		}
+
+		update(partition)
+		partition.lag.CommittedLag = lagBehind(partition.lag.HighwaterMarkOffset, partition.lag.CommittedOffset)
+		partition.lag.ProcessedLag = lagBehind(partition.lag.HighwaterMarkOffset, partition.lag.ProcessedOffset)
+		partition.committedLagGauge.Update(partition.lag.CommittedLag)
+		partition.processedLagGauge.Update(partition.lag.ProcessedLag)
+		this.updateTotalLags()
+	})
+}
+
+// getOrRegisterPartition must be called with the partitions lock held.
+func (this *ConsumerMetrics) getOrRegisterPartition(topicPartition TopicAndPartition) *partitionMetrics {
+	if partition, exists := this.partitions[topicPartition]; exists {
+		return partition
+	}
+
+	partition := &partitionMetrics{
+		lag: PartitionLag{
+			HighwaterMarkOffset: InvalidOffset,
+			CommittedOffset:     InvalidOffset,
+			ProcessedOffset:     InvalidOffset,
+		},
+		failedDecisionCounters: make(map[FailedDecision]metrics.Counter),
+		lastCommitAgeGauge:     &commitAgeGauge{},
+	}
+	register := func(name string, metric interface{}) {
+		name = this.partitionMetricName(name, topicPartition)
+		this.registry.Register(name, metric)
+		partition.names = append(partition.names, name)
+	}
+
+	partition.committedLagGauge = metrics.NewGauge()
+	register("ConsumerLag", partition.committedLagGauge)
+	partition.processedLagGauge = metrics.NewGauge()
+	register("ProcessingLag", partition.processedLagGauge)
+	partition.messagesMeter = metrics.NewMeter()
+	register("Messages", partition.messagesMeter)
+	partition.bytesMeter = metrics.NewMeter()
+	register("Bytes", partition.bytesMeter)
+	partition.taskDurationTimer = newBucketedTimer()
+	register("TaskDuration", partition.taskDurationTimer)
+	partition.taskRetriesCounter = metrics.NewCounter()
+	register("TaskRetries", partition.taskRetriesCounter)
+	for _, decision := range []FailedDecision{CommitOffsetAndContinue, DoNotCommitOffsetAndContinue, CommitOffsetAndStop, DoNotCommitOffsetAndStop} {
+		partition.failedDecisionCounters[decision] = metrics.NewCounter()
+		register(fmt.Sprintf("FailedDecision%s", decision), partition.failedDecisionCounters[decision])
+	}
+	register("LastCommitAge", partition.lastCommitAgeGauge)
+	partition.workersGauge = metrics.NewGauge()
+	register("Workers", partition.workersGauge)
+	partition.circuitStateGauge = metrics.NewGauge()
+	register("CircuitState", partition.circuitStateGauge)
+	partition.circuitOpensCounter = metrics.NewCounter()
+	register("CircuitOpens", partition.circuitOpensCounter)
+
+	this.partitions[topicPartition] = partition
+	return partition
+}
+
+// updateTotalLags sums the lags of all tracked partitions. Must be called with the partitions lock held.
+func (this *ConsumerMetrics) updateTotalLags() {
+	var committed, processed int64
+	for _, partition := range this.partitions {
+		committed += partition.lag.CommittedLag
+		processed += partition.lag.ProcessedLag
+	}
+	this.totalCommittedLagGauge.Update(committed)
+	this.totalProcessedLagGauge.Update(processed)
+}
+
+func (this *ConsumerMetrics) partitionMetricName(name string, topicPartition TopicAndPartition) string {
+	return fmt.Sprintf("%s%s-%s-%s-%d", this.prefix, name, this.consumerName, topicPartition.Topic, topicPartition.Partition)
+}
+
+// lagBehind returns the number of messages after a given offset up to a given high watermark, which is the offset of the next message to be written.
+// Returns 0 if either offset is unknown.
+func lagBehind(highwaterMarkOffset int64, offset int64) int64 {
+	if offset == BeforeFirstOffset && !isOffsetInvalid(highwaterMarkOffset) {
+		// nothing has been processed yet
+		return highwaterMarkOffset
+	}
+	if isOffsetInvalid(highwaterMarkOffset) || isOffsetInvalid(offset) || highwaterMarkOffset <= offset {
+		return 0
+	}
+	return highwaterMarkOffset - offset - 1
+}
+
+// Returns the values of all metrics of this consumer by metric name. Metrics of other consumers sharing the registry are not included.
 func (this *ConsumerMetrics) Stats() map[string]map[string]float64 {
 	metricsMap := make(map[string]map[string]float64)
-	this.registry.Each(func(name string, metric interface{}) {
+	this.eachMetric(func(name string, metric interface{}) {
 		metricsMap[name] = make(map[string]float64)
 		switch entry := metric.(type) {
 		case metrics.Counter:
@@ -146,10 +451,138 @@ func (this *ConsumerMetrics) Stats() map[string]map[string]float64 {
 	return metricsMap
 }
 
+// Writes the metrics of this consumer's registry as JSON to a given writer every reportingInterval. Blocks forever.
+// If the registry is shared, metrics of all consumers registered in it are written.
 func (this *ConsumerMetrics) WriteJSON(reportingInterval time.Duration, writer io.Writer) {
 	metrics.WriteJSON(this.registry, reportingInterval, writer)
 }
 
+// eachMetric calls a given function with every metric registered by this consumer, including partition metrics.
+func (this *ConsumerMetrics) eachMetric(f func(string, interface{})) {
+	names := append([]string{}, this.names...)
+	inLock(&this.partitionsLock, func() {
+		for _, partition := range this.partitions {
+			names = append(names, partition.names...)
+		}
+	})
+	for _, name := range names {
+		if metric := this.registry.Get(name); metric != nil {
+			f(name, metric)
+		}
+	}
+}
+
+// close unregisters all metrics registered by this consumer, leaving metrics of other consumers sharing the registry intact.
 func (this *ConsumerMetrics) close() {
-	this.registry.UnregisterAll()
+	this.eachMetric(func(name string, _ interface{}) {
+		this.registry.Unregister(name)
+	})
+	inLock(&this.partitionsLock, func() {
+		this.partitions = make(map[TopicAndPartition]*partitionMetrics)
+	})
+}
+
+// Upper bounds of the histogram buckets every bucketedTimer counts durations in.
+var timerBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// bucketedTimer is a metrics.Timer that also counts every duration in fixed histogram buckets.
+// The timer itself only keeps a sample of durations, which is not enough to export exact histograms.
+type bucketedTimer struct {
+	metrics.Timer
+	sum        int64
+	counts     []uint64
+	lastUpdate int64
+}
+
+func newBucketedTimer() *bucketedTimer {
+	return &bucketedTimer{
+		Timer:  metrics.NewTimer(),
+		counts: make([]uint64, len(timerBuckets)+1),
+	}
+}
+
+func newRegisteredBucketedTimer(name string, registry metrics.Registry) *bucketedTimer {
+	timer := newBucketedTimer()
+	registry.Register(name, timer)
+	return timer
+}
+
+// Times the execution of a given function.
+func (this *bucketedTimer) Time(f func()) {
+	start := time.Now()
+	f()
+	this.UpdateSince(start)
+}
+
+// Records the duration since a given time.
+func (this *bucketedTimer) UpdateSince(start time.Time) {
+	this.Update(time.Since(start))
+}
+
+// Records a given duration.
+func (this *bucketedTimer) Update(duration time.Duration) {
+	this.Timer.Update(duration)
+	atomic.AddInt64(&this.sum, int64(duration))
+	bucket := sort.Search(len(timerBuckets), func(i int) bool { return duration <= timerBuckets[i] })
+	atomic.AddUint64(&this.counts[bucket], 1)
+	atomic.StoreInt64(&this.lastUpdate, time.Now().UnixNano())
+}
+
+// lastUpdated returns the time a duration was last recorded, or the zero time if none has been recorded yet.
+func (this *bucketedTimer) lastUpdated() time.Time {
+	lastUpdate := atomic.LoadInt64(&this.lastUpdate)
+	if lastUpdate == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, lastUpdate)
+}
+
+// buckets returns the number of recorded durations, their sum and the cumulative number of durations in each bucket keyed by its upper bound in seconds.
+func (this *bucketedTimer) buckets() (uint64, time.Duration, map[float64]uint64) {
+	var count uint64
+	buckets := make(map[float64]uint64)
+	for i := range this.counts {
+		count += atomic.LoadUint64(&this.counts[i])
+		if i < len(timerBuckets) {
+			buckets[timerBuckets[i].Seconds()] = count
+		}
+	}
+	return count, time.Duration(atomic.LoadInt64(&this.sum)), buckets
+}
+
+// commitAgeGauge is a metrics.Gauge whose value is the number of milliseconds since the last commit, or 0 if nothing has been committed yet.
+type commitAgeGauge struct {
+	lastCommit int64
+}
+
+// Records a commit made now.
+func (this *commitAgeGauge) committed() {
+	atomic.StoreInt64(&this.lastCommit, time.Now().UnixNano())
+}
+
+// Gets the time since the last commit, or 0 if nothing has been committed yet.
+func (this *commitAgeGauge) age() time.Duration {
+	lastCommit := atomic.LoadInt64(&this.lastCommit)
+	if lastCommit == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, lastCommit))
+}
+
+// Returns a read-only copy of the gauge.
+func (this *commitAgeGauge) Snapshot() metrics.Gauge {
+	return metrics.GaugeSnapshot(this.Value())
+}
+
+// Panics, the value of a commitAgeGauge only changes with time and commits.
+func (this *commitAgeGauge) Update(int64) {
+	panic("Update called on a commitAgeGauge")
+}
+
+// Gets the number of milliseconds since the last commit.
+func (this *commitAgeGauge) Value() int64 {
+	return int64(this.age() / time.Millisecond)
 }
@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mistsys/go-avro"
 	avroline "github.com/mistsys/go_kafka_client/avro"
+	gometrics "github.com/rcrowley/go-metrics"
 )
 
 type CodahaleKafkaReporter struct {
@@ -51,7 +53,13 @@ func (c *CodahaleKafkaReporter) Write(bytes []byte) (n int, err error) {
 
 	c.producer.Input() <- &ProducerMessage{Topic: c.topic, Value: record}
 
-	return 0, nil
+	return len(bytes), nil
+}
+
+// Reports the metrics of a given registry every reportingInterval. Blocks forever.
+// Pass consumer.Metrics().Registry() to report the metrics of a single consumer.
+func (c *CodahaleKafkaReporter) Report(registry gometrics.Registry, reportingInterval time.Duration) {
+	gometrics.WriteJSON(registry, reportingInterval, c)
 }
 
 func (c *CodahaleKafkaReporter) parseSchema(metrics map[string]interface{}) (avro.Schema, map[string]string) {
@@ -0,0 +1,100 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// GroupOffsetLister lists consumer groups and all offsets they have committed. Implemented by ZookeeperCoordinator.
+type GroupOffsetLister interface {
+	// Gets the names of all consumer groups.
+	GetAllGroups() ([]string, error)
+
+	// Gets all offsets committed by a given consumer group.
+	GetGroupOffsets(group string) (map[TopicAndPartition]int64, error)
+}
+
+// MigrateOffsets copies offsets committed by the given groups from a GroupOffsetLister to an OffsetStorage.
+// All groups are copied if no groups are given. An offset is only copied if it is ahead of the offset already stored in the target,
+// so running a migration more than once or while consumers commit to the target is safe.
+// Every offset along with the taken action is written to a given writer. If dryRun is true nothing is written to the target.
+// Returns the number of copied offsets.
+func MigrateOffsets(source GroupOffsetLister, target OffsetStorage, groups []string, dryRun bool, out io.Writer) (int, error) {
+	if len(groups) == 0 {
+		var err error
+		groups, err = source.GetAllGroups()
+		if err != nil {
+			return 0, err
+		}
+	}
+	sort.Strings(groups)
+
+	copied := 0
+	for _, group := range groups {
+		sourceOffsets, err := source.GetGroupOffsets(group)
+		if err != nil {
+			return copied, fmt.Errorf("Failed to get offsets for group %s: %s", group, err)
+		}
+
+		topicPartitions := make([]*TopicAndPartition, 0, len(sourceOffsets))
+		for topicPartition := range sourceOffsets {
+			topicPartitions = append(topicPartitions, &TopicAndPartition{topicPartition.Topic, topicPartition.Partition})
+		}
+		sort.Sort(byTopicAndPartition(topicPartitions))
+
+		targetOffsets, err := getOffsets(target, group, topicPartitions)
+		if err != nil {
+			return copied, fmt.Errorf("Failed to get target offsets for group %s: %s", group, err)
+		}
+
+		toCommit := make(map[TopicAndPartition]OffsetAndMetadata)
+		for _, topicPartition := range topicPartitions {
+			sourceOffset := sourceOffsets[*topicPartition]
+			targetOffset := targetOffsets[*topicPartition].Offset
+			action := "skip"
+			if isOffsetAfter(sourceOffset, targetOffset) {
+				action = "copy"
+				toCommit[*topicPartition] = OffsetAndMetadata{Offset: sourceOffset}
+			}
+			fmt.Fprintf(out, "%s\t%s\t%d\t%d\t%d\t%s\n", group, topicPartition.Topic, topicPartition.Partition, sourceOffset, targetOffset, action)
+		}
+
+		if dryRun || len(toCommit) == 0 {
+			copied += len(toCommit)
+			continue
+		}
+		if err := commitOffsets(target, group, toCommit); err != nil {
+			return copied, fmt.Errorf("Failed to commit offsets for group %s: %s", group, err)
+		}
+		copied += len(toCommit)
+	}
+
+	return copied, nil
+}
+
+type byTopicAndPartition []*TopicAndPartition
+
+func (a byTopicAndPartition) Len() int      { return len(a) }
+func (a byTopicAndPartition) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byTopicAndPartition) Less(i, j int) bool {
+	if a[i].Topic != a[j].Topic {
+		return a[i].Topic < a[j].Topic
+	}
+	return a[i].Partition < a[j].Partition
+}
@@ -0,0 +1,77 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	kafka "github.com/mistsys/go_kafka_client"
+)
+
+var zkConnect = flag.String("zookeeper", "", "Zookeeper connection string host:port[,host:port...].")
+var zkRoot = flag.String("zookeeper.root", "", "Kafka root path in Zookeeper.")
+var groups = flag.String("groups", "", "Comma separated list of consumer groups to migrate. All groups are migrated if empty.")
+var kafkaVersion = flag.String("kafka.version", kafka.DefaultKafkaVersion, "Kafka protocol version, or 'auto' to negotiate it with brokers.")
+var dryRun = flag.Bool("dry.run", false, "Only print the offsets that would be copied.")
+
+func main() {
+	flag.Parse()
+	if *zkConnect == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	zkConfig := kafka.NewZookeeperConfig()
+	zkConfig.ZookeeperConnect = strings.Split(*zkConnect, ",")
+	zkConfig.Root = *zkRoot
+	zk := kafka.NewZookeeperCoordinator(zkConfig)
+	if err := zk.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to Zookeeper: %s\n", err)
+		os.Exit(1)
+	}
+	defer zk.Disconnect()
+
+	config := kafka.DefaultConsumerConfig()
+	config.Coordinator = zk
+	config.KafkaVersion = *kafkaVersion
+	client := kafka.NewSaramaClient(config)
+	if err := client.Initialize(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to Kafka: %s\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var groupList []string
+	if *groups != "" {
+		groupList = strings.Split(*groups, ",")
+	}
+
+	fmt.Println("group\ttopic\tpartition\tzookeeper\tkafka\taction")
+	copied, err := kafka.MigrateOffsets(zk, client, groupList, *dryRun, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migration failed after copying %d offsets: %s\n", copied, err)
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		fmt.Printf("Dry run: %d offsets would be copied\n", copied)
+	} else {
+		fmt.Printf("Copied %d offsets\n", copied)
+	}
+}
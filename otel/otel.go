@@ -0,0 +1,122 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+// Package otel adapts OpenTelemetry tracing to the go_kafka_client Tracer interface.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	kafka "github.com/mistsys/go_kafka_client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer is a go_kafka_client Tracer creating OpenTelemetry spans and extracting trace context from message headers with an OpenTelemetry propagator.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// Creates a new Tracer starting spans with a given OpenTelemetry tracer and extracting trace context with a given propagator,
+// e.g. propagation.TraceContext{}. Trace context is not extracted if the propagator is nil.
+func NewTracer(tracer trace.Tracer, propagator propagation.TextMapPropagator) *Tracer {
+	return &Tracer{
+		tracer:     tracer,
+		propagator: propagator,
+	}
+}
+
+// Starts a new consumer span with a given name as a child of the span in a given context, if any.
+func (this *Tracer) StartSpan(ctx context.Context, name string, attributes ...kafka.SpanAttribute) (context.Context, kafka.Span) {
+	ctx, span := this.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(convertAttributes(attributes)...))
+	return ctx, &Span{span}
+}
+
+// Returns a copy of a given context holding the trace context propagated in given message headers.
+func (this *Tracer) Extract(ctx context.Context, headers []*kafka.MessageHeader) context.Context {
+	if this.propagator == nil || len(headers) == 0 {
+		return ctx
+	}
+	return this.propagator.Extract(ctx, headerCarrier(headers))
+}
+
+// Span is a go_kafka_client Span wrapping an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+// Adds given attributes to this span.
+func (this *Span) SetAttributes(attributes ...kafka.SpanAttribute) {
+	this.span.SetAttributes(convertAttributes(attributes)...)
+}
+
+// Records a given error and sets the status of this span to error.
+func (this *Span) RecordError(err error) {
+	this.span.RecordError(err)
+	this.span.SetStatus(codes.Error, err.Error())
+}
+
+// Ends this span.
+func (this *Span) End() {
+	this.span.End()
+}
+
+func convertAttributes(attributes []kafka.SpanAttribute) []attribute.KeyValue {
+	converted := make([]attribute.KeyValue, 0, len(attributes))
+	for _, attr := range attributes {
+		switch value := attr.Value.(type) {
+		case string:
+			converted = append(converted, attribute.String(attr.Key, value))
+		case int:
+			converted = append(converted, attribute.Int(attr.Key, value))
+		case int32:
+			converted = append(converted, attribute.Int64(attr.Key, int64(value)))
+		case int64:
+			converted = append(converted, attribute.Int64(attr.Key, value))
+		case bool:
+			converted = append(converted, attribute.Bool(attr.Key, value))
+		default:
+			converted = append(converted, attribute.String(attr.Key, fmt.Sprint(value)))
+		}
+	}
+	return converted
+}
+
+// headerCarrier is a propagation.TextMapCarrier reading trace context from message headers.
+type headerCarrier []*kafka.MessageHeader
+
+func (this headerCarrier) Get(key string) string {
+	for _, header := range this {
+		if string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set is a no-op, consumed message headers are never modified.
+func (this headerCarrier) Set(key string, value string) {}
+
+func (this headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(this))
+	for _, header := range this {
+		keys = append(keys, string(header.Key))
+	}
+	return keys
+}
@@ -34,12 +34,22 @@ var topic1 = flag.String("topic1", "", "Topic to produce generated values to.")
 var topic2 = flag.String("topic2", "", "Topic to produce generated values to after getting an ack from topic1.")
 var avroSchema = flag.String("avsc", "../avro/timings.avsc", "Avro schema to use.")
 var perSecond = flag.Int("msg.per.sec", 0, "Messages per second to send.")
+var compressionCodecs = flag.String("compare.codecs", "", "Comma separated list of compression codecs to compare producer throughput for, e.g. none,gzip,snappy,lz4,zstd.")
+var compressionLevel = flag.Int("compression.level", kafka.DefaultCompressionLevel, "Compression level to use for codecs that support it.")
+var kafkaVersion = flag.String("kafka.version", kafka.DefaultKafkaVersion, "Kafka protocol version, or 'auto' to negotiate it with brokers.")
+var numMessages = flag.Int("num.messages", 100000, "Number of messages to produce for each codec when comparing codecs.")
+var messageSize = flag.Int("message.size", 1024, "Message size in bytes when comparing codecs.")
 
 var protobuf = true
 
 func main() {
 	parseAndValidateArgs()
 
+	if *compressionCodecs != "" {
+		compareCodecs()
+		return
+	}
+
 	if protobuf {
 		produceLogLineProtobuf()
 	} else {
@@ -143,6 +153,53 @@ func produceAvro() {
 	}
 }
 
+// compareCodecs produces the same set of messages once per codec and prints the achieved throughput.
+func compareCodecs() {
+	payload := make([]byte, *messageSize)
+	for i := range payload {
+		// Repeating text compresses similarly to real log lines, random bytes would not compress at all.
+		payload[i] = "the quick brown fox jumps over the lazy dog "[i%44]
+	}
+
+	fmt.Printf("%-8s %12s %12s %10s\n", "codec", "msg/sec", "MB/sec", "errors")
+	for _, codec := range strings.Split(*compressionCodecs, ",") {
+		codec = strings.TrimSpace(codec)
+		config := kafka.DefaultProducerConfig()
+		config.BrokerList = strings.Split(*brokerList, ",")
+		config.CompressionCodec = codec
+		config.CompressionLevel = *compressionLevel
+		config.KafkaVersion = *kafkaVersion
+		config.AckSuccesses = true
+		if err := config.Validate(); err != nil {
+			fmt.Printf("%-8s skipped: %s\n", codec, err)
+			continue
+		}
+		producer := kafka.NewSaramaProducer(config)
+
+		start := time.Now()
+		go func() {
+			for i := 0; i < *numMessages; i++ {
+				producer.Input() <- &kafka.ProducerMessage{Topic: *topic1, Value: payload}
+			}
+		}()
+
+		failed := 0
+		for acked := 0; acked < *numMessages; acked++ {
+			select {
+			case <-producer.Successes():
+			case <-producer.Errors():
+				failed++
+			}
+		}
+		elapsed := time.Since(start).Seconds()
+		producer.Close()
+
+		messagesPerSecond := float64(*numMessages) / elapsed
+		megabytesPerSecond := messagesPerSecond * float64(*messageSize) / (1024 * 1024)
+		fmt.Printf("%-8s %12.0f %12.2f %10d\n", codec, messagesPerSecond, megabytesPerSecond, failed)
+	}
+}
+
 func parseAndValidateArgs() {
 	flag.Parse()
 	if *brokerList == "" {
@@ -150,6 +207,18 @@ func parseAndValidateArgs() {
 		os.Exit(1)
 	}
 
+	if *compressionCodecs != "" {
+		if *topic1 == "" {
+			fmt.Println("Topic 1 is required")
+			os.Exit(1)
+		}
+		if *numMessages <= 0 || *messageSize <= 0 {
+			fmt.Println("Number of messages and message size should be greater than 0")
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *schemaRegistry != "" {
 		protobuf = false
 		if *avroSchema == "" {
@@ -21,12 +21,23 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	hashing "hash"
 	"hash/fnv"
 	"math/rand"
+	"strings"
 	"time"
 )
 
+const (
+	// DefaultCompressionLevel tells the producer to use the default level of the configured compression codec.
+	// A CompressionLevel of 0 does the same, so ProducerConfigs without a level keep the codec default.
+	DefaultCompressionLevel = -1000
+)
+
+// Compression codecs supported by producers.
+var compressionCodecs = []string{"none", "gzip", "snappy", "lz4", "zstd"}
+
 type Producer interface {
 	Errors() <-chan *FailedMessage
 	Successes() <-chan *ProducerMessage
@@ -43,6 +54,10 @@ type ProducerMessage struct {
 	Value        interface{}
 	KeyEncoder   Encoder
 	ValueEncoder Encoder
+	// Message timestamp. Requires Kafka 0.10.0 or newer, ignored otherwise.
+	Timestamp time.Time
+	// Message headers. Requires Kafka 0.11.0 or newer.
+	Headers []*MessageHeader
 
 	offset    int64
 	partition int32
@@ -56,10 +71,13 @@ type Partitioner interface {
 type PartitionerConstructor func() Partitioner
 
 type ProducerConfig struct {
-	Clientid              string
-	BrokerList            []string
-	SendBufferSize        int
-	CompressionCodec      string
+	Clientid         string
+	BrokerList       []string
+	SendBufferSize   int
+	CompressionCodec string
+	// Compression level of gzip (1 to 9) or zstd (1 to 22). Other codecs, including lz4, only accept the default level.
+	// 0 and DefaultCompressionLevel both stand for the codec default, so gzip level 0 (no compression) cannot be requested.
+	CompressionLevel      int
 	FlushByteCount        int
 	FlushTimeout          time.Duration
 	BatchSize             int
@@ -72,6 +90,8 @@ type ProducerConfig struct {
 	KeyEncoder            Encoder
 	ValueEncoder          Encoder
 	AckSuccesses          bool
+	// Kafka protocol version, e.g. "0.10.2.0", or KafkaVersionAuto to negotiate it with brokers.
+	KafkaVersion string
 
 	//Retries            int //TODO ??
 }
@@ -93,6 +113,8 @@ func DefaultProducerConfig() *ProducerConfig {
 		AckSuccesses:          false,
 		SendBufferSize:        1,
 		CompressionCodec:      "none",
+		CompressionLevel:      DefaultCompressionLevel,
+		KafkaVersion:          DefaultKafkaVersion,
 	}
 }
 
@@ -102,6 +124,7 @@ func DefaultProducerConfig() *ProducerConfig {
 //  metadata.broker.list
 //  send.buffer.size
 //  compression.codec
+//  compression.level
 //  flush.byte.count
 //  flush.timeout
 //  batch.size
@@ -110,6 +133,7 @@ func DefaultProducerConfig() *ProducerConfig {
 //  acks
 //  retry.backoff
 //  timeout
+//  kafka.version
 // The configuration file entries should be constructed in key=value syntax. A # symbol at the beginning
 // of a line indicates a comment. Blank lines are ignored. The file should end with a newline character.
 func ProducerConfigFromFile(filename string) (*ProducerConfig, error) {
@@ -125,6 +149,9 @@ func ProducerConfigFromFile(filename string) (*ProducerConfig, error) {
 		return nil, err
 	}
 	setStringConfig(&config.CompressionCodec, p["compression.codec"])
+	if err := setIntConfig(&config.CompressionLevel, p["compression.level"]); err != nil {
+		return nil, err
+	}
 	if err := setIntConfig(&config.FlushByteCount, p["flush.byte.count"]); err != nil {
 		return nil, err
 	}
@@ -149,6 +176,7 @@ func ProducerConfigFromFile(filename string) (*ProducerConfig, error) {
 	if err := setDurationConfig(&config.Timeout, p["timeout"]); err != nil {
 		return nil, err
 	}
+	setStringConfig(&config.KafkaVersion, p["kafka.version"])
 
 	return config, nil
 }
@@ -162,6 +190,64 @@ func (this *ProducerConfig) Validate() error {
 		return errors.New("Producer partitioner cannot be empty")
 	}
 
+	if err := validateCompression(this.CompressionCodec, this.CompressionLevel); err != nil {
+		return err
+	}
+
+	if this.KafkaVersion != "" {
+		if err := ValidateKafkaVersion(this.KafkaVersion); err != nil {
+			return fmt.Errorf("Invalid KafkaVersion %q: %s", this.KafkaVersion, err)
+		}
+	}
+
+	// Negotiated versions are only known once connected, NewSaramaProducer checks the codec against them.
+	if this.KafkaVersion != KafkaVersionAuto {
+		version, err := ResolveKafkaVersion(this.KafkaVersion, this.BrokerList, this.Clientid)
+		if err != nil {
+			return err
+		}
+		if _, err := saramaCompressionCodec(this.CompressionCodec, version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateCompression checks a compression codec and level. An empty codec means no compression and level 0 the default level of the codec.
+func validateCompression(codec string, level int) error {
+	codec = strings.ToLower(codec)
+	if codec == "" {
+		codec = "none"
+	}
+	known := false
+	for _, compressionCodec := range compressionCodecs {
+		if codec == compressionCodec {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return fmt.Errorf("Unknown compression codec %q, should be one of %s", codec, strings.Join(compressionCodecs, ", "))
+	}
+
+	if level == DefaultCompressionLevel || level == 0 {
+		return nil
+	}
+
+	switch codec {
+	case "gzip":
+		if level < 1 || level > 9 {
+			return fmt.Errorf("Compression level for gzip should be between 1 and 9, got %d", level)
+		}
+	case "zstd":
+		if level < 1 || level > 22 {
+			return fmt.Errorf("Compression level for zstd should be between 1 and 22, got %d", level)
+		}
+	default:
+		return fmt.Errorf("Compression codec %s does not support compression levels", codec)
+	}
+
 	return nil
 }
 
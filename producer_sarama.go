@@ -18,6 +18,7 @@
 package go_kafka_client
 
 import (
+	"fmt"
 	"github.com/Shopify/sarama"
 	"strings"
 )
@@ -28,6 +29,7 @@ type SaramaProducer struct {
 	successes      chan *ProducerMessage
 	errors         chan *FailedMessage
 	config         *ProducerConfig
+	version        sarama.KafkaVersion
 }
 
 func NewSaramaProducer(conf *ProducerConfig) Producer {
@@ -35,17 +37,20 @@ func NewSaramaProducer(conf *ProducerConfig) Producer {
 		panic(err)
 	}
 
+	version, err := ResolveKafkaVersion(conf.KafkaVersion, conf.BrokerList, conf.Clientid)
+	if err != nil {
+		panic(err)
+	}
+
 	config := sarama.NewConfig()
+	config.Version = version
 	config.ClientID = conf.Clientid
 	config.ChannelBufferSize = conf.SendBufferSize
-	switch strings.ToLower(conf.CompressionCodec) {
-	case "none":
-		config.Producer.Compression = sarama.CompressionNone
-	case "gzip":
-		config.Producer.Compression = sarama.CompressionGZIP
-	case "snappy":
-		config.Producer.Compression = sarama.CompressionSnappy
+	config.Producer.Compression, err = saramaCompressionCodec(conf.CompressionCodec, version)
+	if err != nil {
+		panic(err)
 	}
+	config.Producer.CompressionLevel = saramaCompressionLevel(conf.CompressionLevel)
 	config.Producer.Flush.Bytes = conf.MaxMessageBytes
 	config.Producer.Flush.Frequency = conf.FlushTimeout
 	config.Producer.Flush.Messages = conf.BatchSize
@@ -69,6 +74,7 @@ func NewSaramaProducer(conf *ProducerConfig) Producer {
 	saramaProducer := &SaramaProducer{
 		saramaProducer: producer,
 		config:         conf,
+		version:        version,
 	}
 	saramaProducer.initSuccesses()
 	saramaProducer.initErrors()
@@ -97,6 +103,8 @@ func (this *SaramaProducer) initErrors() {
 				Topic:     saramaError.Msg.Topic,
 				Key:       key,
 				Value:     value,
+				Timestamp: saramaError.Msg.Timestamp,
+				Headers:   fromSaramaHeaders(saramaError.Msg.Headers),
 				partition: saramaError.Msg.Partition,
 				offset:    saramaError.Msg.Offset,
 			}
@@ -125,6 +133,8 @@ func (this *SaramaProducer) initSuccesses() {
 				Topic:     saramaMessage.Topic,
 				Key:       key,
 				Value:     value,
+				Timestamp: saramaMessage.Timestamp,
+				Headers:   fromSaramaHeaders(saramaMessage.Headers),
 				partition: saramaMessage.Partition,
 				offset:    saramaMessage.Offset,
 			}
@@ -141,6 +151,13 @@ func (this *SaramaProducer) initInput() {
 	this.input = make(chan *ProducerMessage, this.config.SendBufferSize)
 	go func() {
 		for message := range this.input {
+			if len(message.Headers) > 0 {
+				if err := CheckKafkaFeature(this.version, HeadersFeature); err != nil {
+					this.errors <- &FailedMessage{message, err}
+					continue
+				}
+			}
+
 			encodedKey, err := this.getKeyEncoder(message).Encode(message.Key)
 			if err != nil {
 				panic(err)
@@ -153,9 +170,11 @@ func (this *SaramaProducer) initInput() {
 			}
 			value := sarama.ByteEncoder(encodedValue)
 			saramaMessage := &sarama.ProducerMessage{
-				Topic: message.Topic,
-				Key:   key,
-				Value: value,
+				Topic:     message.Topic,
+				Key:       key,
+				Value:     value,
+				Timestamp: message.Timestamp,
+				Headers:   toSaramaHeaders(message.Headers),
 			}
 			this.saramaProducer.Input() <- saramaMessage
 		}
@@ -186,6 +205,55 @@ func (this *SaramaProducer) getValueEncoder(message *ProducerMessage) Encoder {
 	}
 }
 
+// saramaCompressionCodec maps a compression codec name to a sarama codec and checks whether the given Kafka version supports it.
+func saramaCompressionCodec(codec string, version sarama.KafkaVersion) (sarama.CompressionCodec, error) {
+	switch strings.ToLower(codec) {
+	case "", "none":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, CheckKafkaFeature(version, LZ4Feature)
+	case "zstd":
+		return sarama.CompressionZSTD, CheckKafkaFeature(version, ZstdFeature)
+	}
+
+	return sarama.CompressionNone, fmt.Errorf("Unknown compression codec %q", codec)
+}
+
+func saramaCompressionLevel(level int) int {
+	if level == DefaultCompressionLevel || level == 0 {
+		return sarama.CompressionLevelDefault
+	}
+	return level
+}
+
+func toSaramaHeaders(headers []*MessageHeader) []sarama.RecordHeader {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	saramaHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for _, header := range headers {
+		saramaHeaders = append(saramaHeaders, sarama.RecordHeader{Key: header.Key, Value: header.Value})
+	}
+	return saramaHeaders
+}
+
+func fromSaramaHeaders(saramaHeaders []sarama.RecordHeader) []*MessageHeader {
+	if len(saramaHeaders) == 0 {
+		return nil
+	}
+
+	headers := make([]*MessageHeader, 0, len(saramaHeaders))
+	for _, header := range saramaHeaders {
+		headers = append(headers, &MessageHeader{Key: header.Key, Value: header.Value})
+	}
+	return headers
+}
+
 type SaramaPartitionerFactory struct {
 	partitioner PartitionerConstructor
 }
@@ -0,0 +1,85 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestProducerConfigCompressionValidation(t *testing.T) {
+	config := DefaultProducerConfig()
+	config.BrokerList = []string{localBroker}
+	config.KafkaVersion = "2.1.0.0"
+	assert(t, config.Validate(), nil)
+
+	for _, codec := range []string{"none", "gzip", "snappy", "lz4", "zstd", "GZIP"} {
+		config.CompressionCodec = codec
+		assert(t, config.Validate(), nil)
+	}
+
+	config.CompressionCodec = "brotli"
+	assertNot(t, config.Validate(), nil)
+
+	config.CompressionCodec = "gzip"
+	config.CompressionLevel = 9
+	assert(t, config.Validate(), nil)
+	config.CompressionLevel = 10
+	assertNot(t, config.Validate(), nil)
+
+	config.CompressionCodec = "zstd"
+	config.CompressionLevel = 3
+	assert(t, config.Validate(), nil)
+	config.CompressionLevel = 23
+	assertNot(t, config.Validate(), nil)
+	config.CompressionLevel = 0
+	assert(t, config.Validate(), nil)
+
+	config.CompressionCodec = "snappy"
+	config.CompressionLevel = 1
+	assertNot(t, config.Validate(), nil)
+	config.CompressionCodec = "lz4"
+	assertNot(t, config.Validate(), nil)
+	config.CompressionLevel = DefaultCompressionLevel
+	assert(t, config.Validate(), nil)
+
+	config.CompressionCodec = "zstd"
+	config.KafkaVersion = "2.0.0.0"
+	assertNot(t, config.Validate(), nil)
+
+	// zero values of a ProducerConfig literal mean no compression at the default level
+	assert(t, validateCompression("", 0), nil)
+	assert(t, saramaCompressionLevel(0), sarama.CompressionLevelDefault)
+}
+
+func TestSaramaCompressionCodec(t *testing.T) {
+	codec, err := saramaCompressionCodec("lz4", sarama.V0_10_0_0)
+	assert(t, err, nil)
+	assert(t, codec, sarama.CompressionLZ4)
+
+	_, err = saramaCompressionCodec("lz4", sarama.V0_9_0_0)
+	assertNot(t, err, nil)
+
+	codec, err = saramaCompressionCodec("zstd", sarama.V2_1_0_0)
+	assert(t, err, nil)
+	assert(t, codec, sarama.CompressionZSTD)
+
+	_, err = saramaCompressionCodec("zstd", sarama.V1_1_0_0)
+	if _, ok := err.(*UnsupportedFeatureError); !ok {
+		t.Errorf("Expected UnsupportedFeatureError, actual %v", err)
+	}
+}
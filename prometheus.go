@@ -0,0 +1,154 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const prometheusNamespace = "go_kafka_client"
+
+var (
+	consumerLabels  = []string{"consumer", "group"}
+	partitionLabels = []string{"consumer", "group", "topic", "partition"}
+
+	fetchersIdleDesc         = newPrometheusDesc("fetchers_idle_seconds", "Time fetcher routines wait for partitions to fetch.", consumerLabels)
+	fetchDurationDesc        = newPrometheusDesc("fetch_duration_seconds", "Duration of fetch requests.", consumerLabels)
+	workerManagersDesc       = newPrometheusDesc("worker_managers", "Number of worker managers.", consumerLabels)
+	activeWorkersDesc        = newPrometheusDesc("active_workers", "Number of workers processing a message.", consumerLabels)
+	pendingTasksDesc         = newPrometheusDesc("pending_tasks", "Number of messages waiting for a worker.", consumerLabels)
+	taskTimeoutsDesc         = newPrometheusDesc("task_timeouts_total", "Number of worker tasks that timed out.", consumerLabels)
+	batchDurationDesc        = newPrometheusDesc("batch_duration_seconds", "Time worker managers take to process a batch.", consumerLabels)
+	workerManagersIdleDesc   = newPrometheusDesc("worker_managers_idle_seconds", "Time worker managers wait for a batch.", consumerLabels)
+	rateLimitWaitDesc        = newPrometheusDesc("rate_limit_wait_seconds", "Time worker managers wait for rate limiters before handing a message to a worker.", consumerLabels)
+	messageAgeWaitDesc       = newPrometheusDesc("message_age_wait_seconds", "Time worker managers hold batches until their messages reach MinMessageAge.", consumerLabels)
+	quarantinedRegionsDesc   = newPrometheusDesc("quarantined_regions_total", "Number of quarantined regions of corrupted data.", consumerLabels)
+	quarantinedOffsetsDesc   = newPrometheusDesc("quarantined_offsets_total", "Number of offsets skipped due to corrupted data.", consumerLabels)
+	consumerLagDesc          = newPrometheusDesc("consumer_lag", "Messages between the committed offset and the high watermark.", partitionLabels)
+	processingLagDesc        = newPrometheusDesc("processing_lag", "Messages between the processed offset and the high watermark.", partitionLabels)
+	highwaterMarkOffsetDesc  = newPrometheusDesc("highwater_mark_offset", "High watermark offset as of the last fetch response.", partitionLabels)
+	committedOffsetDesc      = newPrometheusDesc("committed_offset", "Last committed offset.", partitionLabels)
+	processedOffsetDesc      = newPrometheusDesc("processed_offset", "Largest processed offset.", partitionLabels)
+	messagesDesc             = newPrometheusDesc("messages_total", "Number of consumed messages.", partitionLabels)
+	bytesDesc                = newPrometheusDesc("bytes_total", "Number of consumed key and value bytes.", partitionLabels)
+	taskDurationDesc         = newPrometheusDesc("task_duration_seconds", "Time from handing a message to a worker until it is done, including retries.", partitionLabels)
+	taskRetriesDesc          = newPrometheusDesc("task_retries_total", "Number of worker task retries.", partitionLabels)
+	failedDecisionsDesc      = newPrometheusDesc("failed_decisions_total", "Number of decisions made for worker tasks that failed after all retries.", append(partitionLabels, "decision"))
+	lastCommitAgeDesc        = newPrometheusDesc("last_commit_age_seconds", "Time since the last offset commit, 0 if nothing has been committed yet.", partitionLabels)
+	workersDesc              = newPrometheusDesc("workers", "Size of the worker pool of the worker manager.", partitionLabels)
+	circuitStateDesc         = newPrometheusDesc("circuit_state", "State of the circuit breaker: 0 closed, 1 open, 2 half-open.", partitionLabels)
+	circuitOpensDesc         = newPrometheusDesc("circuit_opens_total", "Number of times the circuit breaker opened.", partitionLabels)
+	prometheusConsumerDescs  = []*prometheus.Desc{fetchersIdleDesc, fetchDurationDesc, workerManagersDesc, activeWorkersDesc, pendingTasksDesc, taskTimeoutsDesc, batchDurationDesc, workerManagersIdleDesc, rateLimitWaitDesc, messageAgeWaitDesc, quarantinedRegionsDesc, quarantinedOffsetsDesc}
+	prometheusPartitionDescs = []*prometheus.Desc{consumerLagDesc, processingLagDesc, highwaterMarkOffsetDesc, committedOffsetDesc, processedOffsetDesc, messagesDesc, bytesDesc, taskDurationDesc, taskRetriesDesc, failedDecisionsDesc, lastCommitAgeDesc, workersDesc, circuitStateDesc, circuitOpensDesc}
+)
+
+func newPrometheusDesc(name string, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(prometheusNamespace, "", name), help, labels, nil)
+}
+
+// PrometheusCollector implements prometheus.Collector and exports the ConsumerMetrics of consumers with the consumer id and group
+// as labels instead of embedding them into metric names. Partition metrics are labeled with topic and partition as well.
+// Timers are exported as histograms.
+type PrometheusCollector struct {
+	consumers []*Consumer
+}
+
+// Creates a new PrometheusCollector for given consumers. Register it in a prometheus.Registerer to export the consumers' metrics.
+// A single collector should be used for all consumers of a process, as collectors of the same metrics cannot be registered twice.
+func NewPrometheusCollector(consumers ...*Consumer) *PrometheusCollector {
+	return &PrometheusCollector{
+		consumers: consumers,
+	}
+}
+
+// Sends the descriptors of all exported metrics to a given channel.
+func (this *PrometheusCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range prometheusConsumerDescs {
+		descs <- desc
+	}
+	for _, desc := range prometheusPartitionDescs {
+		descs <- desc
+	}
+}
+
+// Sends the current values of all exported metrics to a given channel.
+func (this *PrometheusCollector) Collect(collected chan<- prometheus.Metric) {
+	for _, consumer := range this.consumers {
+		if metrics := consumer.Metrics(); metrics != nil {
+			collectConsumerMetrics(collected, metrics, consumer.config.Consumerid, consumer.config.Groupid)
+		}
+	}
+}
+
+func collectConsumerMetrics(collected chan<- prometheus.Metric, metrics *ConsumerMetrics, consumer string, group string) {
+	histogram := func(desc *prometheus.Desc, timer *bucketedTimer, labels ...string) {
+		count, sum, buckets := timer.buckets()
+		collected <- prometheus.MustNewConstHistogram(desc, count, sum.Seconds(), buckets, append([]string{consumer, group}, labels...)...)
+	}
+	value := func(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) {
+		collected <- prometheus.MustNewConstMetric(desc, valueType, value, append([]string{consumer, group}, labels...)...)
+	}
+
+	histogram(fetchersIdleDesc, metrics.fetchersIdleTimer)
+	histogram(fetchDurationDesc, metrics.fetchDurationTimer)
+	histogram(batchDurationDesc, metrics.wmsBatchDurationTimer)
+	histogram(workerManagersIdleDesc, metrics.wmsIdleTimer)
+	histogram(rateLimitWaitDesc, metrics.rateLimitWaitTimer)
+	histogram(messageAgeWaitDesc, metrics.messageAgeWaitTimer)
+	value(workerManagersDesc, prometheus.GaugeValue, float64(metrics.numWorkerManagersGauge.Value()))
+	value(activeWorkersDesc, prometheus.GaugeValue, float64(metrics.activeWorkersCounter.Count()))
+	value(pendingTasksDesc, prometheus.GaugeValue, float64(metrics.pendingWMsTasksCounter.Count()))
+	value(taskTimeoutsDesc, prometheus.CounterValue, float64(metrics.taskTimeoutCounter.Count()))
+	value(quarantinedRegionsDesc, prometheus.CounterValue, float64(metrics.quarantinedRegionsCounter.Count()))
+	value(quarantinedOffsetsDesc, prometheus.CounterValue, float64(metrics.quarantinedOffsetsCounter.Count()))
+
+	lags := metrics.Lags()
+	metrics.eachPartition(func(topicPartition TopicAndPartition, partitionMetrics *partitionMetrics) {
+		topic, partition := topicPartition.Topic, strconv.Itoa(int(topicPartition.Partition))
+		lag, exists := lags[topicPartition]
+		if !exists {
+			return
+		}
+		value(consumerLagDesc, prometheus.GaugeValue, float64(lag.CommittedLag), topic, partition)
+		value(processingLagDesc, prometheus.GaugeValue, float64(lag.ProcessedLag), topic, partition)
+		value(highwaterMarkOffsetDesc, prometheus.GaugeValue, float64(lag.HighwaterMarkOffset), topic, partition)
+		value(committedOffsetDesc, prometheus.GaugeValue, float64(lag.CommittedOffset), topic, partition)
+		value(processedOffsetDesc, prometheus.GaugeValue, float64(lag.ProcessedOffset), topic, partition)
+		value(messagesDesc, prometheus.CounterValue, float64(partitionMetrics.messagesMeter.Count()), topic, partition)
+		value(bytesDesc, prometheus.CounterValue, float64(partitionMetrics.bytesMeter.Count()), topic, partition)
+		histogram(taskDurationDesc, partitionMetrics.taskDurationTimer, topic, partition)
+		value(taskRetriesDesc, prometheus.CounterValue, float64(partitionMetrics.taskRetriesCounter.Count()), topic, partition)
+		for decision, counter := range partitionMetrics.failedDecisionCounters {
+			value(failedDecisionsDesc, prometheus.CounterValue, float64(counter.Count()), topic, partition, decision.String())
+		}
+		value(lastCommitAgeDesc, prometheus.GaugeValue, partitionMetrics.lastCommitAgeGauge.age().Seconds(), topic, partition)
+		value(workersDesc, prometheus.GaugeValue, float64(partitionMetrics.workersGauge.Value()), topic, partition)
+		value(circuitStateDesc, prometheus.GaugeValue, float64(partitionMetrics.circuitStateGauge.Value()), topic, partition)
+		value(circuitOpensDesc, prometheus.CounterValue, float64(partitionMetrics.circuitOpensCounter.Count()), topic, partition)
+	})
+}
+
+// Creates an http.Handler that serves the metrics of given consumers in the Prometheus exposition format.
+// The metrics are kept in a separate prometheus.Registry, so the handler does not depend on the global Prometheus registry.
+func NewPrometheusHandler(consumers ...*Consumer) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewPrometheusCollector(consumers...))
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,80 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+func TestBucketedTimer(t *testing.T) {
+	timer := newRegisteredBucketedTimer("test-bucketed-timer", metrics.NewRegistry())
+	timer.Update(3 * time.Millisecond)
+	timer.Update(5 * time.Millisecond)
+	timer.Update(200 * time.Millisecond)
+	timer.Update(time.Minute)
+
+	count, sum, buckets := timer.buckets()
+	assert(t, count, uint64(4))
+	assert(t, sum, time.Minute+208*time.Millisecond)
+	assert(t, buckets[0.005], uint64(2))
+	assert(t, buckets[0.1], uint64(2))
+	assert(t, buckets[0.25], uint64(3))
+	assert(t, buckets[10], uint64(3))
+	assert(t, timer.Count(), int64(4))
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	topics := map[string][]int32{"topic": []int32{0}}
+	config := inMemoryConsumerConfig(newStaticClient("topic", 0, 10), topics)
+	config.Consumerid = "prometheus-consumer"
+	config.Groupid = "prometheus-group"
+	consumer := NewConsumer(config)
+	defer consumer.Metrics().close()
+
+	consumer.Metrics().fetchDuration().Update(20 * time.Millisecond)
+	consumer.Metrics().taskTimeouts().Inc(2)
+	partition := consumer.Metrics().partition(TopicAndPartition{"topic", 0})
+	partition.consumed([]*Message{&Message{Value: []byte("value")}, &Message{Key: []byte("key"), Value: []byte("value")}})
+	partition.failedDecision(DoNotCommitOffsetAndContinue).Inc(1)
+	consumer.Metrics().updateHighwaterMark(TopicAndPartition{"topic", 0}, 10)
+	consumer.Metrics().updateCommittedOffset(TopicAndPartition{"topic", 0}, 3)
+
+	recorder := httptest.NewRecorder()
+	NewPrometheusHandler(consumer).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	for _, expected := range []string{
+		`go_kafka_client_fetch_duration_seconds_bucket{consumer="prometheus-consumer",group="prometheus-group",le="0.01"} 0`,
+		`go_kafka_client_fetch_duration_seconds_bucket{consumer="prometheus-consumer",group="prometheus-group",le="0.025"} 1`,
+		`go_kafka_client_fetch_duration_seconds_count{consumer="prometheus-consumer",group="prometheus-group"} 1`,
+		`go_kafka_client_task_timeouts_total{consumer="prometheus-consumer",group="prometheus-group"} 2`,
+		`go_kafka_client_consumer_lag{consumer="prometheus-consumer",group="prometheus-group",partition="0",topic="topic"} 6`,
+		`go_kafka_client_highwater_mark_offset{consumer="prometheus-consumer",group="prometheus-group",partition="0",topic="topic"} 10`,
+		`go_kafka_client_messages_total{consumer="prometheus-consumer",group="prometheus-group",partition="0",topic="topic"} 2`,
+		`go_kafka_client_bytes_total{consumer="prometheus-consumer",group="prometheus-group",partition="0",topic="topic"} 13`,
+		`go_kafka_client_failed_decisions_total{consumer="prometheus-consumer",decision="DoNotCommitOffsetAndContinue",group="prometheus-group",partition="0",topic="topic"} 1`,
+		`go_kafka_client_task_duration_seconds_count{consumer="prometheus-consumer",group="prometheus-group",partition="0",topic="topic"} 0`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %s in exposed metrics:\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CorruptedDataError is returned by LowLevelClient.Fetch when the data fetched from a given offset cannot be decoded.
+type CorruptedDataError struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+
+	// Raw bytes that failed to decode. Empty if the underlying client does not expose them.
+	Payload []byte
+
+	// Decoding error reported by the underlying client.
+	Cause error
+}
+
+func (this *CorruptedDataError) Error() string {
+	return fmt.Sprintf("Corrupted data in %s:%d at offset %d: %s", this.Topic, this.Partition, this.Offset, this.Cause)
+}
+
+// QuarantinedData describes a region of corrupted data that was skipped by a consumer.
+type QuarantinedData struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+
+	// First and last skipped offsets, inclusive.
+	StartOffset int64 `json:"startOffset"`
+	EndOffset   int64 `json:"endOffset"`
+
+	// Raw bytes of the skipped region concatenated in offset order. Empty if the LowLevelClient does not expose them.
+	Payload []byte `json:"payload,omitempty"`
+
+	// Decoding errors reported while skipping the region, one per skipped offset.
+	Reasons []string `json:"reasons"`
+
+	// Time when the region was closed, i.e. the first non-corrupted fetch happened.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func (this *QuarantinedData) String() string {
+	return fmt.Sprintf("%s:%d [%d-%d] (%d bytes)", this.Topic, this.Partition, this.StartOffset, this.EndOffset, len(this.Payload))
+}
+
+// QuarantineSink stores corrupted data skipped by a consumer so it can be inspected later.
+type QuarantineSink interface {
+	// Writes a skipped region of corrupted data. Returns an error if the region could not be stored.
+	Write(data *QuarantinedData) error
+}
+
+// FileQuarantineSink implements QuarantineSink and writes each region to a directory as two files:
+// <topic>-<partition>-<start>-<end>.bin with the raw payload and <topic>-<partition>-<start>-<end>.json with the region metadata.
+type FileQuarantineSink struct {
+	dir string
+}
+
+// Creates a new FileQuarantineSink writing to a given directory. The directory is created if it does not exist.
+func NewFileQuarantineSink(dir string) (*FileQuarantineSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileQuarantineSink{
+		dir: dir,
+	}, nil
+}
+
+func (this *FileQuarantineSink) String() string {
+	return fmt.Sprintf("File quarantine %s", this.dir)
+}
+
+// Writes the raw payload and the metadata of a given region to the quarantine directory.
+func (this *FileQuarantineSink) Write(data *QuarantinedData) error {
+	name := filepath.Join(this.dir, fmt.Sprintf("%s-%d-%d-%d", data.Topic, data.Partition, data.StartOffset, data.EndOffset))
+	if err := ioutil.WriteFile(name+".bin", data.Payload, 0644); err != nil {
+		return err
+	}
+
+	metadata := *data
+	metadata.Payload = nil
+	encoded, err := json.Marshal(&metadata)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name+".json", encoded, 0644)
+}
+
+// ProducerQuarantineSink implements QuarantineSink and produces each region to a Kafka topic.
+// The message key is the region metadata in JSON format and the value is the raw payload, both are sent as is regardless of the producer encoders.
+type ProducerQuarantineSink struct {
+	producer Producer
+	topic    string
+}
+
+// Creates a new ProducerQuarantineSink that uses a given Producer to write to a given topic.
+// Producer errors are reported via the Producer's Errors channel and should be handled by the caller.
+func NewProducerQuarantineSink(producer Producer, topic string) *ProducerQuarantineSink {
+	return &ProducerQuarantineSink{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+func (this *ProducerQuarantineSink) String() string {
+	return fmt.Sprintf("Kafka quarantine %s", this.topic)
+}
+
+// Sends a given region to the quarantine topic.
+func (this *ProducerQuarantineSink) Write(data *QuarantinedData) error {
+	metadata := *data
+	metadata.Payload = nil
+	key, err := json.Marshal(&metadata)
+	if err != nil {
+		return err
+	}
+
+	this.producer.Input() <- &ProducerMessage{
+		Topic:        this.topic,
+		Key:          key,
+		Value:        data.Payload,
+		KeyEncoder:   &ByteEncoder{},
+		ValueEncoder: &ByteEncoder{},
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// corruptingClient serves messages from a staticClient but fails to decode the given offsets.
+type corruptingClient struct {
+	*staticClient
+	corrupted map[int64]bool
+}
+
+func (this *corruptingClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	if this.corrupted[offset] {
+		return nil, &CorruptedDataError{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    offset,
+			Payload:   []byte(fmt.Sprintf("garbage-%d", offset)),
+			Cause:     errors.New("CRC didn't match"),
+		}
+	}
+
+	messages, err := this.staticClient.Fetch(topic, partition, offset)
+	for i, message := range messages {
+		if this.corrupted[message.Offset] {
+			return messages[:i], err
+		}
+	}
+	return messages, err
+}
+
+func TestFileQuarantineSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	assert(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	sink, err := NewFileQuarantineSink(dir)
+	assert(t, err, nil)
+	assert(t, sink.Write(&QuarantinedData{
+		Topic:       "test",
+		Partition:   1,
+		StartOffset: 10,
+		EndOffset:   12,
+		Payload:     []byte("garbage"),
+		Reasons:     []string{"CRC didn't match"},
+	}), nil)
+
+	payload, err := ioutil.ReadFile(filepath.Join(dir, "test-1-10-12.bin"))
+	assert(t, err, nil)
+	assert(t, string(payload), "garbage")
+
+	encoded, err := ioutil.ReadFile(filepath.Join(dir, "test-1-10-12.json"))
+	assert(t, err, nil)
+	metadata := &QuarantinedData{}
+	assert(t, json.Unmarshal(encoded, metadata), nil)
+	assert(t, metadata.StartOffset, int64(10))
+	assert(t, metadata.EndOffset, int64(12))
+	assert(t, len(metadata.Payload), 0)
+}
+
+func TestConsumerQuarantinesCorruptedData(t *testing.T) {
+	topic := "test-quarantine"
+	numMessages := 50
+	topics := map[string][]int32{topic: []int32{0}}
+	dir, err := ioutil.TempDir("", "quarantine")
+	assert(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	client := &corruptingClient{
+		staticClient: newStaticClient(topic, 0, numMessages),
+		corrupted:    map[int64]bool{10: true, 11: true, 12: true},
+	}
+	consumed := make(chan *Message, numMessages)
+	quarantined := make(chan *QuarantinedData, 1)
+
+	config := inMemoryConsumerConfig(client, topics)
+	config.QuarantineSink, err = NewFileQuarantineSink(dir)
+	assert(t, err, nil)
+	config.CorruptedDataCallback = func(data *QuarantinedData) {
+		quarantined <- data
+	}
+	config.Strategy = func(_ *Worker, message *Message, id TaskId) WorkerResult {
+		consumed <- message
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+
+	select {
+	case data := <-quarantined:
+		assert(t, data.StartOffset, int64(10))
+		assert(t, data.EndOffset, int64(12))
+		assert(t, string(data.Payload), "garbage-10garbage-11garbage-12")
+		assert(t, len(data.Reasons), 3)
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Corrupted data was not quarantined within %s", consumeTimeout)
+	}
+
+	offsets := make(map[int64]bool)
+	timeout := time.After(consumeTimeout)
+	for len(offsets) < numMessages-3 {
+		select {
+		case message := <-consumed:
+			offsets[message.Offset] = true
+		case <-timeout:
+			t.Fatalf("Failed to consume %d messages within %s. Actual messages = %d", numMessages-3, consumeTimeout, len(offsets))
+		}
+	}
+	assert(t, offsets[11], false)
+	assert(t, consumer.Metrics().quarantinedRegions().Count(), int64(1))
+	assert(t, consumer.Metrics().quarantinedOffsets().Count(), int64(3))
+
+	_, err = os.Stat(filepath.Join(dir, fmt.Sprintf("%s-0-10-12.bin", topic)))
+	assert(t, err, nil)
+
+	closeWithin(t, 10*time.Second, consumer)
+}
+
+func TestRemovingPartitionQuarantinesOpenRegion(t *testing.T) {
+	topicAndPartition := TopicAndPartition{"test-quarantine-remove", 0}
+	quarantined := make(chan *QuarantinedData, 1)
+	config := DefaultConsumerConfig()
+	config.CorruptedDataCallback = func(data *QuarantinedData) {
+		quarantined <- data
+	}
+	manager := newConsumerFetcherManager(config, make(chan TopicAndPartition), newConsumerMetrics("test", "", metrics.NewRegistry()))
+	fetcher := newConsumerFetcher(manager, "test-fetcher")
+	fetcher.partitionMap[topicAndPartition] = &partitionTopicInfo{Topic: topicAndPartition.Topic, Partition: topicAndPartition.Partition}
+
+	for offset := int64(5); offset <= 6; offset++ {
+		fetcher.skipCorruptedData(topicAndPartition, offset, &CorruptedDataError{
+			Topic:     topicAndPartition.Topic,
+			Partition: topicAndPartition.Partition,
+			Offset:    offset,
+			Payload:   []byte("batch"),
+			Cause:     errors.New("CRC didn't match"),
+		})
+	}
+
+	// the partition is revoked before readable data is fetched
+	fetcher.removePartitions([]TopicAndPartition{topicAndPartition})
+	select {
+	case data := <-quarantined:
+		assert(t, data.StartOffset, int64(5))
+		assert(t, data.EndOffset, int64(6))
+		assert(t, string(data.Payload), "batch")
+		assert(t, len(data.Reasons), 2)
+	case <-time.After(time.Second):
+		t.Fatal("Open region of corrupted data was not quarantined on partition removal")
+	}
+	<-manager.close()
+}
+
+func TestQuarantiningAfterManagerClosedDropsRegion(t *testing.T) {
+	quarantined := make(chan *QuarantinedData, 1)
+	config := DefaultConsumerConfig()
+	config.CorruptedDataCallback = func(data *QuarantinedData) {
+		quarantined <- data
+	}
+	manager := newConsumerFetcherManager(config, make(chan TopicAndPartition), newConsumerMetrics("test", "", metrics.NewRegistry()))
+	<-manager.close()
+
+	// a partition removed from a fetcher while the manager closes reports its open region late
+	manager.quarantine(&QuarantinedData{Topic: "test-quarantine-closed", Partition: 0, StartOffset: 5, EndOffset: 5})
+	select {
+	case data := <-quarantined:
+		t.Errorf("Region %s was quarantined after the manager was closed", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,158 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the number of messages and bytes per second dispatched to workers using two token buckets.
+// Each bucket holds at most one second worth of tokens, so bursts never exceed the limits.
+// A single RateLimiter may be shared by any number of consumers and topics to limit them together, and its limits may be changed at any time.
+type RateLimiter struct {
+	lock     sync.Mutex
+	messages *tokenBucket
+	bytes    *tokenBucket
+	changed  chan struct{}
+}
+
+// Creates a new RateLimiter allowing given numbers of messages and bytes per second. A limit of 0 or less disables it.
+func NewRateLimiter(messagesPerSecond float64, bytesPerSecond float64) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{
+		messages: newTokenBucket(messagesPerSecond, now),
+		bytes:    newTokenBucket(bytesPerSecond, now),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Changes the numbers of messages and bytes per second allowed by this RateLimiter. A limit of 0 or less disables it.
+// Goroutines waiting on this RateLimiter pick up new limits immediately.
+func (this *RateLimiter) SetLimits(messagesPerSecond float64, bytesPerSecond float64) {
+	inLock(&this.lock, func() {
+		now := time.Now()
+		this.messages.setRate(messagesPerSecond, now)
+		this.bytes.setRate(bytesPerSecond, now)
+		close(this.changed)
+		this.changed = make(chan struct{})
+	})
+}
+
+// Returns the numbers of messages and bytes per second allowed by this RateLimiter.
+func (this *RateLimiter) Limits() (messagesPerSecond float64, bytesPerSecond float64) {
+	inLock(&this.lock, func() {
+		messagesPerSecond = this.messages.rate
+		bytesPerSecond = this.bytes.rate
+	})
+	return
+}
+
+// Waits until a single message of a given size may be dispatched or a given stop channel is closed.
+// Returns false if waiting was stopped.
+func (this *RateLimiter) Wait(size int, stop <-chan struct{}) bool {
+	for {
+		var wait time.Duration
+		var changed chan struct{}
+		inLock(&this.lock, func() {
+			now := time.Now()
+			wait = maxDuration(this.messages.wait(1, now), this.bytes.wait(float64(size), now))
+			if wait == 0 {
+				this.messages.take(1)
+				this.bytes.take(float64(size))
+			}
+			changed = this.changed
+		})
+		if wait == 0 {
+			return true
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+func (this *RateLimiter) String() string {
+	messagesPerSecond, bytesPerSecond := this.Limits()
+	return fmt.Sprintf("RateLimiter{messages/s: %v, bytes/s: %v}", messagesPerSecond, bytesPerSecond)
+}
+
+// tokenBucket is a token bucket refilled with a given rate of tokens per second and holding at most one second worth of tokens.
+// It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: now}
+}
+
+func (this *tokenBucket) refill(now time.Time) {
+	if this.rate > 0 {
+		this.tokens += now.Sub(this.last).Seconds() * this.rate
+		if this.tokens > this.rate {
+			this.tokens = this.rate
+		}
+	}
+	this.last = now
+}
+
+func (this *tokenBucket) setRate(rate float64, now time.Time) {
+	this.refill(now)
+	if this.rate <= 0 || this.tokens > rate {
+		this.tokens = rate
+	}
+	this.rate = rate
+}
+
+// wait returns how long to wait until n tokens may be taken. Requests larger than the bucket may be taken once the bucket is full,
+// leaving the bucket in debt so that they are still accounted for.
+func (this *tokenBucket) wait(n float64, now time.Time) time.Duration {
+	if this.rate <= 0 {
+		return 0
+	}
+	this.refill(now)
+	if n > this.rate {
+		n = this.rate
+	}
+	if this.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - this.tokens) / this.rate * float64(time.Second))
+}
+
+func (this *tokenBucket) take(n float64) {
+	if this.rate > 0 {
+		this.tokens -= n
+	}
+}
+
+func maxDuration(first time.Duration, second time.Duration) time.Duration {
+	if first > second {
+		return first
+	}
+	return second
+}
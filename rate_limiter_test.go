@@ -0,0 +1,94 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(10, 0)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		assert(t, limiter.Wait(100, nil), true)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("A full bucket should allow a burst of 10 messages, took %s", elapsed)
+	}
+	limiter.Wait(100, nil)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected the 11th message to wait for a token, took %s", elapsed)
+	}
+
+	// lifting limits releases waiting goroutines immediately
+	limiter.SetLimits(0.01, 0)
+	released := make(chan bool)
+	go func() {
+		limiter.Wait(100, nil)
+		released <- true
+	}()
+	time.Sleep(50 * time.Millisecond)
+	limiter.SetLimits(0, 0)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("Waiting goroutine was not released after lifting limits")
+	}
+
+	// messages larger than the bytes bucket pass once the bucket is full and leave it in debt
+	limiter = NewRateLimiter(0, 1000)
+	assert(t, limiter.Wait(2000, nil), true)
+	stop := make(chan struct{})
+	close(stop)
+	assert(t, limiter.Wait(1, stop), false)
+	messagesPerSecond, bytesPerSecond := limiter.Limits()
+	assert(t, messagesPerSecond, float64(0))
+	assert(t, bytesPerSecond, float64(1000))
+}
+
+func TestConsumerRateLimiting(t *testing.T) {
+	topic := "test-rate-limiting"
+	topics := map[string][]int32{topic: []int32{0}}
+	var consumed int32
+
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 30), topics)
+	config.FetchBatchSize = 30
+	config.RateLimiter = NewRateLimiter(0, 0)
+	config.TopicRateLimiters = map[string]*RateLimiter{topic: NewRateLimiter(20, 0)}
+	config.Strategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult {
+		atomic.AddInt32(&consumed, 1)
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	start := time.Now()
+	go consumer.StartStaticPartitions(topics)
+
+	timeout := time.After(consumeTimeout)
+	for atomic.LoadInt32(&consumed) < 30 {
+		select {
+		case <-timeout:
+			t.Fatalf("Failed to consume all messages within %s", consumeTimeout)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Expected 30 messages at 20 messages/s with a burst of 20 to take at least 500ms, took %s", elapsed)
+	}
+	closeWithin(t, 10*time.Second, consumer)
+}
@@ -0,0 +1,187 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	rawFetchApiKey        int16 = 1
+	rawFetchCorrelationId int32 = 1
+	rawFetchMaxResponse   int32 = 100 * 1024 * 1024
+)
+
+// fetchRawRecords fetches the undecoded records of a given partition starting at a given offset from the broker at a given address,
+// so that data the client failed to decode can be quarantined as is. Uses a plain connection and Fetch request versions 0 to 4.
+// Returns the first message (or record batch) of the fetched records, which is the one holding the given offset.
+func fetchRawRecords(addr string, clientId string, version int16, topic string, partition int32, offset int64, maxBytes int32,
+	timeout time.Duration) ([]byte, error) {
+	if version < 0 || version > 4 {
+		return nil, fmt.Errorf("Unsupported fetch request version %d", version)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	request := encodeRawFetchRequest(clientId, version, topic, partition, offset, maxBytes)
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	var size int32
+	if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 0 || size > rawFetchMaxResponse {
+		return nil, fmt.Errorf("Invalid fetch response size %d", size)
+	}
+	response := make([]byte, size)
+	if _, err := io.ReadFull(reader, response); err != nil {
+		return nil, err
+	}
+
+	records, err := decodeRawFetchResponse(response, version, topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	return firstRecordEntry(records), nil
+}
+
+// encodeRawFetchRequest encodes a size delimited Fetch request for a single partition.
+func encodeRawFetchRequest(clientId string, version int16, topic string, partition int32, offset int64, maxBytes int32) []byte {
+	body := new(bytes.Buffer)
+	write := func(value interface{}) { binary.Write(body, binary.BigEndian, value) }
+	writeString := func(value string) {
+		write(int16(len(value)))
+		body.WriteString(value)
+	}
+
+	write(rawFetchApiKey)
+	write(version)
+	write(rawFetchCorrelationId)
+	writeString(clientId)
+
+	write(int32(-1)) // replica id
+	write(int32(0))  // max wait time, the data is already there
+	write(int32(0))  // min bytes
+	if version >= 3 {
+		write(maxBytes)
+	}
+	if version >= 4 {
+		write(int8(0)) // read uncommitted
+	}
+	write(int32(1))
+	writeString(topic)
+	write(int32(1))
+	write(partition)
+	write(offset)
+	write(maxBytes)
+
+	request := new(bytes.Buffer)
+	binary.Write(request, binary.BigEndian, int32(body.Len()))
+	request.Write(body.Bytes())
+	return request.Bytes()
+}
+
+// decodeRawFetchResponse returns the undecoded records of a given partition from a Fetch response without its size.
+func decodeRawFetchResponse(response []byte, version int16, topic string, partition int32) ([]byte, error) {
+	reader := bytes.NewReader(response)
+	var err error
+	read := func(value interface{}) {
+		if err == nil {
+			err = binary.Read(reader, binary.BigEndian, value)
+		}
+	}
+	readBytes := func(length int) []byte {
+		if err != nil || length <= 0 {
+			return nil
+		}
+		if length > reader.Len() {
+			err = io.ErrUnexpectedEOF
+			return nil
+		}
+		value := make([]byte, length)
+		reader.Read(value)
+		return value
+	}
+	readString := func() string {
+		var length int16
+		read(&length)
+		return string(readBytes(int(length)))
+	}
+
+	var correlationId, throttleTime, topics int32
+	read(&correlationId)
+	if version >= 1 {
+		read(&throttleTime)
+	}
+	read(&topics)
+	for i := int32(0); i < topics && err == nil; i++ {
+		responseTopic := readString()
+		var partitions int32
+		read(&partitions)
+		for j := int32(0); j < partitions && err == nil; j++ {
+			var responsePartition, recordsSize int32
+			var errorCode int16
+			var highwaterMark, lastStableOffset int64
+			read(&responsePartition)
+			read(&errorCode)
+			read(&highwaterMark)
+			if version >= 4 {
+				read(&lastStableOffset)
+				var abortedTransactions int32
+				read(&abortedTransactions)
+				// producer id and first offset of each aborted transaction
+				readBytes(int(abortedTransactions) * 16)
+			}
+			read(&recordsSize)
+			records := readBytes(int(recordsSize))
+			if err == nil && responseTopic == topic && responsePartition == partition {
+				return records, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.New("Fetch response does not contain the partition")
+}
+
+// firstRecordEntry returns the first message of a message set or the first batch of a record batch set, or the records as is if incomplete.
+// Both formats start with an offset and a length of the rest of the entry.
+func firstRecordEntry(records []byte) []byte {
+	if len(records) < 12 {
+		return records
+	}
+	length := int(int32(binary.BigEndian.Uint32(records[8:12])))
+	if length < 0 || 12+length > len(records) {
+		return records
+	}
+	return records[:12+length]
+}
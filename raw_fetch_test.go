@@ -0,0 +1,103 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveRawFetch accepts a single connection, reads a Fetch request and answers with a response holding given records for a partition.
+func serveRawFetch(t *testing.T, listener net.Listener, topic string, partition int32, records []byte, requests chan []byte) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var size int32
+	binary.Read(conn, binary.BigEndian, &size)
+	request := make([]byte, size)
+	io.ReadFull(conn, request)
+	requests <- request
+	version := int16(binary.BigEndian.Uint16(request[2:4]))
+
+	body := new(bytes.Buffer)
+	write := func(value interface{}) { binary.Write(body, binary.BigEndian, value) }
+	write(int32(1)) // correlation id
+	if version >= 1 {
+		write(int32(0)) // throttle time
+	}
+	write(int32(1))
+	write(int16(len(topic)))
+	body.WriteString(topic)
+	write(int32(1))
+	write(partition)
+	write(int16(2)) // corrupt message
+	write(int64(100))
+	if version >= 4 {
+		write(int64(100))
+		write(int32(1)) // a single aborted transaction
+		write(int64(7))
+		write(int64(0))
+	}
+	write(int32(len(records)))
+	body.Write(records)
+
+	binary.Write(conn, binary.BigEndian, int32(body.Len()))
+	conn.Write(body.Bytes())
+}
+
+func TestFetchRawRecords(t *testing.T) {
+	topic := "test-raw-fetch"
+	entry := func(offset int64, payload string) []byte {
+		buffer := new(bytes.Buffer)
+		binary.Write(buffer, binary.BigEndian, offset)
+		binary.Write(buffer, binary.BigEndian, int32(len(payload)))
+		buffer.WriteString(payload)
+		return buffer.Bytes()
+	}
+	first := entry(10, "corrupted batch")
+	records := append(append([]byte{}, first...), entry(12, "next batch")...)
+
+	for _, version := range []int16{0, 2, 4} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert(t, err, nil)
+		requests := make(chan []byte, 1)
+		go serveRawFetch(t, listener, topic, 3, records, requests)
+
+		payload, err := fetchRawRecords(listener.Addr().String(), "test-client", version, topic, 3, 11, 1024, time.Second)
+		assert(t, err, nil)
+		// only the batch holding the offset is returned
+		assert(t, payload, first)
+
+		request := <-requests
+		assert(t, int16(binary.BigEndian.Uint16(request[0:2])), rawFetchApiKey)
+		assert(t, int16(binary.BigEndian.Uint16(request[2:4])), version)
+		assert(t, bytes.Contains(request, []byte(topic)), true)
+		listener.Close()
+	}
+}
+
+func TestFirstRecordEntryOfIncompleteRecords(t *testing.T) {
+	truncated := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 100, 42}
+	assert(t, firstRecordEntry(truncated), truncated)
+	assert(t, firstRecordEntry([]byte{1, 2}), []byte{1, 2})
+}
@@ -0,0 +1,346 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	recordedFetch              = "fetch"
+	recordedGetAvailableOffset = "getAvailableOffset"
+)
+
+// Returned by ReplayingClient for a recorded fetch that failed with an OffsetOutOfRange error.
+var ErrReplayedOffsetOutOfRange = errors.New("Replayed fault: offset out of range")
+
+// recordedCall is a single LowLevelClient call captured by RecordingClient. Recordings are stored one call per line in JSON format.
+type recordedCall struct {
+	Method           string             `json:"method"`
+	Topic            string             `json:"topic"`
+	Partition        int32              `json:"partition"`
+	Offset           int64              `json:"offset"`
+	OffsetTime       string             `json:"offsetTime,omitempty"`
+	Messages         []*recordedMessage `json:"messages,omitempty"`
+	Error            string             `json:"error,omitempty"`
+	OffsetOutOfRange bool               `json:"offsetOutOfRange,omitempty"`
+	Corrupted        bool               `json:"corrupted,omitempty"`
+	CorruptedPayload []byte             `json:"corruptedPayload,omitempty"`
+}
+
+// recordedMessage holds the raw part of a Message. Decoded key and value are not recorded and are decoded again on replay.
+type recordedMessage struct {
+	Key                 []byte           `json:"key"`
+	Value               []byte           `json:"value"`
+	Topic               string           `json:"topic"`
+	Partition           int32            `json:"partition"`
+	Offset              int64            `json:"offset"`
+	HighwaterMarkOffset int64            `json:"highwaterMarkOffset"`
+	Timestamp           time.Time        `json:"timestamp"`
+	Headers             []*MessageHeader `json:"headers,omitempty"`
+}
+
+// RecordingClient implements LowLevelClient by decorating another LowLevelClient and writing every Fetch and GetAvailableOffset
+// call along with its result to a file. The recording can be served back with ReplayingClient.
+// Every call is written to the file before it returns, so the recording survives a crash of the process even if Close never runs.
+// The file is not synced, so a crash of the machine may lose the latest calls.
+type RecordingClient struct {
+	client  LowLevelClient
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+// Creates a new RecordingClient that wraps a given LowLevelClient and writes the recording to a file at a given path.
+// The file is truncated if it already exists.
+func NewRecordingClient(client LowLevelClient, path string) (*RecordingClient, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(file)
+	return &RecordingClient{
+		client:  client,
+		file:    file,
+		writer:  writer,
+		encoder: json.NewEncoder(writer),
+	}, nil
+}
+
+// Returns a string representation of this RecordingClient.
+func (this *RecordingClient) String() string {
+	return fmt.Sprintf("Recording %s to %s", this.client, this.file.Name())
+}
+
+// Initializes the underlying client.
+func (this *RecordingClient) Initialize() error {
+	return this.client.Initialize()
+}
+
+// Fetches messages using the underlying client and records the call.
+func (this *RecordingClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	messages, err := this.client.Fetch(topic, partition, offset)
+
+	call := &recordedCall{
+		Method:    recordedFetch,
+		Topic:     topic,
+		Partition: partition,
+		Offset:    offset,
+		Messages:  make([]*recordedMessage, 0, len(messages)),
+	}
+	for _, message := range messages {
+		call.Messages = append(call.Messages, &recordedMessage{
+			Key:                 message.Key,
+			Value:               message.Value,
+			Topic:               message.Topic,
+			Partition:           message.Partition,
+			Offset:              message.Offset,
+			HighwaterMarkOffset: message.HighwaterMarkOffset,
+			Timestamp:           message.Timestamp,
+			Headers:             message.Headers,
+		})
+	}
+	if err != nil {
+		call.Error = err.Error()
+		call.OffsetOutOfRange = this.client.IsOffsetOutOfRange(err)
+		if corrupted, ok := err.(*CorruptedDataError); ok {
+			call.Corrupted = true
+			call.Error = corrupted.Cause.Error()
+			call.CorruptedPayload = corrupted.Payload
+		}
+	}
+	this.record(call)
+
+	return messages, err
+}
+
+// Checks whether the given error indicates an OffsetOutOfRange error using the underlying client.
+func (this *RecordingClient) IsOffsetOutOfRange(err error) bool {
+	return this.client.IsOffsetOutOfRange(err)
+}
+
+// Gets the available offset using the underlying client and records the call.
+func (this *RecordingClient) GetAvailableOffset(topic string, partition int32, offsetTime string) (int64, error) {
+	offset, err := this.client.GetAvailableOffset(topic, partition, offsetTime)
+
+	call := &recordedCall{
+		Method:     recordedGetAvailableOffset,
+		Topic:      topic,
+		Partition:  partition,
+		Offset:     offset,
+		OffsetTime: offsetTime,
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	this.record(call)
+
+	return offset, err
+}
+
+// Closes the underlying client and the recording.
+func (this *RecordingClient) Close() {
+	this.client.Close()
+	inLock(&this.lock, func() {
+		if err := this.file.Close(); err != nil {
+			Errorf(this, "Failed to close recording: %s", err)
+		}
+	})
+}
+
+func (this *RecordingClient) record(call *recordedCall) {
+	inLock(&this.lock, func() {
+		if err := this.encoder.Encode(call); err != nil {
+			Errorf(this, "Failed to record %s call for %s:%d: %s", call.Method, call.Topic, call.Partition, err)
+		}
+		// the buffer only assembles a call so that it is written at once
+		if err := this.writer.Flush(); err != nil {
+			Errorf(this, "Failed to write %s call for %s:%d to recording: %s", call.Method, call.Topic, call.Partition, err)
+		}
+	})
+}
+
+// ReplayingClient implements LowLevelClient and serves results captured by RecordingClient without connecting to Kafka.
+// Fetches are matched by topic, partition and offset, available offsets by topic, partition and offset time.
+// Repeated calls with the same arguments are answered in the order they were recorded.
+// Once the recorded fetches for some arguments are exhausted, no more messages are returned for them,
+// once the recorded available offsets are exhausted, the last one is repeated.
+type ReplayingClient struct {
+	config           *ConsumerConfig
+	path             string
+	fetches          map[string][]*recordedCall
+	availableOffsets map[string][]*recordedCall
+	lock             sync.Mutex
+}
+
+// Creates a new ReplayingClient that serves a recording stored at a given path. Messages are decoded using decoders from a given ConsumerConfig.
+func NewReplayingClient(config *ConsumerConfig, path string) (*ReplayingClient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	client := &ReplayingClient{
+		config:           config,
+		path:             path,
+		fetches:          make(map[string][]*recordedCall),
+		availableOffsets: make(map[string][]*recordedCall),
+	}
+
+	decoder := json.NewDecoder(file)
+	for {
+		call := &recordedCall{}
+		if err := decoder.Decode(call); err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			// the recording process crashed while writing its last call
+			Warnf(client, "Ignoring incomplete last call of recording %s", path)
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to read recording %s: %s", path, err)
+		}
+
+		switch call.Method {
+		case recordedFetch:
+			key := fetchKey(call.Topic, call.Partition, call.Offset)
+			client.fetches[key] = append(client.fetches[key], call)
+		case recordedGetAvailableOffset:
+			key := availableOffsetKey(call.Topic, call.Partition, call.OffsetTime)
+			client.availableOffsets[key] = append(client.availableOffsets[key], call)
+		default:
+			return nil, fmt.Errorf("Unknown recorded call %s in %s", call.Method, path)
+		}
+	}
+
+	return client, nil
+}
+
+// Returns a string representation of this ReplayingClient.
+func (this *ReplayingClient) String() string {
+	return fmt.Sprintf("Replaying %s", this.path)
+}
+
+// Does nothing as the recording is loaded on creation.
+func (this *ReplayingClient) Initialize() error {
+	return nil
+}
+
+// Returns the next recorded result for a given topic, partition and offset.
+func (this *ReplayingClient) Fetch(topic string, partition int32, offset int64) ([]*Message, error) {
+	var call *recordedCall
+	key := fetchKey(topic, partition, offset)
+	inLock(&this.lock, func() {
+		if calls := this.fetches[key]; len(calls) > 0 {
+			call = calls[0]
+			this.fetches[key] = calls[1:]
+		}
+	})
+
+	if call == nil {
+		Tracef(this, "No recorded fetch left for %s:%d at offset %d", topic, partition, offset)
+		return make([]*Message, 0), nil
+	}
+
+	if call.OffsetOutOfRange {
+		return nil, ErrReplayedOffsetOutOfRange
+	}
+	if call.Corrupted {
+		return nil, &CorruptedDataError{Topic: topic, Partition: partition, Offset: offset, Payload: call.CorruptedPayload, Cause: errors.New(call.Error)}
+	}
+	if call.Error != "" {
+		return nil, errors.New(call.Error)
+	}
+
+	messages := make([]*Message, 0, len(call.Messages))
+	for _, recorded := range call.Messages {
+		messages = append(messages, this.newMessage(recorded))
+	}
+	return messages, nil
+}
+
+// Checks whether the given error is a replayed OffsetOutOfRange error.
+func (this *ReplayingClient) IsOffsetOutOfRange(err error) bool {
+	return err == ErrReplayedOffsetOutOfRange
+}
+
+// Returns the next recorded available offset for a given topic, partition and offset time.
+func (this *ReplayingClient) GetAvailableOffset(topic string, partition int32, offsetTime string) (int64, error) {
+	var call *recordedCall
+	key := availableOffsetKey(topic, partition, offsetTime)
+	inLock(&this.lock, func() {
+		calls := this.availableOffsets[key]
+		if len(calls) > 0 {
+			call = calls[0]
+		}
+		if len(calls) > 1 {
+			this.availableOffsets[key] = calls[1:]
+		}
+	})
+
+	if call == nil {
+		return -1, fmt.Errorf("No recorded %s offset for %s:%d", offsetTime, topic, partition)
+	}
+	if call.Error != "" {
+		return call.Offset, errors.New(call.Error)
+	}
+	return call.Offset, nil
+}
+
+// Does nothing as there are no connections to close.
+func (this *ReplayingClient) Close() {}
+
+func (this *ReplayingClient) newMessage(recorded *recordedMessage) *Message {
+	keyDecoder, valueDecoder := this.config.decoders(recorded.Topic)
+	decodedKey, err := keyDecoder.Decode(recorded.Key)
+	if err != nil {
+		Error(this, err.Error())
+	}
+	decodedValue, err := valueDecoder.Decode(recorded.Value)
+	if err != nil {
+		Error(this, err.Error())
+	}
+
+	return &Message{
+		Key:                 recorded.Key,
+		Value:               recorded.Value,
+		DecodedKey:          decodedKey,
+		DecodedValue:        decodedValue,
+		Topic:               recorded.Topic,
+		Partition:           recorded.Partition,
+		Offset:              recorded.Offset,
+		HighwaterMarkOffset: recorded.HighwaterMarkOffset,
+		Timestamp:           recorded.Timestamp,
+		Headers:             recorded.Headers,
+	}
+}
+
+func fetchKey(topic string, partition int32, offset int64) string {
+	return fmt.Sprintf("%s:%d:%d", topic, partition, offset)
+}
+
+func availableOffsetKey(topic string, partition int32, offsetTime string) string {
+	return fmt.Sprintf("%s:%d:%s", topic, partition, offsetTime)
+}
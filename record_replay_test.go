@@ -0,0 +1,153 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func tempRecordingPath(t *testing.T) string {
+	file, err := ioutil.TempFile("", "recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	return file.Name()
+}
+
+func TestReplayingClientServesRecordedCalls(t *testing.T) {
+	path := tempRecordingPath(t)
+	defer os.Remove(path)
+
+	recorder, err := NewRecordingClient(newStaticClient("test", 0, 5), path)
+	assert(t, err, nil)
+	recorder.Fetch("test", 0, 0)
+	recorder.Fetch("test", 0, 3)
+	recorder.Fetch("test", 0, 3)
+	_, err = recorder.Fetch("test", 0, 10)
+	assert(t, recorder.IsOffsetOutOfRange(err), true)
+	recorder.GetAvailableOffset("test", 0, SmallestOffset)
+	recorder.GetAvailableOffset("test", 0, LargestOffset)
+	recorder.Close()
+
+	config := DefaultConsumerConfig()
+	replayer, err := NewReplayingClient(config, path)
+	assert(t, err, nil)
+
+	messages, err := replayer.Fetch("test", 0, 0)
+	assert(t, err, nil)
+	assert(t, len(messages), 5)
+	assert(t, string(messages[4].Value), "message-4")
+	assert(t, messages[4].DecodedValue, []byte("message-4"))
+
+	for i := 0; i < 2; i++ {
+		messages, err = replayer.Fetch("test", 0, 3)
+		assert(t, err, nil)
+		assert(t, len(messages), 2)
+	}
+	messages, err = replayer.Fetch("test", 0, 3)
+	assert(t, err, nil)
+	assert(t, len(messages), 0)
+
+	_, err = replayer.Fetch("test", 0, 10)
+	assert(t, replayer.IsOffsetOutOfRange(err), true)
+
+	for i := 0; i < 2; i++ {
+		offset, err := replayer.GetAvailableOffset("test", 0, SmallestOffset)
+		assert(t, err, nil)
+		assert(t, offset, int64(0))
+	}
+	offset, err := replayer.GetAvailableOffset("test", 0, LargestOffset)
+	assert(t, err, nil)
+	assert(t, offset, int64(5))
+
+	_, err = replayer.GetAvailableOffset("unknown", 0, SmallestOffset)
+	assertNot(t, err, nil)
+}
+
+func TestRecordingSurvivesCrash(t *testing.T) {
+	path := tempRecordingPath(t)
+	defer os.Remove(path)
+
+	// the recorder is never closed, as if the process crashed
+	recorder, err := NewRecordingClient(newStaticClient("test", 0, 5), path)
+	assert(t, err, nil)
+	recorder.Fetch("test", 0, 0)
+	recorder.GetAvailableOffset("test", 0, LargestOffset)
+
+	// a call cut off in the middle of writing it is ignored
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert(t, err, nil)
+	file.WriteString(`{"method":"fetch","topic":"test","partition":0,"offset":3,"messages":[{"key":`)
+	file.Close()
+
+	replayer, err := NewReplayingClient(DefaultConsumerConfig(), path)
+	assert(t, err, nil)
+	messages, err := replayer.Fetch("test", 0, 0)
+	assert(t, err, nil)
+	assert(t, len(messages), 5)
+	offset, err := replayer.GetAvailableOffset("test", 0, LargestOffset)
+	assert(t, err, nil)
+	assert(t, offset, int64(5))
+	messages, _ = replayer.Fetch("test", 0, 3)
+	assert(t, len(messages), 0)
+}
+
+func TestReplayCapturedConsumerSession(t *testing.T) {
+	topic := "test-replay"
+	numMessages := 50
+	topics := map[string][]int32{topic: []int32{0}}
+	path := tempRecordingPath(t)
+	defer os.Remove(path)
+
+	consumeSession := func(client LowLevelClient) map[int64]string {
+		consumed := make(chan *Message, numMessages)
+		config := inMemoryConsumerConfig(client, topics)
+		config.Strategy = func(_ *Worker, message *Message, id TaskId) WorkerResult {
+			consumed <- message
+			return NewSuccessfulResult(id)
+		}
+
+		consumer := NewConsumer(config)
+		go consumer.StartStaticPartitions(topics)
+
+		values := make(map[int64]string)
+		timeout := time.After(consumeTimeout)
+		for len(values) < numMessages {
+			select {
+			case message := <-consumed:
+				values[message.Offset] = string(message.Value)
+			case <-timeout:
+				t.Fatalf("Failed to consume %d messages within %s. Actual messages = %d", numMessages, consumeTimeout, len(values))
+			}
+		}
+		closeWithin(t, 10*time.Second, consumer)
+		return values
+	}
+
+	recorder, err := NewRecordingClient(newStaticClient(topic, 0, numMessages), path)
+	assert(t, err, nil)
+	recorded := consumeSession(recorder)
+
+	replayer, err := NewReplayingClient(DefaultConsumerConfig(), path)
+	assert(t, err, nil)
+	replayed := consumeSession(replayer)
+
+	assert(t, replayed, recorded)
+}
@@ -0,0 +1,274 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// SharedClient is a pool of Kafka broker connections shared by several consumers in one process, e.g. consumers of different groups.
+// Consumers attach to it with SaramaClients created by NewSaramaClient. Fetch requests that attached clients issue to the same broker
+// at the same time are multiplexed into a single request.
+// The connections are opened when the first attached client is initialized and closed when the last one is closed.
+// Only broker connections are shared: every consumer still has its own Coordinator, e.g. its own Zookeeper session.
+type SharedClient struct {
+	lock     sync.Mutex
+	client   sarama.Client
+	version  sarama.KafkaVersion
+	refs     int
+	fetchers map[int32]*brokerFetcher
+
+	// settings of the client that opened the connections, which all attached clients have to agree with
+	kafkaVersion string
+	clientid     string
+}
+
+// Creates a new SharedClient. It does not connect to Kafka until the first attached client is initialized.
+func NewSharedClient() *SharedClient {
+	return &SharedClient{}
+}
+
+// Returns a string representation of this SharedClient.
+func (this *SharedClient) String() string {
+	return "Shared client"
+}
+
+// Creates a new SaramaClient for a given ConsumerConfig using the broker connections of this SharedClient.
+// Fetch settings, decoders and offset storage requests are still taken from the given ConsumerConfig.
+func (this *SharedClient) NewSaramaClient(config *ConsumerConfig) *SaramaClient {
+	return &SaramaClient{
+		config: config,
+		shared: this,
+	}
+}
+
+// Returns the number of initialized clients attached to this SharedClient.
+func (this *SharedClient) Refs() int {
+	var refs int
+	inLock(&this.lock, func() { refs = this.refs })
+	return refs
+}
+
+// attach connects to Kafka using a given ConsumerConfig if no client is attached yet, and counts a reference to the connections.
+// The Kafka protocol version is resolved by the first attached client. Returns an error if the KafkaVersion or Clientid
+// of the given ConsumerConfig differ from the ones the connections were opened with.
+func (this *SharedClient) attach(config *ConsumerConfig) (client sarama.Client, version sarama.KafkaVersion, err error) {
+	inLock(&this.lock, func() {
+		if this.client == nil {
+			Info(this, "Connecting to Kafka")
+			this.client, this.version, err = connectSarama(config)
+			if err != nil {
+				return
+			}
+			this.fetchers = make(map[int32]*brokerFetcher)
+			this.kafkaVersion = config.KafkaVersion
+			this.clientid = config.Clientid
+		} else if config.KafkaVersion != this.kafkaVersion {
+			err = fmt.Errorf("Shared client is connected with KafkaVersion %q, cannot attach a client with KafkaVersion %q", this.kafkaVersion, config.KafkaVersion)
+			return
+		} else if config.Clientid != this.clientid {
+			err = fmt.Errorf("Shared client is connected with Clientid %q, cannot attach a client with Clientid %q", this.clientid, config.Clientid)
+			return
+		}
+		this.refs++
+		client, version = this.client, this.version
+	})
+	return
+}
+
+// detach releases a reference to the connections and closes them if it was the last one.
+func (this *SharedClient) detach() {
+	inLock(&this.lock, func() {
+		if this.refs == 0 {
+			return
+		}
+		this.refs--
+		if this.refs > 0 {
+			return
+		}
+
+		Info(this, "Last client detached, closing connections to Kafka")
+		for _, fetcher := range this.fetchers {
+			fetcher.stop()
+		}
+		this.fetchers = nil
+		if err := this.client.Close(); err != nil {
+			Warnw(this, "Failed to close connections to Kafka", Fields{"error": err})
+		}
+		this.client = nil
+	})
+}
+
+// fetch adds a block for a given partition to the next request sent to a given broker with the settings of a given request,
+// and returns the response to that request. The response may contain blocks of other partitions.
+func (this *SharedClient) fetch(broker *sarama.Broker, request *sarama.FetchRequest, topic string, partition int32, offset int64,
+	maxBytes int32) (*sarama.FetchResponse, error) {
+	var fetcher *brokerFetcher
+	inLock(&this.lock, func() {
+		if this.fetchers == nil {
+			return
+		}
+		fetcher = this.fetchers[broker.ID()]
+		if fetcher == nil {
+			fetcher = newBrokerFetcher(broker.ID())
+			this.fetchers[broker.ID()] = fetcher
+			go fetcher.run()
+		}
+	})
+	if fetcher == nil {
+		return nil, errors.New("Shared client is closed")
+	}
+
+	return fetcher.fetch(&fetchCall{
+		broker:    broker,
+		request:   request,
+		topic:     topic,
+		partition: partition,
+		offset:    offset,
+		maxBytes:  maxBytes,
+		done:      make(chan *fetchResult, 1),
+	})
+}
+
+// fetchCall is a single partition fetch waiting to be sent to a broker.
+type fetchCall struct {
+	broker    *sarama.Broker
+	request   *sarama.FetchRequest
+	topic     string
+	partition int32
+	offset    int64
+	maxBytes  int32
+	done      chan *fetchResult
+}
+
+type fetchResult struct {
+	response *sarama.FetchResponse
+	err      error
+}
+
+// brokerFetcher sends the fetch calls for a single broker. Calls made while a request is in flight are sent together in the next request.
+type brokerFetcher struct {
+	id       int32
+	calls    chan *fetchCall
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newBrokerFetcher(id int32) *brokerFetcher {
+	return &brokerFetcher{
+		id:      id,
+		calls:   make(chan *fetchCall),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (this *brokerFetcher) String() string {
+	return fmt.Sprintf("broker-%d-fetcher", this.id)
+}
+
+func (this *brokerFetcher) fetch(call *fetchCall) (*sarama.FetchResponse, error) {
+	select {
+	case this.calls <- call:
+	case <-this.stopped:
+		return nil, errors.New("Shared client is closed")
+	}
+	result := <-call.done
+	return result.response, result.err
+}
+
+func (this *brokerFetcher) run() {
+	for {
+		select {
+		case <-this.stopped:
+			return
+		case call := <-this.calls:
+			calls := []*fetchCall{call}
+		collect:
+			for {
+				select {
+				case call := <-this.calls:
+					calls = append(calls, call)
+				default:
+					break collect
+				}
+			}
+
+			for len(calls) > 0 {
+				calls = this.send(calls)
+			}
+		}
+	}
+}
+
+// send sends the given calls in a single request and returns the calls left for the next one.
+// A request holds a single block per partition, so calls for a partition already in the request are left over.
+func (this *brokerFetcher) send(calls []*fetchCall) []*fetchCall {
+	request := &sarama.FetchRequest{
+		Version:     calls[0].request.Version,
+		MaxBytes:    calls[0].request.MaxBytes,
+		Isolation:   calls[0].request.Isolation,
+		MinBytes:    calls[0].request.MinBytes,
+		MaxWaitTime: calls[0].request.MaxWaitTime,
+	}
+	sent := make([]*fetchCall, 0, len(calls))
+	left := make([]*fetchCall, 0)
+	partitions := make(map[TopicAndPartition]bool)
+	for _, call := range calls {
+		topicPartition := TopicAndPartition{call.topic, call.partition}
+		if partitions[topicPartition] {
+			left = append(left, call)
+			continue
+		}
+		partitions[topicPartition] = true
+		// no call waits longer or for more data than it asked for
+		if call.request.MinBytes < request.MinBytes {
+			request.MinBytes = call.request.MinBytes
+		}
+		if call.request.MaxWaitTime < request.MaxWaitTime {
+			request.MaxWaitTime = call.request.MaxWaitTime
+		}
+		request.AddBlock(call.topic, call.partition, call.offset, call.maxBytes)
+		sent = append(sent, call)
+	}
+
+	if Logger.IsAllowed(TraceLevel) {
+		Tracew(this, "Sending multiplexed fetch request", Fields{"partitions": len(sent)})
+	}
+	response, err := calls[0].broker.Fetch(request)
+	if _, ok := err.(sarama.PacketDecodingError); ok && len(sent) > 1 {
+		// the broken partition is unknown, so fetch each partition on its own to not report corrupted data for all of them
+		for _, call := range sent {
+			request := *call.request
+			request.AddBlock(call.topic, call.partition, call.offset, call.maxBytes)
+			response, err := call.broker.Fetch(&request)
+			call.done <- &fetchResult{response, err}
+		}
+		return left
+	}
+
+	for _, call := range sent {
+		call.done <- &fetchResult{response, err}
+	}
+	return left
+}
+
+func (this *brokerFetcher) stop() {
+	this.stopOnce.Do(func() { close(this.stopped) })
+}
@@ -0,0 +1,157 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestBrokerFetcherMultiplexesPartitions(t *testing.T) {
+	topic := "test-shared-client-multiplexing"
+	mockBroker := sarama.NewMockBroker(t, 1)
+	defer mockBroker.Close()
+	mockBroker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).
+			SetMessage(topic, 0, 0, sarama.StringEncoder("p0-m0")).
+			SetMessage(topic, 0, 1, sarama.StringEncoder("p0-m1")).
+			SetMessage(topic, 1, 0, sarama.StringEncoder("p1-m0")),
+	})
+
+	broker := sarama.NewBroker(mockBroker.Addr())
+	if err := broker.Open(sarama.NewConfig()); err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	newCall := func(partition int32, offset int64) *fetchCall {
+		return &fetchCall{
+			broker:    broker,
+			request:   &sarama.FetchRequest{MinBytes: 1, MaxWaitTime: 100},
+			topic:     topic,
+			partition: partition,
+			offset:    offset,
+			maxBytes:  1024,
+			done:      make(chan *fetchResult, 1),
+		}
+	}
+	calls := []*fetchCall{newCall(0, 0), newCall(1, 0), newCall(0, 1)}
+
+	// both partitions go into one request, the second call for partition 0 has to wait for the next one
+	fetcher := newBrokerFetcher(1)
+	left := fetcher.send(calls)
+	assert(t, left, []*fetchCall{calls[2]})
+	first, second := <-calls[0].done, <-calls[1].done
+	assert(t, first.err, nil)
+	assert(t, first.response == second.response, true)
+	assert(t, first.response.GetBlock(topic, 0) != nil, true)
+	assert(t, first.response.GetBlock(topic, 1) != nil, true)
+
+	assert(t, len(fetcher.send(left)), 0)
+	third := <-calls[2].done
+	assert(t, third.err, nil)
+	assert(t, third.response.GetBlock(topic, 0) != nil, true)
+
+	fetches := 0
+	for _, exchange := range mockBroker.History() {
+		if _, ok := exchange.Request.(*sarama.FetchRequest); ok {
+			fetches++
+		}
+	}
+	assert(t, fetches, 2)
+}
+
+func TestConsumersSharingClient(t *testing.T) {
+	topic := fmt.Sprintf("test-shared-client-%d", time.Now().Unix())
+	CreateMultiplePartitionsTopic(localZk, topic, 2)
+	EnsureHasLeader(localZk, topic)
+	go produceN(t, numMessages, topic, localBroker)
+
+	shared := NewSharedClient()
+	consumers := make([]*Consumer, 0)
+	statuses := make([]chan int, 0)
+	for i := 0; i < 2; i++ {
+		consumeStatus := make(chan int)
+		config := testConsumerConfig()
+		config.Groupid = fmt.Sprintf("%s-group-%d", topic, i)
+		config.LowLevelClient = shared.NewSaramaClient(config)
+		config.Strategy = newCountingStrategy(t, numMessages, consumeTimeout, consumeStatus)
+		consumer := NewConsumer(config)
+		go consumer.StartStatic(map[string]int{topic: 2})
+		consumers = append(consumers, consumer)
+		statuses = append(statuses, consumeStatus)
+	}
+	assert(t, shared.Refs(), 2)
+
+	// every group consumes all messages over the same connections
+	for i, consumeStatus := range statuses {
+		if actual := <-consumeStatus; actual != numMessages {
+			t.Errorf("Consumer %d failed to consume %d messages within %s. Actual messages = %d", i, numMessages, consumeTimeout, actual)
+		}
+	}
+
+	closeWithin(t, 10*time.Second, consumers[0])
+	assert(t, shared.Refs(), 1)
+	closeWithin(t, 10*time.Second, consumers[1])
+	assert(t, shared.Refs(), 0)
+}
+
+func TestSharedClientRejectsConflictingSettings(t *testing.T) {
+	mockBroker := sarama.NewMockBroker(t, 1)
+	defer mockBroker.Close()
+	mockBroker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(mockBroker.Addr(), mockBroker.BrokerID()),
+	})
+	kafka, err := sarama.NewClient([]string{mockBroker.Addr()}, sarama.NewConfig())
+	assert(t, err, nil)
+
+	// connected as if by a first client with the following settings
+	first := DefaultConsumerConfig()
+	first.Clientid = "first"
+	first.KafkaVersion = "0.10.2.0"
+	shared := NewSharedClient()
+	shared.client = kafka
+	shared.fetchers = make(map[int32]*brokerFetcher)
+	shared.kafkaVersion = first.KafkaVersion
+	shared.clientid = first.Clientid
+	shared.refs = 1
+
+	otherVersion := DefaultConsumerConfig()
+	otherVersion.Clientid = first.Clientid
+	otherVersion.KafkaVersion = "1.0.0"
+	_, _, err = shared.attach(otherVersion)
+	assertNot(t, err, nil)
+
+	otherClientid := DefaultConsumerConfig()
+	otherClientid.Clientid = "second"
+	otherClientid.KafkaVersion = first.KafkaVersion
+	_, _, err = shared.attach(otherClientid)
+	assertNot(t, err, nil)
+	assert(t, shared.Refs(), 1)
+
+	client, _, err := shared.attach(first)
+	assert(t, err, nil)
+	assert(t, client, kafka)
+	assert(t, shared.Refs(), 2)
+
+	shared.detach()
+	shared.detach()
+	assert(t, shared.Refs(), 0)
+}
@@ -16,7 +16,9 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 )
 
@@ -47,12 +49,40 @@ type Message struct {
 
 	// HighwaterMarkOffset is an offset of the last message in this topic-partition.
 	HighwaterMarkOffset int64
+
+	// Message timestamp. Zero if the protocol version in use does not support timestamps.
+	Timestamp time.Time
+
+	// Message headers. Empty if the protocol version in use does not support headers.
+	Headers []*MessageHeader
+
+	ctx     context.Context
+	fetched time.Time
 }
 
 func (m *Message) String() string {
 	return fmt.Sprintf("Message{Topic: %s, Partition: %d, Offset: %d}", m.Topic, m.Partition, m.Offset)
 }
 
+// Returns the context of the task processing this message. It holds the span of the task created by ConsumerConfig.Tracer,
+// so spans started by a Strategy become its children. The context is the same for all retries of the task.
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+	return m.ctx
+}
+
+// MessageHeader is a single key-value header attached to a Kafka message.
+type MessageHeader struct {
+	Key   []byte
+	Value []byte
+}
+
+func (h *MessageHeader) String() string {
+	return fmt.Sprintf("{Key: %s, Value: %s}", h.Key, h.Value)
+}
+
 //General information about Kafka broker. Used to keep it in consumer coordinator.
 type BrokerInfo struct {
 	Version int16
@@ -139,9 +169,19 @@ type partitionTopicInfo struct {
 	FetchedOffset int64
 }
 
+// fetchedOffset returns the FetchedOffset of this partitionTopicInfo. It is read and updated atomically
+// as it is updated by a fetcher routine while the consumer may read it, e.g. to introspect it.
+func (p *partitionTopicInfo) fetchedOffset() int64 {
+	return atomic.LoadInt64(&p.FetchedOffset)
+}
+
+func (p *partitionTopicInfo) setFetchedOffset(offset int64) {
+	atomic.StoreInt64(&p.FetchedOffset, offset)
+}
+
 func (p *partitionTopicInfo) String() string {
 	return fmt.Sprintf("{Topic: %s, Partition: %d, FetchedOffset: %d, Buffer: %s}",
-		p.Topic, p.Partition, p.FetchedOffset, p.Buffer)
+		p.Topic, p.Partition, p.fetchedOffset(), p.Buffer)
 }
 
 type intArray []int32
@@ -220,6 +260,13 @@ type ConsumerCoordinator interface {
 	RemoveOldApiRequests(group string) error
 }
 
+// ConnectionStateCoordinator is a ConsumerCoordinator able to tell whether it is currently connected. Implemented by ZookeeperCoordinator.
+// Consumers report the state of such coordinators in their health checks.
+type ConnectionStateCoordinator interface {
+	/* Returns true if this ConsumerCoordinator is connected, false otherwise. */
+	IsConnected() bool
+}
+
 // CoordinatorEvent is sent by consumer coordinator representing some state change.
 type CoordinatorEvent string
 
@@ -245,12 +292,51 @@ type OffsetStorage interface {
 	CommitOffset(group string, topic string, partition int32, offset int64) error
 }
 
+// OffsetAndMetadata is an offset along with an arbitrary metadata string stored with it.
+type OffsetAndMetadata struct {
+	Offset   int64
+	Metadata string
+}
+
+// BatchOffsetStorage is an OffsetStorage that is able to get and commit offsets for multiple partitions in a single request
+// and to store metadata along with committed offsets. Consumer uses these methods instead of GetOffset and CommitOffset if
+// the configured OffsetStorage implements this interface.
+type BatchOffsetStorage interface {
+	OffsetStorage
+
+	// Gets the offsets and metadata for a given group and topic partitions.
+	// Partitions without a committed offset should be mapped to InvalidOffset.
+	// May return an error if fails to retrieve the offsets.
+	GetOffsets(group string, topicPartitions []*TopicAndPartition) (map[TopicAndPartition]OffsetAndMetadata, error)
+
+	// Commits the given offsets and metadata for a given group.
+	// May return an error if fails to commit any of the offsets.
+	CommitOffsets(group string, offsets map[TopicAndPartition]OffsetAndMetadata) error
+}
+
+// TransactionalOffsetStorage lets offsets be stored in the same transaction as the results of processing, which gives exactly-once
+// delivery into the store. If configured, WorkerManager hands each fully processed batch to CommitBatch instead of committing
+// offsets to OffsetStorage, and Consumer gets the starting offsets of assigned partitions from GetOffset.
+type TransactionalOffsetStorage interface {
+	// Gets the last offset committed with CommitBatch for a given group, topic and partition.
+	// Should return InvalidOffset if nothing has been committed yet. Called each time partitions are assigned to the consumer.
+	GetOffset(group string, topic string, partition int32) (int64, error)
+
+	// Stores the results of a processed batch and the largest processed offset for a given group and topic partition in a single transaction.
+	// Results contain a WorkerResult for each message that should be committed, in the order of their offsets. Strategies may return
+	// their own WorkerResult implementations to pass processed data here.
+	// If an error is returned nothing should be stored. Batches that fail to commit after OffsetsCommitMaxRetries retries stop the consumer.
+	CommitBatch(group string, topicPartition TopicAndPartition, offset int64, results []WorkerResult) error
+}
+
 // Represents a consumer state snapshot.
 type StateSnapshot struct {
 	// Metrics are a map where keys are event names and values are maps holding event values grouped by meters (count, min, max, etc.).
 	Metrics map[string]map[string]float64
 	// Offsets are a map where keys are topics and values are maps where keys are partitions and values are offsets for these topic-partitions.
 	Offsets map[string]map[int32]int64
+	// Lags are a map where keys are topics and values are maps where keys are partitions and values are lags of these topic-partitions.
+	Lags map[string]map[int32]PartitionLag
 }
 
 type FailedMessage struct {
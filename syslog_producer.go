@@ -171,17 +171,20 @@ func (this *SyslogProducer) scan(connection net.Conn) {
 func (this *SyslogProducer) startProducers() {
 	brokerList := strings.Split(this.config.BrokerList, ",")
 	conf := this.config.ProducerConfig
+	version, err := ResolveKafkaVersion(conf.KafkaVersion, brokerList, conf.Clientid)
+	if err != nil {
+		panic(err)
+	}
+
 	config := sarama.NewConfig()
+	config.Version = version
 	config.ClientID = conf.Clientid
 	config.ChannelBufferSize = conf.SendBufferSize
-	switch strings.ToLower(conf.CompressionCodec) {
-	case "none":
-		config.Producer.Compression = sarama.CompressionNone
-	case "gzip":
-		config.Producer.Compression = sarama.CompressionGZIP
-	case "snappy":
-		config.Producer.Compression = sarama.CompressionSnappy
+	config.Producer.Compression, err = saramaCompressionCodec(conf.CompressionCodec, version)
+	if err != nil {
+		panic(err)
 	}
+	config.Producer.CompressionLevel = saramaCompressionLevel(conf.CompressionLevel)
 	config.Producer.Flush.Bytes = conf.FlushByteCount
 	config.Producer.Flush.Frequency = conf.FlushTimeout
 	config.Producer.Flush.Messages = conf.BatchSize
@@ -0,0 +1,170 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// TopicConfig overrides settings of a ConsumerConfig for a single topic or for topics matching a regex.
+// Unset fields keep the settings of the ConsumerConfig.
+type TopicConfig struct {
+	/* Overrides ConsumerConfig.Strategy. */
+	Strategy WorkerStrategy
+
+	/* Overrides ConsumerConfig.KeyDecoder. */
+	KeyDecoder Decoder
+
+	/* Overrides ConsumerConfig.ValueDecoder. */
+	ValueDecoder Decoder
+
+	/* Overrides ConsumerConfig.NumWorkers. */
+	NumWorkers int
+
+	/* Overrides ConsumerConfig.FetchBatchSize. */
+	FetchBatchSize int
+
+	/* Overrides ConsumerConfig.MaxWorkerRetries. A negative value disables retries. */
+	MaxWorkerRetries int
+
+	/* Overrides ConsumerConfig.WorkerBackoff. */
+	WorkerBackoff time.Duration
+
+	/* Overrides ConsumerConfig.WorkerFailedAttemptCallback. */
+	WorkerFailedAttemptCallback FailedAttemptCallback
+}
+
+func (this *TopicConfig) String() string {
+	return fmt.Sprintf("TopicConfig{NumWorkers: %d, FetchBatchSize: %d, MaxWorkerRetries: %d, WorkerBackoff: %v}",
+		this.NumWorkers, this.FetchBatchSize, this.MaxWorkerRetries, this.WorkerBackoff)
+}
+
+// TopicPatternConfig is a TopicConfig for every topic that matches a given regex. Create it with NewTopicPatternConfig.
+type TopicPatternConfig struct {
+	Config *TopicConfig
+
+	rawRegex      string
+	compiledRegex *regexp.Regexp
+}
+
+// Creates a new TopicPatternConfig applying a given TopicConfig to topics matching a given regex. Panics if the regex is invalid.
+func NewTopicPatternConfig(regex string, config *TopicConfig) *TopicPatternConfig {
+	cregexp, err := regexp.Compile(regex)
+	if err != nil {
+		panic(err)
+	}
+	return &TopicPatternConfig{
+		Config:        config,
+		rawRegex:      regex,
+		compiledRegex: cregexp,
+	}
+}
+
+func (this *TopicPatternConfig) Regex() string {
+	return this.rawRegex
+}
+
+func (this *TopicPatternConfig) String() string {
+	return fmt.Sprintf("%s: %s", this.rawRegex, this.Config)
+}
+
+// Returns the TopicConfig for a given topic: an entry of TopicConfigs if one exists, otherwise the first entry of TopicPatternConfigs matching the topic.
+// Returns nil if no override applies.
+func (c *ConsumerConfig) TopicConfig(topic string) *TopicConfig {
+	if config, exists := c.TopicConfigs[topic]; exists && config != nil {
+		return config
+	}
+	for _, pattern := range c.TopicPatternConfigs {
+		if pattern.compiledRegex.MatchString(topic) {
+			return pattern.Config
+		}
+	}
+	return nil
+}
+
+// Returns a ConsumerConfig for a given topic with the overrides of its TopicConfig applied.
+// Returns this ConsumerConfig itself if no override applies, and a shallow copy otherwise.
+func (c *ConsumerConfig) ForTopic(topic string) *ConsumerConfig {
+	override := c.TopicConfig(topic)
+	if override == nil {
+		return c
+	}
+
+	config := *c
+	if override.Strategy != nil {
+		config.Strategy = override.Strategy
+	}
+	if override.KeyDecoder != nil {
+		config.KeyDecoder = override.KeyDecoder
+	}
+	if override.ValueDecoder != nil {
+		config.ValueDecoder = override.ValueDecoder
+	}
+	if override.NumWorkers > 0 {
+		config.NumWorkers = override.NumWorkers
+	}
+	if override.FetchBatchSize > 0 {
+		config.FetchBatchSize = override.FetchBatchSize
+	}
+	if override.MaxWorkerRetries > 0 {
+		config.MaxWorkerRetries = override.MaxWorkerRetries
+	} else if override.MaxWorkerRetries < 0 {
+		config.MaxWorkerRetries = 0
+	}
+	if override.WorkerBackoff > 0 {
+		config.WorkerBackoff = override.WorkerBackoff
+	}
+	if override.WorkerFailedAttemptCallback != nil {
+		config.WorkerFailedAttemptCallback = override.WorkerFailedAttemptCallback
+	}
+	return &config
+}
+
+// decoders returns the key and value decoders for a given topic without copying this ConsumerConfig.
+func (c *ConsumerConfig) decoders(topic string) (Decoder, Decoder) {
+	keyDecoder, valueDecoder := c.KeyDecoder, c.ValueDecoder
+	if override := c.TopicConfig(topic); override != nil {
+		if override.KeyDecoder != nil {
+			keyDecoder = override.KeyDecoder
+		}
+		if override.ValueDecoder != nil {
+			valueDecoder = override.ValueDecoder
+		}
+	}
+	return keyDecoder, valueDecoder
+}
+
+// validateTopicConfig checks a TopicConfig against the settings of a given ConsumerConfig.
+func validateTopicConfig(c *ConsumerConfig, name string, config *TopicConfig) error {
+	if config == nil {
+		return fmt.Errorf("TopicConfig for %s is not set", name)
+	}
+	if config.NumWorkers < 0 {
+		return fmt.Errorf("NumWorkers for %s cannot be less than 0", name)
+	}
+	if c.AdaptiveWorkers && config.NumWorkers > 0 && (config.NumWorkers < c.MinWorkers || config.NumWorkers > c.MaxWorkers) {
+		return fmt.Errorf("NumWorkers for %s should be between MinWorkers and MaxWorkers", name)
+	}
+	if config.FetchBatchSize < 0 {
+		return fmt.Errorf("FetchBatchSize for %s cannot be less than 0", name)
+	}
+	if config.WorkerBackoff < 0 {
+		return fmt.Errorf("WorkerBackoff for %s cannot be less than 0", name)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopicConfigOverrides(t *testing.T) {
+	config := DefaultConsumerConfig()
+	config.MaxWorkerRetries = 3
+	orders := &TopicConfig{NumWorkers: 2, FetchBatchSize: 10, MaxWorkerRetries: -1, ValueDecoder: &StringDecoder{}}
+	events := &TopicConfig{NumWorkers: 20, WorkerBackoff: time.Second}
+	config.TopicConfigs = map[string]*TopicConfig{"orders": orders}
+	config.TopicPatternConfigs = []*TopicPatternConfig{
+		NewTopicPatternConfig("^orders.*", &TopicConfig{NumWorkers: 5}),
+		NewTopicPatternConfig("^events\\.", events),
+	}
+
+	// exact topic entries take precedence over patterns
+	assert(t, config.TopicConfig("orders"), orders)
+	assert(t, config.TopicConfig("orders-eu").NumWorkers, 5)
+	assert(t, config.TopicConfig("events.clicks"), events)
+	assert(t, config.TopicConfig("logs") == nil, true)
+
+	// topics without overrides share the ConsumerConfig
+	assert(t, config.ForTopic("logs") == config, true)
+
+	ordersConfig := config.ForTopic("orders")
+	assert(t, ordersConfig.NumWorkers, 2)
+	assert(t, ordersConfig.FetchBatchSize, 10)
+	assert(t, ordersConfig.MaxWorkerRetries, 0)
+	assert(t, ordersConfig.WorkerBackoff, config.WorkerBackoff)
+	assert(t, ordersConfig.ValueDecoder, Decoder(&StringDecoder{}))
+	assert(t, ordersConfig.KeyDecoder, config.KeyDecoder)
+	assert(t, config.NumWorkers, 10)
+
+	eventsConfig := config.ForTopic("events.clicks")
+	assert(t, eventsConfig.NumWorkers, 20)
+	assert(t, eventsConfig.FetchBatchSize, config.FetchBatchSize)
+	assert(t, eventsConfig.MaxWorkerRetries, 3)
+	assert(t, eventsConfig.WorkerBackoff, time.Second)
+
+	keyDecoder, valueDecoder := config.decoders("orders")
+	assert(t, keyDecoder, config.KeyDecoder)
+	assert(t, valueDecoder, Decoder(&StringDecoder{}))
+
+	assert(t, validateTopicConfig(config, "orders", orders), nil)
+	assert(t, validateTopicConfig(config, "orders", &TopicConfig{FetchBatchSize: -1}).Error(), "FetchBatchSize for orders cannot be less than 0")
+	config.AdaptiveWorkers = true
+	config.MaxWorkers = 10
+	assert(t, validateTopicConfig(config, "events", events).Error(), "NumWorkers for events should be between MinWorkers and MaxWorkers")
+}
+
+func TestTopicPatternConfigValidation(t *testing.T) {
+	topic := "test-topic-pattern-validation"
+	config := inMemoryConsumerConfig(newStaticClient(topic, 0, 1), map[string][]int32{topic: []int32{0}})
+	config.Strategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult {
+		return NewSuccessfulResult(id)
+	}
+
+	config.TopicPatternConfigs = []*TopicPatternConfig{NewTopicPatternConfig("^test-", &TopicConfig{NumWorkers: 5})}
+	assert(t, config.Validate(), nil)
+
+	// the regex of a literal entry is never compiled
+	config.TopicPatternConfigs = []*TopicPatternConfig{&TopicPatternConfig{Config: &TopicConfig{NumWorkers: 5}}}
+	assert(t, config.Validate().Error(), "TopicPatternConfigs entries should be created with NewTopicPatternConfig")
+}
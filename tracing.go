@@ -0,0 +1,89 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"context"
+)
+
+const (
+	// Span of a single fetch request for a topic-partition.
+	SpanFetch = "kafka.fetch"
+	// Span from the first message added to a message buffer until the batch is handed to the worker manager.
+	SpanBatch = "kafka.batch"
+	// Span from handing a message to a worker until its task is done, including all retries.
+	SpanTask = "kafka.task"
+	// Span of a single retry of a failed task, including the worker backoff. A child of the task span.
+	SpanRetry = "kafka.retry"
+	// Span of an offset commit, including all its retries.
+	SpanCommit = "kafka.commit"
+)
+
+// Tracer creates spans for the stages a message goes through in a consumer: fetch, batch accumulation, task execution, retries and offset commit.
+// Set ConsumerConfig.Tracer to trace a consumer. The default NoopTracer does nothing.
+type Tracer interface {
+	// Starts a new span with a given name as a child of the span in a given context, if any.
+	// Returns a context holding the new span along with the span itself.
+	StartSpan(ctx context.Context, name string, attributes ...SpanAttribute) (context.Context, Span)
+
+	// Returns a copy of a given context holding the trace context propagated in given message headers, if any.
+	Extract(ctx context.Context, headers []*MessageHeader) context.Context
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	// Adds given attributes to this span.
+	SetAttributes(attributes ...SpanAttribute)
+
+	// Marks this span as failed with a given error.
+	RecordError(err error)
+
+	// Ends this span. No methods should be called on a span after it has ended.
+	End()
+}
+
+// SpanAttribute is a key-value pair describing a span.
+type SpanAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// NoopTracer is a Tracer that neither creates spans nor extracts trace context.
+var NoopTracer Tracer = noopTracer{}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, _ string, _ ...SpanAttribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Extract(ctx context.Context, _ []*MessageHeader) context.Context {
+	return ctx
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(_ ...SpanAttribute) {}
+func (noopSpan) RecordError(_ error)              {}
+func (noopSpan) End()                             {}
+
+// partitionAttributes returns span attributes describing a given topic-partition, followed by given attributes.
+func partitionAttributes(topicPartition TopicAndPartition, attributes ...SpanAttribute) []SpanAttribute {
+	return append([]SpanAttribute{
+		{"kafka.topic", topicPartition.Topic},
+		{"kafka.partition", topicPartition.Partition},
+	}, attributes...)
+}
@@ -0,0 +1,169 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type spanKey struct{}
+type traceIdKey struct{}
+
+// recordedSpan is a Span recorded by a recordingTracer.
+type recordedSpan struct {
+	name       string
+	traceId    string
+	parent     *recordedSpan
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+	tracer     *recordingTracer
+}
+
+func (this *recordedSpan) SetAttributes(attributes ...SpanAttribute) {
+	inLock(&this.tracer.lock, func() {
+		for _, attribute := range attributes {
+			this.attributes[attribute.Key] = attribute.Value
+		}
+	})
+}
+
+func (this *recordedSpan) RecordError(err error) {
+	inLock(&this.tracer.lock, func() { this.err = err })
+}
+
+func (this *recordedSpan) End() {
+	inLock(&this.tracer.lock, func() { this.ended = true })
+}
+
+// recordingTracer is a Tracer recording all spans and extracting trace ids from the trace-id message header.
+type recordingTracer struct {
+	spans []*recordedSpan
+	lock  sync.Mutex
+}
+
+func (this *recordingTracer) StartSpan(ctx context.Context, name string, attributes ...SpanAttribute) (context.Context, Span) {
+	span := &recordedSpan{name: name, attributes: make(map[string]interface{}), tracer: this}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent
+		span.traceId = parent.traceId
+	} else if traceId, ok := ctx.Value(traceIdKey{}).(string); ok {
+		span.traceId = traceId
+	}
+	inLock(&this.lock, func() { this.spans = append(this.spans, span) })
+	span.SetAttributes(attributes...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (this *recordingTracer) Extract(ctx context.Context, headers []*MessageHeader) context.Context {
+	for _, header := range headers {
+		if string(header.Key) == "trace-id" {
+			return context.WithValue(ctx, traceIdKey{}, string(header.Value))
+		}
+	}
+	return ctx
+}
+
+func (this *recordingTracer) spansNamed(name string) []*recordedSpan {
+	spans := make([]*recordedSpan, 0)
+	inLock(&this.lock, func() {
+		for _, span := range this.spans {
+			if span.name == name {
+				spans = append(spans, span)
+			}
+		}
+	})
+	return spans
+}
+
+func TestConsumerTracing(t *testing.T) {
+	topic := "test-tracing"
+	topics := map[string][]int32{topic: []int32{0}}
+	client := newStaticClient(topic, 0, 10)
+	client.messages[3].Headers = []*MessageHeader{&MessageHeader{Key: []byte("trace-id"), Value: []byte("trace-3")}}
+	tracer := &recordingTracer{}
+
+	var strategySpans []*recordedSpan
+	var lock sync.Mutex
+	processed := make(chan bool)
+	config := inMemoryConsumerConfig(client, topics)
+	config.FetchBatchSize = 10
+	config.OffsetCommitInterval = 100 * time.Millisecond
+	config.WorkerBackoff = 10 * time.Millisecond
+	config.Tracer = tracer
+	config.Strategy = func(_ *Worker, message *Message, id TaskId) WorkerResult {
+		if message.Offset != 3 {
+			return NewSuccessfulResult(id)
+		}
+
+		span, _ := message.Context().Value(spanKey{}).(*recordedSpan)
+		failed := false
+		inLock(&lock, func() {
+			strategySpans = append(strategySpans, span)
+			failed = len(strategySpans) == 1
+		})
+		if failed {
+			return NewProcessingFailedResult(id)
+		}
+		processed <- true
+		return NewSuccessfulResult(id)
+	}
+
+	consumer := NewConsumer(config)
+	go consumer.StartStaticPartitions(topics)
+
+	select {
+	case <-processed:
+	case <-time.After(consumeTimeout):
+		t.Fatalf("Failed to consume all messages within %s", consumeTimeout)
+	}
+	closeWithin(t, 10*time.Second, consumer)
+
+	assert(t, len(strategySpans), 2)
+	assert(t, strategySpans[0].name, SpanTask)
+	assert(t, strategySpans[0].traceId, "trace-3")
+	// the message context is set once per task, so retries see the task span too
+	assert(t, strategySpans[1] == strategySpans[0], true)
+	assert(t, strategySpans[0].ended, true)
+	assert(t, strategySpans[0].err, nil)
+	assert(t, strategySpans[0].attributes["kafka.retries"], 1)
+
+	retries := tracer.spansNamed(SpanRetry)
+	assert(t, len(retries), 1)
+	assert(t, retries[0].parent == strategySpans[0], true)
+	assert(t, retries[0].ended, true)
+	assert(t, retries[0].err, nil)
+
+	tasks := tracer.spansNamed(SpanTask)
+	assert(t, len(tasks), 10)
+	for _, span := range tasks {
+		assert(t, span.ended, true)
+	}
+	if len(tracer.spansNamed(SpanFetch)) == 0 {
+		t.Error("Expected fetches to be traced")
+	}
+	batches := tracer.spansNamed(SpanBatch)
+	if len(batches) == 0 || !batches[0].ended || batches[0].attributes["kafka.messages"] != 10 {
+		t.Errorf("Expected an ended batch span of 10 messages, got %v", batches)
+	}
+	commits := tracer.spansNamed(SpanCommit)
+	if len(commits) == 0 || commits[len(commits)-1].attributes["kafka.offset"] != int64(9) {
+		t.Errorf("Expected offset 9 to be committed in a traced commit")
+	}
+}
@@ -327,6 +327,17 @@ func setIntConfig(where *int, what string) error {
 	return nil
 }
 
+func setFloat64Config(where *float64, what string) error {
+	if what != "" {
+		value, err := strconv.ParseFloat(what, 64)
+		if err == nil {
+			*where = value
+		}
+		return err
+	}
+	return nil
+}
+
 func setInt32Config(where *int32, what string) error {
 	if what != "" {
 		value, err := strconv.Atoi(what)
@@ -24,6 +24,7 @@ import (
 	"os/exec"
 	"reflect"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 )
@@ -197,7 +198,12 @@ func produceNToTopicPartition(t *testing.T, n int, topic string, partition int,
 }
 
 func produce(t *testing.T, messages []string, topic string, brokerAddr string, compression sarama.CompressionCodec) {
+	produceWithVersion(t, messages, topic, brokerAddr, compression, sarama.V0_8_2_0)
+}
+
+func produceWithVersion(t *testing.T, messages []string, topic string, brokerAddr string, compression sarama.CompressionCodec, version sarama.KafkaVersion) {
 	clientConfig := sarama.NewConfig()
+	clientConfig.Version = version
 	clientConfig.Producer.Compression = compression
 	clientConfig.Producer.Timeout = 10 * time.Second
 	client, err := sarama.NewClient([]string{brokerAddr}, clientConfig)
@@ -291,3 +297,203 @@ func EnsureHasLeader(zkConnect string, topic string) {
 	}
 	time.Sleep(time.Duration(numPartitions) * time.Second)
 }
+
+// inMemoryCoordinator is a ConsumerCoordinator and OffsetStorage that keeps everything in memory.
+// It is enough to run a Consumer with static partitions without ZooKeeper.
+type inMemoryCoordinator struct {
+	topics  map[string][]int32
+	offsets map[string]map[TopicAndPartition]int64
+	lock    sync.Mutex
+}
+
+func newInMemoryCoordinator(topics map[string][]int32) *inMemoryCoordinator {
+	return &inMemoryCoordinator{
+		topics:  topics,
+		offsets: make(map[string]map[TopicAndPartition]int64),
+	}
+}
+
+func (this *inMemoryCoordinator) Connect() error { return nil }
+func (this *inMemoryCoordinator) Disconnect()    {}
+func (this *inMemoryCoordinator) RegisterConsumer(consumerid string, group string, topicCount TopicsToNumStreams) error {
+	return nil
+}
+func (this *inMemoryCoordinator) DeregisterConsumer(consumerid string, group string) error {
+	return nil
+}
+func (this *inMemoryCoordinator) GetConsumerInfo(consumerid string, group string) (*ConsumerInfo, error) {
+	return nil, fmt.Errorf("Consumer %s does not exist", consumerid)
+}
+func (this *inMemoryCoordinator) GetConsumersPerTopic(group string, excludeInternalTopics bool) (map[string][]ConsumerThreadId, error) {
+	return make(map[string][]ConsumerThreadId), nil
+}
+func (this *inMemoryCoordinator) GetConsumersInGroup(group string) ([]string, error) {
+	return []string{}, nil
+}
+func (this *inMemoryCoordinator) GetAllTopics() ([]string, error) {
+	topics := make([]string, 0, len(this.topics))
+	for topic := range this.topics {
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
+func (this *inMemoryCoordinator) GetPartitionsForTopics(topics []string) (map[string][]int32, error) {
+	partitions := make(map[string][]int32)
+	for _, topic := range topics {
+		partitions[topic] = this.topics[topic]
+	}
+	return partitions, nil
+}
+func (this *inMemoryCoordinator) GetAllBrokers() ([]*BrokerInfo, error) {
+	return []*BrokerInfo{&BrokerInfo{Id: 0, Host: "localhost", Port: 9092}}, nil
+}
+func (this *inMemoryCoordinator) SubscribeForChanges(group string) (<-chan CoordinatorEvent, error) {
+	return make(chan CoordinatorEvent), nil
+}
+func (this *inMemoryCoordinator) RequestBlueGreenDeployment(blue BlueGreenDeployment, green BlueGreenDeployment) error {
+	return nil
+}
+func (this *inMemoryCoordinator) GetBlueGreenRequest(group string) (map[string]*BlueGreenDeployment, error) {
+	return make(map[string]*BlueGreenDeployment), nil
+}
+func (this *inMemoryCoordinator) AwaitOnStateBarrier(consumerId string, group string, stateHash string, barrierSize int, api string, timeout time.Duration) bool {
+	return true
+}
+func (this *inMemoryCoordinator) RemoveStateBarrier(group string, stateHash string, api string) error {
+	return nil
+}
+func (this *inMemoryCoordinator) Unsubscribe() {}
+func (this *inMemoryCoordinator) ClaimPartitionOwnership(group string, topic string, partition int32, consumerThreadId ConsumerThreadId) (bool, error) {
+	return true, nil
+}
+func (this *inMemoryCoordinator) ReleasePartitionOwnership(group string, topic string, partition int32) error {
+	return nil
+}
+func (this *inMemoryCoordinator) RemoveOldApiRequests(group string) error { return nil }
+
+func (this *inMemoryCoordinator) GetOffset(group string, topic string, partition int32) (int64, error) {
+	offset := InvalidOffset
+	inLock(&this.lock, func() {
+		if committed, exists := this.offsets[group][TopicAndPartition{topic, partition}]; exists {
+			offset = committed
+		}
+	})
+	return offset, nil
+}
+
+func (this *inMemoryCoordinator) CommitOffset(group string, topic string, partition int32, offset int64) error {
+	inLock(&this.lock, func() {
+		if _, exists := this.offsets[group]; !exists {
+			this.offsets[group] = make(map[TopicAndPartition]int64)
+		}
+		this.offsets[group][TopicAndPartition{topic, partition}] = offset
+	})
+	return nil
+}
+
+// inMemoryConsumerConfig creates a ConsumerConfig that consumes from a given LowLevelClient using an inMemoryCoordinator.
+func inMemoryConsumerConfig(client LowLevelClient, topics map[string][]int32) *ConsumerConfig {
+	coordinator := newInMemoryCoordinator(topics)
+
+	config := DefaultConsumerConfig()
+	config.AutoOffsetReset = SmallestOffset
+	config.Coordinator = coordinator
+	config.OffsetStorage = coordinator
+	config.LowLevelClient = client
+	config.DeploymentTimeout = 0
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision {
+		return CommitOffsetAndContinue
+	}
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision {
+		return CommitOffsetAndContinue
+	}
+	return config
+}
+
+// inMemoryBatchOffsetStorage is a BatchOffsetStorage keeping offsets of a single group in memory and counting requests.
+type inMemoryBatchOffsetStorage struct {
+	offsets        map[TopicAndPartition]OffsetAndMetadata
+	getRequests    int
+	commitRequests int
+	lock           sync.Mutex
+}
+
+func newInMemoryBatchOffsetStorage() *inMemoryBatchOffsetStorage {
+	return &inMemoryBatchOffsetStorage{
+		offsets: make(map[TopicAndPartition]OffsetAndMetadata),
+	}
+}
+
+func (this *inMemoryBatchOffsetStorage) GetOffset(group string, topic string, partition int32) (int64, error) {
+	offsets, err := this.GetOffsets(group, []*TopicAndPartition{&TopicAndPartition{topic, partition}})
+	return offsets[TopicAndPartition{topic, partition}].Offset, err
+}
+
+func (this *inMemoryBatchOffsetStorage) CommitOffset(group string, topic string, partition int32, offset int64) error {
+	return this.CommitOffsets(group, map[TopicAndPartition]OffsetAndMetadata{TopicAndPartition{topic, partition}: OffsetAndMetadata{Offset: offset}})
+}
+
+func (this *inMemoryBatchOffsetStorage) GetOffsets(group string, topicPartitions []*TopicAndPartition) (map[TopicAndPartition]OffsetAndMetadata, error) {
+	offsets := make(map[TopicAndPartition]OffsetAndMetadata)
+	inLock(&this.lock, func() {
+		this.getRequests++
+		for _, topicPartition := range topicPartitions {
+			offset, exists := this.offsets[*topicPartition]
+			if !exists {
+				offset = OffsetAndMetadata{Offset: InvalidOffset}
+			}
+			offsets[*topicPartition] = offset
+		}
+	})
+	return offsets, nil
+}
+
+func (this *inMemoryBatchOffsetStorage) CommitOffsets(group string, offsets map[TopicAndPartition]OffsetAndMetadata) error {
+	inLock(&this.lock, func() {
+		this.commitRequests++
+		for topicPartition, offset := range offsets {
+			this.offsets[topicPartition] = offset
+		}
+	})
+	return nil
+}
+
+// inMemoryTransactionalOffsetStorage is a TransactionalOffsetStorage keeping offsets and results of a single group in memory.
+// Commits fail with err if it is set.
+type inMemoryTransactionalOffsetStorage struct {
+	offsets map[TopicAndPartition]int64
+	results []WorkerResult
+	commits int
+	err     error
+	lock    sync.Mutex
+}
+
+func newInMemoryTransactionalOffsetStorage() *inMemoryTransactionalOffsetStorage {
+	return &inMemoryTransactionalOffsetStorage{
+		offsets: make(map[TopicAndPartition]int64),
+	}
+}
+
+func (this *inMemoryTransactionalOffsetStorage) GetOffset(group string, topic string, partition int32) (int64, error) {
+	offset := InvalidOffset
+	inLock(&this.lock, func() {
+		if stored, exists := this.offsets[TopicAndPartition{topic, partition}]; exists {
+			offset = stored
+		}
+	})
+	return offset, nil
+}
+
+func (this *inMemoryTransactionalOffsetStorage) CommitBatch(group string, topicPartition TopicAndPartition, offset int64, results []WorkerResult) error {
+	var err error
+	inLock(&this.lock, func() {
+		if this.err != nil {
+			err = this.err
+			return
+		}
+		this.commits++
+		this.offsets[topicPartition] = offset
+		this.results = append(this.results, results...)
+	})
+	return err
+}
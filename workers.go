@@ -16,6 +16,7 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sync"
@@ -31,7 +32,9 @@ type WorkerManager struct {
 	workers             []*Worker
 	availableWorkers    chan *Worker
 	currentBatch        *taskBatch
+	batchLock           sync.RWMutex
 	batchOrder          []TaskId
+	batchResults        map[TaskId]WorkerResult
 	inputChannel        chan []*Message
 	topicPartition      TopicAndPartition
 	largestOffset       int64
@@ -42,17 +45,33 @@ type WorkerManager struct {
 	managerStop         chan bool
 	processingStop      chan bool
 	commitStop          chan bool
+	commitStopped       chan bool
 	closeConsumer       chan bool
 	shutdownDecision    *FailedDecision
-
-	metrics *ConsumerMetrics
+	rateLimiters        []*RateLimiter
+	pool                *workerPool
+	breaker             *circuitBreaker
+	breakerEvents       chan func()
+	stopping            chan struct{}
+	stoppingOnce        sync.Once
+
+	// Whether a batch is being worked on, and the time in nanoseconds the last batch was taken or finished. Accessed atomically.
+	batchActive  int32
+	batchChanged int64
+
+	metrics          *ConsumerMetrics
+	partitionMetrics *partitionMetrics
 }
 
 // Creates a new WorkerManager with given id using a given ConsumerConfig and responsible for managing given TopicAndPartition.
 func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAndPartition, metrics *ConsumerMetrics, closeConsumer chan bool) *WorkerManager {
-	workers := make([]*Worker, config.NumWorkers)
-	availableWorkers := make(chan *Worker, config.NumWorkers)
-	for i := 0; i < config.NumWorkers; i++ {
+	numWorkers := config.NumWorkers
+	if config.AdaptiveWorkers {
+		numWorkers = config.MaxWorkers
+	}
+	workers := make([]*Worker, numWorkers)
+	availableWorkers := make(chan *Worker, numWorkers)
+	for i := 0; i < numWorkers; i++ {
 		workers[i] = &Worker{
 			InputChannel:         make(chan *TaskAndStrategy),
 			OutputChannel:        make(chan WorkerResult),
@@ -61,7 +80,27 @@ func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAnd
 			TaskTimeout:          config.WorkerTaskTimeout,
 		}
 		workers[i].Start()
-		availableWorkers <- workers[i]
+		if i < config.NumWorkers {
+			availableWorkers <- workers[i]
+		}
+	}
+	var pool *workerPool
+	if config.AdaptiveWorkers {
+		pool = newWorkerPool(config, workers[config.NumWorkers:], time.Now())
+	}
+	var breaker *circuitBreaker
+	if config.CircuitBreakerThreshold > 0 {
+		breaker = newCircuitBreaker(config.CircuitBreakerThreshold)
+	}
+	partitionMetrics := metrics.partition(topicPartition)
+	partitionMetrics.workers().Update(int64(config.NumWorkers))
+
+	rateLimiters := make([]*RateLimiter, 0)
+	if config.RateLimiter != nil {
+		rateLimiters = append(rateLimiters, config.RateLimiter)
+	}
+	if limiter, exists := config.TopicRateLimiters[topicPartition.Topic]; exists && limiter != nil {
+		rateLimiters = append(rateLimiters, limiter)
 	}
 
 	return &WorkerManager{
@@ -72,6 +111,7 @@ func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAnd
 		inputChannel:        make(chan []*Message),
 		currentBatch:        newTaskBatch(),
 		batchOrder:          make([]TaskId, 0),
+		batchResults:        make(map[TaskId]WorkerResult),
 		topicPartition:      topicPartition,
 		largestOffset:       InvalidOffset,
 		lastCommittedOffset: InvalidOffset,
@@ -80,8 +120,15 @@ func NewWorkerManager(id string, config *ConsumerConfig, topicPartition TopicAnd
 		managerStop:         make(chan bool),
 		processingStop:      make(chan bool),
 		commitStop:          make(chan bool),
+		commitStopped:       make(chan bool),
 		metrics:             metrics,
+		partitionMetrics:    partitionMetrics,
 		closeConsumer:       closeConsumer,
+		rateLimiters:        rateLimiters,
+		pool:                pool,
+		breaker:             breaker,
+		breakerEvents:       make(chan func(), 1),
+		stopping:            make(chan struct{}),
 	}
 }
 
@@ -89,6 +136,16 @@ func (wm *WorkerManager) String() string {
 	return wm.id
 }
 
+// Returns the consumer id, group and topic-partition of this WorkerManager as log fields.
+func (wm *WorkerManager) LogFields() Fields {
+	return Fields{
+		"consumer":  wm.config.Consumerid,
+		"group":     wm.config.Groupid,
+		"topic":     wm.topicPartition.Topic,
+		"partition": wm.topicPartition.Partition,
+	}
+}
+
 // Starts processing incoming batches with this WorkerManager. Processing is possible only in batch-at-once mode.
 // It also launches an offset committer routine.
 // Call to this method blocks.
@@ -109,9 +166,11 @@ func (wm *WorkerManager) Start() {
 					if Logger.IsAllowed(TraceLevel) {
 						Trace(wm, "WorkerManager got batch")
 					}
+					wm.setBatchActive(true)
 					wm.metrics.wMsBatchDuration().Time(func() {
 						wm.startBatch(batch)
 					})
+					wm.setBatchActive(false)
 					if Logger.IsAllowed(TraceLevel) {
 						Trace(wm, "WorkerManager got batch processed")
 					}
@@ -124,11 +183,13 @@ func (wm *WorkerManager) Start() {
 }
 
 // Tells this WorkerManager to finish processing current batch, stop accepting new work and shut down.
+// Rate limits no longer apply to the rest of the current batch, and messages held by an open circuit breaker are given up without committing their offsets.
 // This method returns immediately and returns a channel which will get the value once the shut down is finished.
 func (wm *WorkerManager) Stop() chan bool {
 	finished := make(chan bool)
+	wm.stoppingOnce.Do(func() { close(wm.stopping) })
 	go func() {
-		Debugf(wm, "Trying to stop workerManager")
+		Debug(wm, "Trying to stop workerManager")
 		inLock(&wm.stopLock, func() {
 			Debug(wm, "Stopping manager")
 			wm.managerStop <- true
@@ -137,6 +198,7 @@ func (wm *WorkerManager) Stop() chan bool {
 			Debug(wm, "Successful manager stop")
 			Debug(wm, "Stopping committer")
 			wm.commitStop <- true
+			<-wm.commitStopped
 			Debug(wm, "Successful committer stop")
 			wm.failCounter.Close()
 			Debug(wm, "Stopped failure counter")
@@ -149,30 +211,63 @@ func (wm *WorkerManager) Stop() chan bool {
 			}
 			Debug(wm, "Stopped all workers")
 		})
-		Debugf(wm, "Stopped workerManager")
+		Debug(wm, "Stopped workerManager")
 	}()
 
 	return finished
 }
 
+func (wm *WorkerManager) setBatchActive(active bool) {
+	var value int32
+	if active {
+		value = 1
+	}
+	atomic.StoreInt64(&wm.batchChanged, time.Now().UnixNano())
+	atomic.StoreInt32(&wm.batchActive, value)
+}
+
+// batchActivity returns whether this WorkerManager is working on a batch, which includes waiting for rate limits,
+// MinMessageAge or a closed circuit breaker, and the time it last took or finished a batch.
+func (wm *WorkerManager) batchActivity() (bool, time.Time) {
+	var changed time.Time
+	if nanos := atomic.LoadInt64(&wm.batchChanged); nanos > 0 {
+		changed = time.Unix(0, nanos)
+	}
+	return atomic.LoadInt32(&wm.batchActive) == 1, changed
+}
+
 func (wm *WorkerManager) startBatch(batch []*Message) {
 	inLock(&wm.stopLock, func() {
-		wm.currentBatch = newTaskBatch()
-		wm.batchOrder = make([]TaskId, 0)
-		for _, message := range batch {
-			topicPartition := TopicAndPartition{message.Topic, message.Partition}
-			id := TaskId{topicPartition, message.Offset}
-			wm.batchOrder = append(wm.batchOrder, id)
-			wm.currentBatch.add(id, &Task{Msg: message})
+		if !wm.waitForMessageAge(batch) {
+			Infow(wm, "Giving up batch held for MinMessageAge on stop", Fields{"offset": batch[0].Offset, "messages": len(batch)})
+			return
 		}
+		inWriteLock(&wm.batchLock, func() {
+			wm.currentBatch = newTaskBatch()
+			wm.batchOrder = make([]TaskId, 0)
+			wm.batchResults = make(map[TaskId]WorkerResult)
+			for _, message := range batch {
+				topicPartition := TopicAndPartition{message.Topic, message.Partition}
+				id := TaskId{topicPartition, message.Offset}
+				wm.batchOrder = append(wm.batchOrder, id)
+				wm.currentBatch.add(id, &Task{Msg: message})
+			}
+		})
 		wm.metrics.pendingWMsTasks().Inc(int64(wm.currentBatch.numOutstanding()))
+		wm.partitionMetrics.consumed(batch)
 		for _, id := range wm.batchOrder {
 			task := wm.currentBatch.get(id)
+			if wm.breaker != nil {
+				wm.breaker.waitClosed(wm.stopping)
+			}
+			wm.waitForRateLimit(task.Msg)
 			worker := <-wm.availableWorkers
 
 			if wm.shutdownDecision == nil {
 				wm.metrics.activeWorkers().Inc(1)
 				wm.metrics.pendingWMsTasks().Dec(1)
+				task.started = time.Now()
+				wm.startTaskSpan(task)
 				worker.InputChannel <- &TaskAndStrategy{task, wm.config.Strategy}
 			} else {
 				return
@@ -183,6 +278,49 @@ func (wm *WorkerManager) startBatch(batch []*Message) {
 	})
 }
 
+// waitForRateLimit waits until all rate limiters of this WorkerManager allow dispatching a given message.
+// Rate limits are lifted once this WorkerManager is stopping so that the current batch can finish.
+func (wm *WorkerManager) waitForRateLimit(message *Message) {
+	if len(wm.rateLimiters) == 0 {
+		return
+	}
+	wm.metrics.rateLimitWait().Time(func() {
+		for _, limiter := range wm.rateLimiters {
+			if !limiter.Wait(len(message.Key)+len(message.Value), wm.stopping) {
+				return
+			}
+		}
+	})
+}
+
+// waitForMessageAge holds a given batch until all of its messages are at least MinMessageAge old, but no longer than MinMessageAge.
+// Returns false if this WorkerManager started stopping before that, in which case the batch must not be processed.
+func (wm *WorkerManager) waitForMessageAge(batch []*Message) bool {
+	if wm.config.MinMessageAge <= 0 {
+		return true
+	}
+	wait := batchReadyAt(batch, wm.config.MinMessageAge, wm.config.MessageAgeSource).Sub(time.Now())
+	if wait <= 0 {
+		return true
+	}
+	if wait > wm.config.MinMessageAge {
+		// timestamps in the future of messages without a fetch time must not hold the partition any longer
+		wait = wm.config.MinMessageAge
+	}
+	if Logger.IsAllowed(DebugLevel) {
+		Debugw(wm, "Holding batch until its messages reach MinMessageAge", Fields{"offset": batch[0].Offset, "wait": wait})
+	}
+	wm.metrics.messageAgeWait().Update(wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-wm.stopping:
+		return false
+	}
+}
+
 func (wm *WorkerManager) commitBatch() {
 	for {
 		timeout := time.NewTimer(wm.config.OffsetCommitInterval)
@@ -191,6 +329,8 @@ func (wm *WorkerManager) commitBatch() {
 			{
 				timeout.Stop()
 				wm.commitOffset()
+				wm.metrics.removePartition(wm.topicPartition)
+				wm.commitStopped <- true
 				return
 			}
 		case <-timeout.C:
@@ -202,33 +342,121 @@ func (wm *WorkerManager) commitBatch() {
 }
 
 func (wm *WorkerManager) commitOffset() {
+	// Offsets are committed along with the batch results in transactional mode.
+	if wm.config.TransactionalOffsetStorage != nil {
+		return
+	}
+
 	largestOffset := wm.GetLargestOffset()
+	if wm.breaker != nil {
+		if limit, unresolved := wm.breaker.commitLimit(); unresolved && limit < largestOffset {
+			if limit < 0 {
+				// the first message of the partition is not done yet
+				return
+			}
+			largestOffset = limit
+		}
+	}
 	if Logger.IsAllowed(TraceLevel) {
-		Tracef(wm, "Inside commit offset with largest %d and last %d", largestOffset, wm.lastCommittedOffset)
+		Tracew(wm, "Inside commit offset", Fields{"offset": largestOffset, "committed": wm.lastCommittedOffset})
 	}
 	if largestOffset <= wm.lastCommittedOffset || isOffsetInvalid(largestOffset) {
 		return
 	}
 
+	_, span := wm.config.Tracer.StartSpan(context.Background(), SpanCommit, partitionAttributes(wm.topicPartition, SpanAttribute{"kafka.offset", largestOffset})...)
+	defer span.End()
+
 	success := false
+	var lastErr error
 	for i := 0; i <= wm.config.OffsetsCommitMaxRetries; i++ {
-		err := wm.config.OffsetStorage.CommitOffset(wm.config.Groupid, wm.topicPartition.Topic, wm.topicPartition.Partition, largestOffset)
+		err := wm.storeOffset(largestOffset)
 		if err == nil {
 			success = true
 			if Logger.IsAllowed(TraceLevel) {
-				Tracef(wm, "Successfully committed offset %d for %s", largestOffset, wm.topicPartition)
+				Tracew(wm, "Successfully committed offset", Fields{"offset": largestOffset})
 			}
 			break
 		} else {
-			Debugf(wm, "Failed to commit offset %d for %s; error: %s. Retrying...", largestOffset, &wm.topicPartition, err)
+			Debugw(wm, "Failed to commit offset. Retrying...", Fields{"offset": largestOffset, "error": err})
+			lastErr = err
 		}
 	}
 
 	if !success {
-		Errorf(wm, "Failed to commit offset %d for %s after %d retries", largestOffset, &wm.topicPartition, wm.config.OffsetsCommitMaxRetries)
+		Errorw(wm, "Failed to commit offset", Fields{"offset": largestOffset, "retries": wm.config.OffsetsCommitMaxRetries})
+		span.RecordError(lastErr)
 		//TODO: what to do next?
 	} else {
-		wm.lastCommittedOffset = largestOffset
+		atomic.StoreInt64(&wm.lastCommittedOffset, largestOffset)
+		wm.metrics.updateCommittedOffset(wm.topicPartition, largestOffset)
+	}
+}
+
+// storeOffset commits a given offset to the configured OffsetStorage. If it is a BatchOffsetStorage the consumer id is stored as offset metadata.
+func (wm *WorkerManager) storeOffset(offset int64) error {
+	if storage, ok := wm.config.OffsetStorage.(BatchOffsetStorage); ok {
+		return storage.CommitOffsets(wm.config.Groupid, map[TopicAndPartition]OffsetAndMetadata{
+			wm.topicPartition: OffsetAndMetadata{Offset: offset, Metadata: wm.config.Consumerid},
+		})
+	}
+
+	return wm.config.OffsetStorage.CommitOffset(wm.config.Groupid, wm.topicPartition.Topic, wm.topicPartition.Partition, offset)
+}
+
+// commitBatchResults hands the results of the current batch to the configured TransactionalOffsetStorage.
+// If the batch fails to commit after OffsetsCommitMaxRetries retries the consumer is stopped, so the batch is processed again after restart.
+func (wm *WorkerManager) commitBatchResults() {
+	storage := wm.config.TransactionalOffsetStorage
+	if storage == nil || len(wm.batchResults) == 0 {
+		return
+	}
+	if wm.shutdownDecision != nil && *wm.shutdownDecision == DoNotCommitOffsetAndStop {
+		return
+	}
+	if wm.breaker != nil && wm.breaker.isReleased() {
+		return
+	}
+
+	results := make([]WorkerResult, 0, len(wm.batchResults))
+	offset := InvalidOffset
+	for _, id := range wm.batchOrder {
+		if result, exists := wm.batchResults[id]; exists {
+			results = append(results, result)
+			if id.Offset > offset {
+				offset = id.Offset
+			}
+		}
+	}
+
+	_, span := wm.config.Tracer.StartSpan(context.Background(), SpanCommit,
+		partitionAttributes(wm.topicPartition, SpanAttribute{"kafka.offset", offset}, SpanAttribute{"kafka.results", len(results)})...)
+	defer span.End()
+
+	success := false
+	var lastErr error
+	for i := 0; i <= wm.config.OffsetsCommitMaxRetries; i++ {
+		err := storage.CommitBatch(wm.config.Groupid, wm.topicPartition, offset, results)
+		if err == nil {
+			success = true
+			if Logger.IsAllowed(TraceLevel) {
+				Tracew(wm, "Successfully committed batch", Fields{"offset": offset, "results": len(results)})
+			}
+			break
+		} else {
+			Debugw(wm, "Failed to commit batch. Retrying...", Fields{"offset": offset, "error": err})
+			lastErr = err
+		}
+	}
+
+	if !success {
+		Errorw(wm, "Failed to commit batch, stopping consumer", Fields{"offset": offset, "retries": wm.config.OffsetsCommitMaxRetries})
+		span.RecordError(lastErr)
+		decision := DoNotCommitOffsetAndStop
+		wm.triggerShutdownIfRequired(&decision)
+	} else {
+		atomic.StoreInt64(&wm.lastCommittedOffset, offset)
+		wm.metrics.updateCommittedOffset(wm.topicPartition, offset)
 	}
 }
 
@@ -238,7 +466,7 @@ func (wm *WorkerManager) IsBatchProcessed() bool {
 }
 
 func (wm *WorkerManager) processBatch() {
-	outputChannels := make([]*chan WorkerResult, wm.config.NumWorkers)
+	outputChannels := make([]*chan WorkerResult, len(wm.workers))
 	for i, worker := range wm.workers {
 		outputChannels[i] = &worker.OutputChannel
 	}
@@ -252,6 +480,10 @@ func (wm *WorkerManager) processBatch() {
 				go func() {
 					stopRedirecting <- true
 				}()
+				wm.endRetrySpan(result)
+				if wm.pool != nil {
+					wm.pool.attempted(result.Success())
+				}
 
 				if wm.shutdownDecision != nil && *wm.shutdownDecision == DoNotCommitOffsetAndStop {
 					wm.taskIsDone(result)
@@ -260,6 +492,7 @@ func (wm *WorkerManager) processBatch() {
 
 				if result.Success() {
 					wm.taskSucceeded(result)
+					wm.circuitSucceeded(result)
 				} else {
 					task := wm.currentBatch.get(result.Id())
 					if _, ok := result.(*TimedOutResult); ok {
@@ -267,10 +500,13 @@ func (wm *WorkerManager) processBatch() {
 						task.Callee.OutputChannel = make(chan WorkerResult)
 					}
 
-					Debugf(wm, "Worker task %s has failed", result.Id())
-					task.Retries++
+					Debugw(wm, "Worker task has failed", Fields{"offset": result.Id().Offset})
+					inWriteLock(&wm.batchLock, func() { task.Retries++ })
 					if task.Retries > wm.config.MaxWorkerRetries {
-						Errorf(wm, "Worker task %s has failed after %d retries", result.Id(), wm.config.MaxWorkerRetries)
+						Errorw(wm, "Worker task has failed", Fields{"offset": result.Id().Offset, "retries": wm.config.MaxWorkerRetries})
+						if wm.circuitFailed(task) {
+							continue
+						}
 
 						var decision FailedDecision
 						if wm.failCounter.Failed() {
@@ -278,6 +514,7 @@ func (wm *WorkerManager) processBatch() {
 						} else {
 							decision = wm.config.WorkerFailedAttemptCallback(task, result)
 						}
+						wm.partitionMetrics.failedDecision(decision).Inc(1)
 						switch decision {
 						case CommitOffsetAndContinue:
 							{
@@ -301,23 +538,22 @@ func (wm *WorkerManager) processBatch() {
 							}
 						}
 					} else {
-						Debugf(wm, "Retrying worker task %s %dth time", result.Id(), task.Retries)
+						Debugw(wm, "Retrying worker task", Fields{"offset": result.Id().Offset, "retry": task.Retries})
+						wm.partitionMetrics.taskRetries().Inc(1)
 						time.Sleep(wm.config.WorkerBackoff)
-						go func() {
-							task.Callee.InputChannel <- &TaskAndStrategy{task, wm.config.Strategy}
-						}()
+						wm.retryTask(task)
 					}
 				}
 
-				if wm.IsBatchProcessed() {
-					if Logger.IsAllowed(TraceLevel) {
-						Trace(wm, "Sending batch processed")
-					}
-					wm.batchProcessed <- true
-					if Logger.IsAllowed(TraceLevel) {
-						Trace(wm, "Received batch processed")
-					}
-				}
+				wm.finishBatchIfProcessed()
+			}
+		case event := <-wm.breakerEvents:
+			{
+				go func() {
+					stopRedirecting <- true
+				}()
+				event()
+				wm.finishBatchIfProcessed()
 			}
 		case <-wm.processingStop:
 			{
@@ -331,6 +567,109 @@ func (wm *WorkerManager) processBatch() {
 	}
 }
 
+// finishBatchIfProcessed commits the results of the current batch and lets the next batch start if all its tasks are done.
+func (wm *WorkerManager) finishBatchIfProcessed() {
+	if !wm.IsBatchProcessed() {
+		return
+	}
+
+	wm.metrics.updateProcessedOffset(wm.topicPartition, wm.GetLargestOffset())
+	wm.commitBatchResults()
+	if Logger.IsAllowed(TraceLevel) {
+		Trace(wm, "Sending batch processed")
+	}
+	wm.batchProcessed <- true
+	if Logger.IsAllowed(TraceLevel) {
+		Trace(wm, "Received batch processed")
+	}
+}
+
+// retryTask hands a given task to its worker again.
+func (wm *WorkerManager) retryTask(task *Task) {
+	wm.startRetrySpan(task)
+	go func() {
+		task.Callee.InputChannel <- &TaskAndStrategy{task, wm.config.Strategy}
+	}()
+}
+
+// circuitSucceeded records a successful task with the circuit breaker. If the task was a probe, consumption resumes and the other held tasks are retried.
+func (wm *WorkerManager) circuitSucceeded(result WorkerResult) {
+	if wm.breaker == nil {
+		return
+	}
+
+	closed, retry := wm.breaker.succeeded(wm.currentBatch.get(result.Id()))
+	if !closed {
+		return
+	}
+	Infow(wm, "Circuit breaker closed, resuming consumption", Fields{"offset": result.Id().Offset, "held": len(retry)})
+	wm.circuitStateChanged(CircuitClosed)
+	for _, task := range retry {
+		inWriteLock(&wm.batchLock, func() { task.Retries = 0 })
+		wm.retryTask(task)
+	}
+}
+
+// circuitFailed records a task that failed after all retries with the circuit breaker. Returns true if the task is held by the circuit breaker.
+func (wm *WorkerManager) circuitFailed(task *Task) bool {
+	if wm.breaker == nil {
+		return false
+	}
+
+	held, opened := wm.breaker.failed(task)
+	if opened {
+		Warnw(wm, "Circuit breaker opened, pausing consumption", Fields{"offset": task.Msg.Offset, "cooldown": wm.config.CircuitBreakerCooldown})
+		wm.partitionMetrics.circuitOpens().Inc(1)
+		wm.circuitStateChanged(CircuitOpen)
+		// breakerEvents holds a single event, so the cooldown does not block once processing stopped.
+		// A circuit reopens only after the event of its last cooldown is processed.
+		go func() {
+			timer := time.NewTimer(wm.config.CircuitBreakerCooldown)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				wm.breakerEvents <- wm.probeCircuit
+			case <-wm.stopping:
+				wm.breakerEvents <- wm.releaseCircuit
+			}
+		}()
+	}
+	return held
+}
+
+// probeCircuit retries the first held task once to find out whether consumption may resume.
+func (wm *WorkerManager) probeCircuit() {
+	probe := wm.breaker.halfOpen()
+	if probe == nil {
+		return
+	}
+	Infow(wm, "Circuit breaker half-open, retrying probe message", Fields{"offset": probe.Msg.Offset})
+	wm.circuitStateChanged(CircuitHalfOpen)
+	// a single failure of the probe opens the circuit again
+	inWriteLock(&wm.batchLock, func() { probe.Retries = wm.config.MaxWorkerRetries })
+	wm.retryTask(probe)
+}
+
+// releaseCircuit gives up the held tasks when this WorkerManager stops. Their offsets are never committed.
+func (wm *WorkerManager) releaseCircuit() {
+	held := wm.breaker.release()
+	if len(held) == 0 {
+		return
+	}
+	Warnw(wm, "Giving up messages held by circuit breaker", Fields{"offset": held[0].Msg.Offset, "held": len(held)})
+	wm.circuitStateChanged(CircuitClosed)
+	for _, task := range held {
+		wm.taskIsDone(NewProcessingFailedResult(task.Id()))
+	}
+}
+
+func (wm *WorkerManager) circuitStateChanged(state CircuitState) {
+	wm.partitionMetrics.circuitState().Update(int64(state))
+	if wm.config.CircuitBreakerCallback != nil {
+		wm.config.CircuitBreakerCallback(wm, state)
+	}
+}
+
 func (wm *WorkerManager) triggerShutdownIfRequired(decision *FailedDecision) {
 	if wm.shutdownDecision == nil {
 		wm.shutdownDecision = decision
@@ -342,16 +681,98 @@ func (wm *WorkerManager) triggerShutdownIfRequired(decision *FailedDecision) {
 
 func (wm *WorkerManager) taskSucceeded(result WorkerResult) {
 	if Logger.IsAllowed(TraceLevel) {
-		Tracef(wm, "Task is done: %d", result.Id().Offset)
+		Tracew(wm, "Task is done", Fields{"offset": result.Id().Offset})
 	}
 	wm.UpdateLargestOffset(result.Id().Offset)
+	wm.batchResults[result.Id()] = result
 	wm.taskIsDone(result)
 	wm.metrics.activeWorkers().Dec(1)
 }
 
 func (wm *WorkerManager) taskIsDone(result WorkerResult) {
-	wm.availableWorkers <- wm.currentBatch.get(result.Id()).Callee
-	wm.currentBatch.markDone(result.Id())
+	task := wm.currentBatch.get(result.Id())
+	wm.partitionMetrics.taskDuration().UpdateSince(task.started)
+	if task.span != nil {
+		task.span.SetAttributes(SpanAttribute{"kafka.retries", task.Retries})
+		if !result.Success() {
+			task.span.RecordError(fmt.Errorf("Task %s failed after %d retries", result.Id(), task.Retries))
+		}
+		task.span.End()
+	}
+	inWriteLock(&wm.batchLock, func() { wm.currentBatch.markDone(result.Id()) })
+	if wm.breaker != nil {
+		wm.breaker.resolved(task)
+	}
+	wm.releaseWorker(task)
+}
+
+// releaseWorker makes the worker of a given done task available for new tasks, unless it is parked to shrink an adaptive worker pool.
+func (wm *WorkerManager) releaseWorker(task *Task) {
+	if wm.pool == nil {
+		wm.availableWorkers <- task.Callee
+		return
+	}
+
+	if !wm.pool.release(task.Callee, time.Since(task.started)) {
+		wm.availableWorkers <- task.Callee
+	}
+	var queued int
+	inReadLock(&wm.batchLock, func() { queued = wm.currentBatch.numOutstanding() })
+	queued -= wm.pool.size - len(wm.availableWorkers)
+	for _, worker := range wm.pool.adjust(time.Now(), queued) {
+		wm.availableWorkers <- worker
+	}
+	wm.partitionMetrics.workers().Update(int64(wm.pool.size))
+}
+
+// startTaskSpan starts the span of a given task as a child of the trace context propagated in its message headers.
+// The message context holds the span, so the strategy can continue the trace. It is set once before the task is handed to a worker,
+// as a timed out worker may still be reading it while the task is retried.
+func (wm *WorkerManager) startTaskSpan(task *Task) {
+	parent := wm.config.Tracer.Extract(context.Background(), task.Msg.Headers)
+	task.ctx, task.span = wm.config.Tracer.StartSpan(parent, SpanTask, partitionAttributes(wm.topicPartition, SpanAttribute{"kafka.offset", task.Msg.Offset})...)
+	task.Msg.ctx = task.ctx
+}
+
+// startRetrySpan starts the span of the next retry of a given task as a child of the task span.
+func (wm *WorkerManager) startRetrySpan(task *Task) {
+	_, task.retrySpan = wm.config.Tracer.StartSpan(task.ctx, SpanRetry,
+		partitionAttributes(wm.topicPartition, SpanAttribute{"kafka.offset", task.Msg.Offset}, SpanAttribute{"kafka.retry", task.Retries})...)
+}
+
+// endRetrySpan ends the span of the retry a given result belongs to, if any.
+func (wm *WorkerManager) endRetrySpan(result WorkerResult) {
+	task := wm.currentBatch.get(result.Id())
+	if task == nil || task.retrySpan == nil {
+		return
+	}
+	if !result.Success() {
+		task.retrySpan.RecordError(fmt.Errorf("Task %s failed", result.Id()))
+	}
+	task.retrySpan.End()
+	task.retrySpan = nil
+}
+
+// Gets the last offset committed by this WorkerManager, or InvalidOffset if nothing has been committed yet.
+func (wm *WorkerManager) GetLastCommittedOffset() int64 {
+	return atomic.LoadInt64(&wm.lastCommittedOffset)
+}
+
+// Gets the state of the batch this WorkerManager is currently processing.
+func (wm *WorkerManager) BatchState() *BatchState {
+	state := &BatchState{Tasks: make([]*TaskState, 0)}
+	inReadLock(&wm.batchLock, func() {
+		state.Outstanding = wm.currentBatch.numOutstanding()
+		for _, id := range wm.batchOrder {
+			task := wm.currentBatch.get(id)
+			state.Tasks = append(state.Tasks, &TaskState{
+				Offset:  id.Offset,
+				Retries: task.Retries,
+				Done:    wm.currentBatch.isDone(id),
+			})
+		}
+	})
+	return state
 }
 
 // Gets the highest offset that has been processed by this WorkerManager.
@@ -491,6 +912,13 @@ func (f *FailureCounter) Failed() bool {
 	return f.count >= f.failedThreshold || f.failed
 }
 
+// Tells whether the threshold of failed messages has been reached.
+func (f *FailureCounter) ThresholdReached() bool {
+	reached := false
+	inLock(&f.countLock, func() { reached = f.count >= f.failedThreshold || f.failed })
+	return reached
+}
+
 // Stops this failure counter
 func (f *FailureCounter) Close() {
 	f.stop <- true
@@ -506,6 +934,11 @@ type Task struct {
 
 	// A worker that is responsible for processing this task.
 	Callee *Worker
+
+	started   time.Time
+	ctx       context.Context
+	span      Span
+	retrySpan Span
 }
 
 // Returns an id for this Task.
@@ -619,19 +1052,35 @@ const (
 	DoNotCommitOffsetAndStop
 )
 
+func (fd FailedDecision) String() string {
+	switch fd {
+	case CommitOffsetAndContinue:
+		return "CommitOffsetAndContinue"
+	case DoNotCommitOffsetAndContinue:
+		return "DoNotCommitOffsetAndContinue"
+	case CommitOffsetAndStop:
+		return "CommitOffsetAndStop"
+	case DoNotCommitOffsetAndStop:
+		return "DoNotCommitOffsetAndStop"
+	}
+	return fmt.Sprintf("FailedDecision(%d)", int32(fd))
+}
+
 // taskBatch represents a batch of tasks which must be processed by workers
 type taskBatch struct {
-	tasks  map[TaskId]*Task
-	nTasks *int64
-	nDone  *int64
+	tasks    map[TaskId]*Task
+	finished map[TaskId]bool
+	nTasks   *int64
+	nDone    *int64
 }
 
 func newTaskBatch() *taskBatch {
 	var t, d int64 = 0, 0
 	return &taskBatch{
-		tasks:  make(map[TaskId]*Task),
-		nTasks: &t,
-		nDone:  &d,
+		tasks:    make(map[TaskId]*Task),
+		finished: make(map[TaskId]bool),
+		nTasks:   &t,
+		nDone:    &d,
 	}
 }
 
@@ -645,9 +1094,14 @@ func (b *taskBatch) get(id TaskId) *Task {
 }
 
 func (b *taskBatch) markDone(id TaskId) {
+	b.finished[id] = true
 	atomic.AddInt64(b.nDone, 1)
 }
 
+func (b *taskBatch) isDone(id TaskId) bool {
+	return b.finished[id]
+}
+
 func (b *taskBatch) numOutstanding() int {
 	return int(atomic.LoadInt64(b.nTasks) - atomic.LoadInt64(b.nDone))
 }
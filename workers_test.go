@@ -16,8 +16,11 @@ limitations under the License. */
 package go_kafka_client
 
 import (
+	"errors"
 	"testing"
 	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
 )
 
 var goodStrategy = func(_ *Worker, _ *Message, id TaskId) WorkerResult { return NewSuccessfulResult(id) }
@@ -135,9 +138,9 @@ func TestWorkerManager(t *testing.T) {
 	config.OffsetStorage = mockZk
 	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
 
-	metrics := newConsumerMetrics(wmid, "")
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
 	closeConsumer := make(chan bool)
-	manager := NewWorkerManager(wmid, config, topicPartition, metrics, closeConsumer)
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, closeConsumer)
 
 	go manager.Start()
 
@@ -172,6 +175,116 @@ func TestWorkerManager(t *testing.T) {
 	}
 }
 
+func TestWorkerManagerCommitsToBatchOffsetStorage(t *testing.T) {
+	wmid := "test-batch-WM"
+	config := DefaultConsumerConfig()
+	config.Consumerid = "test-consumer"
+	config.Strategy = goodStrategy
+	storage := newInMemoryBatchOffsetStorage()
+	config.OffsetStorage = storage
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, make(chan bool))
+	go manager.Start()
+
+	manager.inputChannel <- []*Message{&Message{Offset: 0}, &Message{Offset: 1}, &Message{Offset: 2}}
+	time.Sleep(1 * time.Second)
+	<-manager.Stop()
+
+	assert(t, storage.commitRequests, 1)
+	assert(t, storage.offsets[topicPartition], OffsetAndMetadata{Offset: 2, Metadata: "test-consumer"})
+}
+
+func TestWorkerManagerCommitsBatchToTransactionalOffsetStorage(t *testing.T) {
+	wmid := "test-transactional-WM"
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	offsetStorage := newInMemoryBatchOffsetStorage()
+	config.OffsetStorage = offsetStorage
+	storage := newInMemoryTransactionalOffsetStorage()
+	config.TransactionalOffsetStorage = storage
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, make(chan bool))
+	go manager.Start()
+
+	manager.inputChannel <- []*Message{&Message{Offset: 0}, &Message{Offset: 1}, &Message{Offset: 2}}
+	manager.inputChannel <- []*Message{&Message{Offset: 3}, &Message{Offset: 4}}
+	time.Sleep(1 * time.Second)
+	<-manager.Stop()
+
+	assert(t, storage.commits, 2)
+	assert(t, storage.offsets[topicPartition], int64(4))
+	assert(t, len(storage.results), 5)
+	for i, result := range storage.results {
+		assert(t, result.Id().Offset, int64(i))
+	}
+	assert(t, offsetStorage.commitRequests, 0)
+}
+
+func TestWorkerManagerStopsConsumerIfBatchFailsToCommit(t *testing.T) {
+	wmid := "test-transactional-failure-WM"
+	config := DefaultConsumerConfig()
+	config.Strategy = goodStrategy
+	config.OffsetsCommitMaxRetries = 2
+	storage := newInMemoryTransactionalOffsetStorage()
+	storage.err = errors.New("transaction aborted")
+	config.TransactionalOffsetStorage = storage
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	closeConsumer := make(chan bool)
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, closeConsumer)
+	go manager.Start()
+
+	manager.inputChannel <- []*Message{&Message{Offset: 0}, &Message{Offset: 1}}
+	select {
+	case <-closeConsumer:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Consumer was not stopped after failing to commit a batch")
+	}
+	<-manager.Stop()
+
+	assert(t, *manager.shutdownDecision, DoNotCommitOffsetAndStop)
+	assert(t, storage.commits, 0)
+}
+
+func TestWorkerManagerTracksPartitionMetrics(t *testing.T) {
+	wmid := "test-partition-metrics-WM"
+	config := DefaultConsumerConfig()
+	config.Strategy = failStrategy
+	config.MaxWorkerRetries = 2
+	config.WorkerBackoff = 10 * time.Millisecond
+	config.WorkerFailureCallback = func(_ *WorkerManager) FailedDecision {
+		return DoNotCommitOffsetAndContinue
+	}
+	config.WorkerFailedAttemptCallback = func(_ *Task, _ WorkerResult) FailedDecision {
+		return DoNotCommitOffsetAndContinue
+	}
+	config.OffsetStorage = newInMemoryBatchOffsetStorage()
+	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
+
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, make(chan bool))
+	go manager.Start()
+
+	manager.inputChannel <- []*Message{&Message{Offset: 0, Value: []byte("abc")}, &Message{Offset: 1, Value: []byte("de")}}
+	time.Sleep(1 * time.Second)
+	partition := consumerMetrics.partition(topicPartition)
+	assert(t, partition.messagesMeter.Count(), int64(2))
+	assert(t, partition.bytesMeter.Count(), int64(5))
+	assert(t, partition.taskRetries().Count(), int64(4))
+	assert(t, partition.failedDecision(DoNotCommitOffsetAndContinue).Count(), int64(2))
+	assert(t, partition.taskDuration().Count(), int64(2))
+	assert(t, len(consumerMetrics.Lags()), 1)
+
+	<-manager.Stop()
+	assert(t, len(consumerMetrics.Lags()), 0)
+	assert(t, consumerMetrics.registry.Get("TaskRetries-"+wmid+"-fakeTopic-0"), nil)
+}
+
 func checkAllWorkersAvailable(t *testing.T, wm *WorkerManager) {
 	Trace("test", "Checking all workers availability")
 	//if all workers are available we shouldn't be able to insert one more available worker
@@ -192,9 +305,9 @@ func benchmarkWorkerManager(b *testing.B, numWorkers int, msgsPerBatch int, slee
 	config.OffsetStorage = mockZk
 	topicPartition := TopicAndPartition{"fakeTopic", int32(0)}
 
-	metrics := newConsumerMetrics(wmid, "")
+	consumerMetrics := newConsumerMetrics(wmid, "", metrics.NewRegistry())
 	closeConsumer := make(chan bool)
-	manager := NewWorkerManager(wmid, config, topicPartition, metrics, closeConsumer)
+	manager := NewWorkerManager(wmid, config, topicPartition, consumerMetrics, closeConsumer)
 
 	go manager.Start()
 	b.ResetTimer()
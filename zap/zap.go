@@ -0,0 +1,114 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+// Package zap adapts a zap logger to the go_kafka_client StructuredLogger interface.
+package zap
+
+import (
+	"sort"
+
+	kafka "github.com/mistsys/go_kafka_client"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// zap has no Trace level, so trace messages are logged with Debug level.
+// Critical messages are logged with Error level as zap DPanic, Panic and Fatal levels may panic or exit.
+var levels = map[kafka.LogLevel]zapcore.Level{
+	kafka.TraceLevel:    zapcore.DebugLevel,
+	kafka.DebugLevel:    zapcore.DebugLevel,
+	kafka.InfoLevel:     zapcore.InfoLevel,
+	kafka.WarnLevel:     zapcore.WarnLevel,
+	kafka.ErrorLevel:    zapcore.ErrorLevel,
+	kafka.CriticalLevel: zapcore.ErrorLevel,
+}
+
+// Logger is a go_kafka_client StructuredLogger writing messages and their fields to a zap logger.
+type Logger struct {
+	logger *zap.Logger
+	sugar  *zap.SugaredLogger
+}
+
+// Creates a new Logger writing to a given zap logger.
+func NewLogger(logger *zap.Logger) *Logger {
+	return &Logger{
+		logger: logger,
+		sugar:  logger.Sugar(),
+	}
+}
+
+// Formats a given message according to given params to log with level Trace.
+func (this *Logger) Trace(message string, params ...interface{}) {
+	this.sugar.Debugf(message, params...)
+}
+
+// Formats a given message according to given params to log with level Debug.
+func (this *Logger) Debug(message string, params ...interface{}) {
+	this.sugar.Debugf(message, params...)
+}
+
+// Formats a given message according to given params to log with level Info.
+func (this *Logger) Info(message string, params ...interface{}) {
+	this.sugar.Infof(message, params...)
+}
+
+// Formats a given message according to given params to log with level Warn.
+func (this *Logger) Warn(message string, params ...interface{}) {
+	this.sugar.Warnf(message, params...)
+}
+
+// Formats a given message according to given params to log with level Error.
+func (this *Logger) Error(message string, params ...interface{}) {
+	this.sugar.Errorf(message, params...)
+}
+
+// Formats a given message according to given params to log with level Critical.
+func (this *Logger) Critical(message string, params ...interface{}) {
+	this.sugar.Errorf(message, params...)
+}
+
+// Logs a given message with given fields with a given level. Fields are sorted by key.
+func (this *Logger) Log(level kafka.LogLevel, message string, fields kafka.Fields) {
+	entry := this.logger.Check(levels[level], message)
+	if entry == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	zapFields := make([]zap.Field, 0, len(fields))
+	for _, key := range keys {
+		zapFields = append(zapFields, zap.Any(key, fields[key]))
+	}
+	entry.Write(zapFields...)
+}
+
+// Returns the lowest level enabled in the underlying zap logger.
+func (this *Logger) GetLogLevel() kafka.LogLevel {
+	for _, level := range []kafka.LogLevel{kafka.DebugLevel, kafka.InfoLevel, kafka.WarnLevel, kafka.ErrorLevel} {
+		if this.IsAllowed(level) {
+			return level
+		}
+	}
+	return kafka.CriticalLevel
+}
+
+// Checks whether a given level is enabled in the underlying zap logger.
+func (this *Logger) IsAllowed(level kafka.LogLevel) bool {
+	return this.logger.Core().Enabled(levels[level])
+}
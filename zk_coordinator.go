@@ -54,6 +54,10 @@ func (this *ZookeeperCoordinator) String() string {
 	return "zk"
 }
 
+func (this *ZookeeperCoordinator) LogFields() Fields {
+	return Fields{"coordinator": "zk", "zookeeper": this.config.ZookeeperConnect}
+}
+
 // Creates a new ZookeeperCoordinator with a given configuration.
 // The new created ZookeeperCoordinator does NOT automatically connect to zookeeper, you should call Connect() explicitly
 func NewZookeeperCoordinator(Config *ZookeeperConfig) *ZookeeperCoordinator {
@@ -73,7 +77,7 @@ func (this *ZookeeperCoordinator) Connect() (err error) {
 			go this.listenConnectionEvents(connectionEvents)
 			return
 		}
-		Tracef(this, "Zookeeper connect failed after %d-th retry", i)
+		Tracew(this, "Zookeeper connect failed", Fields{"retry": i})
 		time.Sleep(this.config.RequestBackoff)
 	}
 
@@ -81,13 +85,18 @@ func (this *ZookeeperCoordinator) Connect() (err error) {
 }
 
 func (this *ZookeeperCoordinator) tryConnect() (zkConn *zk.Conn, connectionEvents <-chan zk.Event, err error) {
-	Infof(this, "Connecting to ZK at %s\n", this.config.ZookeeperConnect)
+	Info(this, "Connecting to ZK")
 	zkConn, connectionEvents, err = zk.Connect(this.config.ZookeeperConnect, this.config.ZookeeperTimeout)
 	return
 }
 
+/* Returns true if there is an established Zookeeper session, false otherwise. */
+func (this *ZookeeperCoordinator) IsConnected() bool {
+	return !this.closed && this.zkConn != nil && this.zkConn.State() == zk.StateHasSession
+}
+
 func (this *ZookeeperCoordinator) Disconnect() {
-	Infof(this, "Closing connection to ZK at %s\n", this.config.ZookeeperConnect)
+	Info(this, "Closing connection to ZK")
 	this.closed = true
 	this.zkConn.Close()
 }
@@ -130,7 +139,7 @@ func (this *ZookeeperCoordinator) RegisterConsumer(Consumerid string, Groupid st
 		if err == nil {
 			return
 		}
-		Tracef(this, "Registering consumer %s in group %s failed after %d-th retry", Consumerid, Groupid, i)
+		Tracew(this, "Registering consumer failed", Fields{"consumer": Consumerid, "group": Groupid, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -138,7 +147,7 @@ func (this *ZookeeperCoordinator) RegisterConsumer(Consumerid string, Groupid st
 }
 
 func (this *ZookeeperCoordinator) tryRegisterConsumer(Consumerid string, Groupid string, TopicCount TopicsToNumStreams) (err error) {
-	Debugf(this, "Trying to register consumer %s at group %s in Zookeeper", Consumerid, Groupid)
+	Debugw(this, "Trying to register consumer in Zookeeper", Fields{"consumer": Consumerid, "group": Groupid})
 	registryDir := newZKGroupDirs(this.config.Root, Groupid).ConsumerRegistryDir
 	pathToConsumer := fmt.Sprintf("%s/%s", registryDir, Consumerid)
 	data, mappingError := json.Marshal(&ConsumerInfo{
@@ -151,7 +160,7 @@ func (this *ZookeeperCoordinator) tryRegisterConsumer(Consumerid string, Groupid
 		return mappingError
 	}
 
-	Debugf(this, "Path: %s", pathToConsumer)
+	Debugw(this, "Registering consumer at path", Fields{"path": pathToConsumer})
 
 	_, err = this.zkConn.Create(pathToConsumer, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
 	if err == zk.ErrNoNode {
@@ -164,12 +173,12 @@ func (this *ZookeeperCoordinator) tryRegisterConsumer(Consumerid string, Groupid
 		var stat *zk.Stat
 		_, stat, err = this.zkConn.Get(pathToConsumer)
 		if err != nil {
-			Debugf(this, "%v; path: %s", err, pathToConsumer)
+			Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": pathToConsumer})
 			return err
 		}
 		_, err = this.zkConn.Set(pathToConsumer, data, stat.Version)
 		if err != nil {
-			Debugf(this, "%v; path: %s", err, pathToConsumer)
+			Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": pathToConsumer})
 			return err
 		}
 	}
@@ -180,14 +189,14 @@ func (this *ZookeeperCoordinator) tryRegisterConsumer(Consumerid string, Groupid
 /* Deregisters consumer with Consumerid id that is a part of consumer group Groupid form this ConsumerCoordinator. Returns an error if deregistration failed, nil otherwise. */
 func (this *ZookeeperCoordinator) DeregisterConsumer(Consumerid string, Groupid string) (err error) {
 	path := fmt.Sprintf("%s/%s", newZKGroupDirs(this.config.Root, Groupid).ConsumerRegistryDir, Consumerid)
-	Debugf(this, "Trying to deregister consumer at path: %s", path)
+	Debugw(this, "Trying to deregister consumer", Fields{"path": path})
 	backoffMultiplier := 1
 	for i := 0; i <= this.config.MaxRequestRetries; i++ {
 		err = this.deleteNode(path)
 		if err == nil {
 			return
 		}
-		Tracef(this, "Deregistering consumer %s in group %s failed after %d-th retry", Consumerid, Groupid, i)
+		Tracew(this, "Deregistering consumer failed", Fields{"consumer": Consumerid, "group": Groupid, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -203,7 +212,7 @@ func (this *ZookeeperCoordinator) GetConsumerInfo(Consumerid string, Groupid str
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetConsumerInfo failed for consumer %s in group %s after %d-th retry", Consumerid, Groupid, i)
+		Tracew(this, "GetConsumerInfo failed", Fields{"consumer": Consumerid, "group": Groupid, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -214,7 +223,7 @@ func (this *ZookeeperCoordinator) tryGetConsumerInfo(Consumerid string, Groupid
 	zkPath := fmt.Sprintf("%s/%s", newZKGroupDirs(this.config.Root, Groupid).ConsumerRegistryDir, Consumerid)
 	data, _, err := this.zkConn.Get(zkPath)
 	if err != nil {
-		Debugf(this, "%v; path: %s", err, zkPath)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
 		return nil, err
 	}
 
@@ -267,7 +276,7 @@ func (this *ZookeeperCoordinator) GetConsumersPerTopic(Groupid string, ExcludeIn
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetConsumersPerTopic failed for group %s after %d-th retry", Groupid, i)
+		Tracew(this, "GetConsumersPerTopic failed", Fields{"group": Groupid, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -308,7 +317,7 @@ func (this *ZookeeperCoordinator) GetConsumersInGroup(Groupid string) (consumers
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetConsumersInGroup failed for group %s after %d-th retry", Groupid, i)
+		Tracew(this, "GetConsumersInGroup failed", Fields{"group": Groupid, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -316,11 +325,11 @@ func (this *ZookeeperCoordinator) GetConsumersInGroup(Groupid string) (consumers
 }
 
 func (this *ZookeeperCoordinator) tryGetConsumersInGroup(Groupid string) (consumers []string, err error) {
-	Debugf(this, "Getting consumers in group %s", Groupid)
+	Debugw(this, "Getting consumers in group", Fields{"group": Groupid})
 	zkPath := newZKGroupDirs(this.config.Root, Groupid).ConsumerRegistryDir
 	consumers, _, err = this.zkConn.Children(zkPath)
 	if err != nil {
-		Debugf(this, "%v; path: %s", err, zkPath)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
 		return nil, err
 	}
 	return
@@ -334,7 +343,7 @@ func (this *ZookeeperCoordinator) GetAllTopics() (topics []string, err error) {
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetAllTopics failed after %d-th retry", i)
+		Tracew(this, "GetAllTopics failed", Fields{"retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -349,7 +358,7 @@ func (this *ZookeeperCoordinator) tryGetAllTopics() (topics []string, err error)
 	zkPath := this.rootedPath(brokerTopicsPath)
 	topics, _, err = this.zkConn.Children(zkPath)
 	if err != nil {
-		Debugf(this, "%v; path: %s", err, zkPath)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
 		return nil, err
 	}
 	return
@@ -364,7 +373,7 @@ func (this *ZookeeperCoordinator) GetPartitionsForTopics(Topics []string) (parti
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetPartitionsForTopics for topics %s failed after %d-th retry", Topics, i)
+		Tracew(this, "GetPartitionsForTopics failed", Fields{"topics": Topics, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -399,7 +408,7 @@ func (this *ZookeeperCoordinator) GetAllBrokers() (brokers []*BrokerInfo, err er
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetAllBrokers failed after %d-th retry", i)
+		Tracew(this, "GetAllBrokers failed", Fields{"retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -411,7 +420,7 @@ func (this *ZookeeperCoordinator) tryGetAllBrokers() ([]*BrokerInfo, error) {
 	zkPath := this.rootedPath(brokerIdsPath)
 	brokerIds, _, err := this.zkConn.Children(zkPath)
 	if err != nil {
-		Debugf(this, "%v; path: %s", err, zkPath)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
 		return nil, err
 	}
 	brokers := make([]*BrokerInfo, len(brokerIds))
@@ -440,7 +449,7 @@ func (this *ZookeeperCoordinator) GetOffset(Groupid string, topic string, partit
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetOffset for group %s, topic %s and partition %d failed after %d-th retry", Groupid, topic, partition, i)
+		Tracew(this, "GetOffset failed", Fields{"group": Groupid, "topic": topic, "partition": partition, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -455,7 +464,7 @@ func (this *ZookeeperCoordinator) tryGetOffsetForTopicPartition(Groupid string,
 		if err == zk.ErrNoNode {
 			return InvalidOffset, nil
 		} else {
-			Debugf(this, "%v; path: %s", err, zkPath)
+			Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
 			return InvalidOffset, err
 		}
 	}
@@ -477,7 +486,7 @@ func (this *ZookeeperCoordinator) SubscribeForChanges(Groupid string) (events <-
 		if err == nil {
 			return
 		}
-		Tracef(this, "SubscribeForChanges for group %s failed after %d-th retry", Groupid, i)
+		Tracew(this, "SubscribeForChanges failed", Fields{"group": Groupid, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -496,7 +505,7 @@ func (this *ZookeeperCoordinator) trySubscribeForChanges(Groupid string) (<-chan
 		groupWatch = this.watches[Groupid]
 	}
 
-	Infof(this, "Subscribing for changes for %s", Groupid)
+	Infow(this, "Subscribing for changes", Fields{"group": Groupid})
 	zkEvents := make(chan zk.Event, 100)
 	this.watches[Groupid].zkEvents = zkEvents
 
@@ -526,7 +535,7 @@ func (this *ZookeeperCoordinator) trySubscribeForChanges(Groupid string) (<-chan
 			select {
 			case e := <-zkEvents:
 				{
-					Infof(this, "Received zkEvent Type: %s State: %s Path: %s", e.Type.String(), e.State.String(), e.Path)
+					Infow(this, "Received zkEvent", Fields{"type": e.Type.String(), "state": e.State.String(), "path": e.Path})
 					if e.Type != zk.EventNotWatching && e.State != zk.StateDisconnected {
 						if strings.HasPrefix(e.Path, fmt.Sprintf("%s/%s",
 							newZKGroupDirs(this.config.Root, Groupid).ConsumerApiDir, BlueGreenDeploymentAPI)) {
@@ -564,7 +573,7 @@ func (this *ZookeeperCoordinator) trySubscribeForChanges(Groupid string) (<-chan
 							this.config.PanicHandler(err)
 						}
 					} else {
-						Warnf(this, "Unknown event path: %s", e.Path)
+						Warnw(this, "Unknown event path", Fields{"path": e.Path})
 					}
 
 					stopRedirecting <- true
@@ -591,7 +600,7 @@ func (this *ZookeeperCoordinator) GetBlueGreenRequest(Group string) (topics map[
 		if err == nil {
 			return
 		}
-		Tracef(this, "GetNewDeployedTopics for group %s failed after %d-th retry", Group, i)
+		Tracew(this, "GetNewDeployedTopics failed", Fields{"group": Group, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -632,7 +641,7 @@ func (this *ZookeeperCoordinator) RequestBlueGreenDeployment(blue BlueGreenDeplo
 		if err == nil {
 			break
 		}
-		Tracef(this, "DeployTopics for group %s and topics %s failed after %d-th retry", green.Group, blue.Topics, i)
+		Tracew(this, "DeployTopics failed", Fields{"group": green.Group, "topics": blue.Topics, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -647,7 +656,7 @@ func (this *ZookeeperCoordinator) RequestBlueGreenDeployment(blue BlueGreenDeplo
 		if err == nil {
 			return err
 		}
-		Tracef(this, "DeployTopics for group %s and topics %s failed after %d-th retry", blue.Group, green.Topics, i)
+		Tracew(this, "DeployTopics failed", Fields{"group": blue.Group, "topics": green.Topics, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -730,18 +739,18 @@ func (this *ZookeeperCoordinator) AwaitOnStateBarrier(consumerId string, group s
 
 	if err != nil {
 		// Encountered an error waiting for consensus... Fail it
-		Errorf(this, "Failed awaiting on state barrier %s [%v]", barrierName, err)
+		Errorw(this, "Failed awaiting on state barrier", Fields{"barrier": barrierName, "error": err})
 		return false
 	}
 
-	Infof(this, "Successfully awaited on state barrier %s", barrierName)
+	Infow(this, "Successfully awaited on state barrier", Fields{"barrier": barrierName})
 	return true
 }
 
 func (this *ZookeeperCoordinator) joinStateBarrier(barrierPath, consumerId string, timeout time.Duration) (time.Time, error) {
 	deadline := time.Now().Add(timeout)
 	var err error
-	Infof(this, "Joining state barrier %s", barrierPath)
+	Infow(this, "Joining state barrier", Fields{"path": barrierPath})
 	for i := 0; i <= this.config.MaxRequestRetries; i++ {
 		// Attempt to create the barrier path, with a shared deadline
 		_, err = this.zkConn.Create(barrierPath, []byte(strconv.FormatInt(deadline.Unix(), 10)), 0, zk.WorldACL(zk.PermAll))
@@ -753,7 +762,7 @@ func (this *ZookeeperCoordinator) joinStateBarrier(barrierPath, consumerId strin
 			if data, _, err := this.zkConn.Get(barrierPath); err == nil {
 				deadlineInt, _ := strconv.ParseInt(string(data), 10, 64)
 				deadline = time.Unix(deadlineInt, 0)
-				Infof(this, "Barrier already exists with deadline set to %v. Joining...", deadline)
+				Infow(this, "Barrier already exists. Joining...", Fields{"path": barrierPath, "deadline": deadline})
 			} else {
 				continue
 			}
@@ -761,10 +770,10 @@ func (this *ZookeeperCoordinator) joinStateBarrier(barrierPath, consumerId strin
 		// Register our consumerId as a child node on the barrierPath. This should notify other consumers we have joined.
 		// Need to join as an ephemeral node to ensure that if the barrier Id is re-used we aren't permanently registered giving false counts.
 		if _, err = this.zkConn.Create(fmt.Sprintf("%s/%s", barrierPath, consumerId), make([]byte, 0), zk.FlagEphemeral, zk.WorldACL(zk.PermAll)); err == nil || err == zk.ErrNodeExists {
-			Infof(this, "Successfully joined state barrier %s", barrierPath)
+			Infow(this, "Successfully joined state barrier", Fields{"path": barrierPath})
 			return deadline, nil
 		}
-		Warnf(this, "Failed to join state barrier %s, retrying...", barrierPath)
+		Warnw(this, "Failed to join state barrier, retrying...", Fields{"path": barrierPath})
 	}
 	return time.Now(), fmt.Errorf("Failed to join state barrier %s after %d retries [%v]", barrierPath, this.config.MaxRequestRetries, err)
 }
@@ -813,7 +822,7 @@ func (this *ZookeeperCoordinator) RemoveStateBarrier(group string, stateHash str
 		if err == nil || err == zk.ErrNoNode {
 			return nil
 		}
-		Tracef(this, "State assertion deletion %s in group %s failed after %d-th retry", hash, group, i)
+		Tracew(this, "State assertion deletion failed", Fields{"barrier": hash, "group": group, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -823,7 +832,7 @@ func (this *ZookeeperCoordinator) RemoveStateBarrier(group string, stateHash str
 
 func (this *ZookeeperCoordinator) tryRemoveStateBarrier(group string, stateHash string, api string) error {
 	path := fmt.Sprintf("%s/%s/%s", newZKGroupDirs(this.config.Root, group).ConsumerApiDir, api, stateHash)
-	Debugf(this, "Trying to fail rebalance at path: %s", path)
+	Debugw(this, "Trying to fail rebalance", Fields{"path": path})
 
 	return this.deleteNode(path)
 }
@@ -831,7 +840,7 @@ func (this *ZookeeperCoordinator) tryRemoveStateBarrier(group string, stateHash
 func (this *ZookeeperCoordinator) deleteNode(path string) error {
 	children, _, err := this.zkConn.Children(path)
 	if err != nil {
-		Debugf(this, "%v; path: %s", err, path)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": path})
 		return err
 	}
 	for _, child := range children {
@@ -843,7 +852,7 @@ func (this *ZookeeperCoordinator) deleteNode(path string) error {
 
 	_, stat, err := this.zkConn.Get(path)
 	if err != nil {
-		Debugf(this, "%v; path: %s", err, path)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": path})
 		return err
 	}
 	return this.zkConn.Delete(path, stat.Version)
@@ -864,7 +873,7 @@ func (this *ZookeeperCoordinator) ClaimPartitionOwnership(Groupid string, Topic
 		if ok {
 			return ok, err
 		}
-		Tracef(this, "Claim failed for topic %s, partition %d after %d-th retry", Topic, Partition, i)
+		Tracew(this, "Claim failed", Fields{"topic": Topic, "partition": Partition, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -892,7 +901,7 @@ func (this *ZookeeperCoordinator) tryClaimPartitionOwnership(group string, topic
 				// If the current owner of the partition is the same consumer Id as the current one, carry on.
 				return true, nil
 			}
-			Debugf(consumerThreadId, "waiting for the partition ownership to be deleted: %d", partition)
+			Debugw(consumerThreadId, "Waiting for the partition ownership to be deleted", Fields{"group": group, "topic": topic, "partition": partition})
 			return false, nil
 		} else {
 			Error(consumerThreadId, err)
@@ -900,7 +909,7 @@ func (this *ZookeeperCoordinator) tryClaimPartitionOwnership(group string, topic
 		}
 	}
 
-	Debugf(this, "Successfully claimed partition %d in topic %s for %s", partition, topic, consumerThreadId)
+	Debugw(this, "Successfully claimed partition", Fields{"topic": topic, "partition": partition, "thread": consumerThreadId})
 
 	return true, nil
 }
@@ -915,7 +924,7 @@ func (this *ZookeeperCoordinator) ReleasePartitionOwnership(Groupid string, Topi
 		if err == nil {
 			return err
 		}
-		Tracef(this, "ReleasePartitionOwnership failed for group %s, topic %s, partition %d after %d-th retry", Groupid, Topic, Partition, i)
+		Tracew(this, "ReleasePartitionOwnership failed", Fields{"group": Groupid, "topic": Topic, "partition": Partition, "retry": i})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -932,6 +941,85 @@ func (this *ZookeeperCoordinator) tryReleasePartitionOwnership(group string, top
 	}
 }
 
+/* Gets the list of all consumer groups registered in ZooKeeper. Returns a slice containing group names and error on failure. */
+func (this *ZookeeperCoordinator) GetAllGroups() (groups []string, err error) {
+	backoffMultiplier := 1
+	for i := 0; i <= this.config.MaxRequestRetries; i++ {
+		groups, err = this.tryGetAllGroups()
+		if err == nil {
+			return
+		}
+		Tracew(this, "GetAllGroups failed", Fields{"retry": i})
+		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
+		backoffMultiplier++
+	}
+	return
+}
+
+func (this *ZookeeperCoordinator) tryGetAllGroups() (groups []string, err error) {
+	zkPath := this.rootedPath(consumersPath)
+	groups, _, err = this.zkConn.Children(zkPath)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return []string{}, nil
+		}
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
+		return nil, err
+	}
+	return
+}
+
+// Gets all offsets committed by consumer group Groupid.
+// Returns a map where keys are topic partitions and values are committed offsets and error on failure.
+func (this *ZookeeperCoordinator) GetGroupOffsets(Groupid string) (offsets map[TopicAndPartition]int64, err error) {
+	backoffMultiplier := 1
+	for i := 0; i <= this.config.MaxRequestRetries; i++ {
+		offsets, err = this.tryGetGroupOffsets(Groupid)
+		if err == nil {
+			return
+		}
+		Tracew(this, "GetGroupOffsets failed", Fields{"group": Groupid, "retry": i})
+		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
+		backoffMultiplier++
+	}
+	return
+}
+
+func (this *ZookeeperCoordinator) tryGetGroupOffsets(Groupid string) (map[TopicAndPartition]int64, error) {
+	offsets := make(map[TopicAndPartition]int64)
+	zkPath := fmt.Sprintf("%s/offsets", newZKGroupDirs(this.config.Root, Groupid).ConsumerGroupDir)
+	topics, _, err := this.zkConn.Children(zkPath)
+	if err != nil {
+		if err == zk.ErrNoNode {
+			return offsets, nil
+		}
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
+		return nil, err
+	}
+
+	for _, topic := range topics {
+		dirs := newZKGroupTopicDirs(this.config.Root, Groupid, topic)
+		partitions, _, err := this.zkConn.Children(dirs.ConsumerOffsetDir)
+		if err != nil {
+			Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": dirs.ConsumerOffsetDir})
+			return nil, err
+		}
+		for _, partition := range partitions {
+			partitionId, err := strconv.Atoi(partition)
+			if err != nil {
+				return nil, err
+			}
+			offset, err := this.tryGetOffsetForTopicPartition(Groupid, topic, int32(partitionId))
+			if err != nil {
+				return nil, err
+			}
+			offsets[TopicAndPartition{topic, int32(partitionId)}] = offset
+		}
+	}
+
+	return offsets, nil
+}
+
 // Tells the ConsumerCoordinator to commit offset Offset for topic and partition TopicPartition for consumer group Groupid.
 // Returns error if failed to commit offset.
 func (this *ZookeeperCoordinator) CommitOffset(Groupid string, Topic string, Partition int32, Offset int64) error {
@@ -956,7 +1044,7 @@ func (this *ZookeeperCoordinator) ensureZkPathsExist(group string) {
 }
 
 func (this *ZookeeperCoordinator) getWatcher(path string) (<-chan zk.Event, error) {
-	Debugf(this, "Getting watcher for %s", path)
+	Debugw(this, "Getting watcher", Fields{"path": path})
 
 	var watcher <-chan zk.Event
 	var err error
@@ -966,7 +1054,7 @@ func (this *ZookeeperCoordinator) getWatcher(path string) (<-chan zk.Event, erro
 		if err == nil {
 			return watcher, err
 		}
-		Debugf(this, "%v; path: %s", err, path)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": path})
 		time.Sleep(this.config.RequestBackoff * time.Duration(backoffMultiplier))
 		backoffMultiplier++
 	}
@@ -991,11 +1079,11 @@ func (this *ZookeeperCoordinator) getTopicsWatcher() (<-chan zk.Event, error) {
 }
 
 func (this *ZookeeperCoordinator) getBrokerInfo(brokerId int32) (*BrokerInfo, error) {
-	Debugf(this, "Getting info for broker %d", brokerId)
+	Debugw(this, "Getting info for broker", Fields{"broker": brokerId})
 	pathToBroker := fmt.Sprintf("%s/%d", this.rootedPath(brokerIdsPath), brokerId)
 	data, _, zkError := this.zkConn.Get(pathToBroker)
 	if zkError != nil {
-		Debugf(this, "%v; path: %s", zkError, pathToBroker)
+		Debugw(this, "Zookeeper request failed", Fields{"error": zkError, "path": pathToBroker})
 		return nil, zkError
 	}
 
@@ -1006,7 +1094,7 @@ func (this *ZookeeperCoordinator) getBrokerInfo(brokerId int32) (*BrokerInfo, er
 }
 
 func (this *ZookeeperCoordinator) getPartitionAssignmentsForTopics(topics []string) (map[string]map[int32][]int32, error) {
-	Debugf(this, "Trying to get partition assignments for topics %v", topics)
+	Debugw(this, "Trying to get partition assignments", Fields{"topics": topics})
 	result := make(map[string]map[int32][]int32)
 	for _, topic := range topics {
 		topicInfo, err := this.getTopicInfo(topic)
@@ -1030,7 +1118,7 @@ func (this *ZookeeperCoordinator) getTopicInfo(topic string) (*TopicInfo, error)
 	zkPath := fmt.Sprintf("%s/%s", this.rootedPath(brokerTopicsPath), topic)
 	data, _, err := this.zkConn.Get(zkPath)
 	if err != nil {
-		Debugf(this, "%v; path: %s", err, zkPath)
+		Debugw(this, "Zookeeper request failed", Fields{"error": err, "path": zkPath})
 		return nil, err
 	}
 	topicInfo := &TopicInfo{}
@@ -1051,12 +1139,12 @@ func (this *ZookeeperCoordinator) createOrUpdatePathParentMayNotExistFailFast(pa
 }
 
 func (this *ZookeeperCoordinator) createOrUpdatePathParentMayNotExist(pathToCreate string, data []byte, failSafe bool) error {
-	Debugf(this, "Trying to create path %s in Zookeeper", pathToCreate)
+	Debugw(this, "Trying to create path in Zookeeper", Fields{"path": pathToCreate})
 	_, err := this.zkConn.Create(pathToCreate, data, 0, zk.WorldACL(zk.PermAll))
 	if err != nil {
 		if zk.ErrNodeExists == err {
 			if len(data) > 0 {
-				Debugf(this, "Trying to update existing node %s", pathToCreate)
+				Debugw(this, "Trying to update existing node", Fields{"path": pathToCreate})
 				return this.updateRecord(pathToCreate, data)
 			} else {
 				return nil
@@ -1073,10 +1161,10 @@ func (this *ZookeeperCoordinator) createOrUpdatePathParentMayNotExist(pathToCrea
 				}
 				return err
 			} else {
-				Debugf(this, "Successfully created path %s", parent[:len(parent)-1])
+				Debugw(this, "Successfully created path", Fields{"path": parent[:len(parent)-1]})
 			}
 
-			Debugf(this, "Trying again to create path %s in Zookeeper", pathToCreate)
+			Debugw(this, "Trying again to create path in Zookeeper", Fields{"path": pathToCreate})
 			_, err = this.zkConn.Create(pathToCreate, data, 0, zk.WorldACL(zk.PermAll))
 			if err == zk.ErrNodeExists && failSafe {
 				err = nil
@@ -1088,7 +1176,7 @@ func (this *ZookeeperCoordinator) createOrUpdatePathParentMayNotExist(pathToCrea
 }
 
 func (this *ZookeeperCoordinator) updateRecord(pathToCreate string, dataToWrite []byte) error {
-	Debugf(this, "Trying to update path %s", pathToCreate)
+	Debugw(this, "Trying to update path", Fields{"path": pathToCreate})
 	_, stat, _ := this.zkConn.Get(pathToCreate)
 	_, err := this.zkConn.Set(pathToCreate, dataToWrite, stat.Version)
 	if err != nil {